@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+type adminUser struct {
+	PublicID                string     `json:"public_id"`
+	Name                    string     `json:"name"`
+	Email                   string     `json:"email"`
+	DisabledAt              *time.Time `json:"disabled_at"`
+	PasswordResetRequiredAt *time.Time `json:"password_reset_required_at"`
+	LockedUntil             *time.Time `json:"locked_until"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+}
+
+func toAdminUser(user *models.User) (adminUser, error) {
+	name, err := crypto.Decrypt(user.Name, os.Getenv("APP_KEY"))
+	if err != nil {
+		return adminUser{}, err
+	}
+
+	return adminUser{
+		PublicID:                user.PublicID,
+		Name:                    name,
+		Email:                   user.Email,
+		DisabledAt:              user.DisabledAt,
+		PasswordResetRequiredAt: user.PasswordResetRequiredAt,
+		LockedUntil:             user.LockedUntil,
+		CreatedAt:               user.CreatedAt,
+		UpdatedAt:               user.UpdatedAt,
+	}, nil
+}
+
+// pagination reads the page and per_page query parameters.
+func pagination(r *http.Request) (int, int, error) {
+	keys := r.URL.Query()
+
+	page, perPage := 1, defaultPerPage
+	var err error
+	if value := keys.Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return 0, 0, errors.New("invalid page")
+		}
+	}
+	if value := keys.Get("per_page"); value != "" {
+		perPage, err = strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > maxPerPage {
+			return 0, 0, errors.New("per_page must be between 1 and " + strconv.Itoa(maxPerPage))
+		}
+	}
+
+	return page, perPage, nil
+}
+
+// parseDate accepts RFC 3339 timestamps and plain YYYY-MM-DD dates.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.Parse("2006-01-02", value)
+}
+
+func (server *Server) ListUsers(w http.ResponseWriter, r *http.Request) {
+	keys := r.URL.Query()
+
+	page, perPage, err := pagination(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	filter := models.UserFilter{Email: keys.Get("email")}
+	filter.CreatedFrom, err = parseDate(keys.Get("created_from"))
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("invalid created_from"))
+		return
+	}
+	filter.CreatedTo, err = parseDate(keys.Get("created_to"))
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("invalid created_to"))
+		return
+	}
+	if value := keys.Get("disabled"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("invalid disabled"))
+			return
+		}
+		filter.Disabled = &disabled
+	}
+
+	user := models.User{}
+	users, total, err := user.FindAllUsers(server.DB, filter, page, perPage)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result := []adminUser{}
+	for i := range *users {
+		found, err := toAdminUser(&(*users)[i])
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		result = append(result, found)
+	}
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), struct {
+		Users   []adminUser `json:"users"`
+		Page    int         `json:"page"`
+		PerPage int         `json:"per_page"`
+		Total   int         `json:"total"`
+	}{
+		Users:   result,
+		Page:    page,
+		PerPage: perPage,
+		Total:   total,
+	})
+}
+
+func (server *Server) ShowUserByPublicID(w http.ResponseWriter, r *http.Request) {
+	user := models.User{}
+	found, err := user.FindUserByPublicID(server.DB, mux.Vars(r)["public_id"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	server.respondAdminUser(w, found.ID, http.StatusText(http.StatusOK))
+}
+
+func (server *Server) DisableUser(w http.ResponseWriter, r *http.Request) {
+	user := models.User{}
+	found, err := user.FindUserByPublicID(server.DB, mux.Vars(r)["public_id"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	err = user.DisableUser(server.DB, found.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = server.revokeUserSessions(found.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminUserDisable, ""), found)
+
+	server.respondAdminUser(w, found.ID, "user disabled")
+}
+
+func (server *Server) EnableUser(w http.ResponseWriter, r *http.Request) {
+	user := models.User{}
+	found, err := user.FindUserByPublicID(server.DB, mux.Vars(r)["public_id"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	err = user.EnableUser(server.DB, found.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminUserEnable, ""), found)
+
+	server.respondAdminUser(w, found.ID, "user enabled")
+}
+
+func (server *Server) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	user := models.User{}
+	found, err := user.FindUserByPublicID(server.DB, mux.Vars(r)["public_id"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	err = user.UnlockUser(server.DB, found.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminUserUnlock, ""), found)
+
+	server.respondAdminUser(w, found.ID, "user unlocked")
+}
+
+func (server *Server) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	user := models.User{}
+	found, err := user.FindUserByPublicID(server.DB, mux.Vars(r)["public_id"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	err = user.RequirePasswordReset(server.DB, found.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = server.revokeUserSessions(found.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = server.sendPasswordResetEmail(r, found)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminUserForceReset, ""), found)
+
+	server.respondAdminUser(w, found.ID, "password reset required")
+}
+
+func (server *Server) DeleteUserByPublicID(w http.ResponseWriter, r *http.Request) {
+	user := models.User{}
+	found, err := user.FindUserByPublicID(server.DB, mux.Vars(r)["public_id"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	publicID := found.PublicID
+
+	email, err := user.DeleteUser(server.DB, found.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminUserDelete, ""), found)
+
+	responses.JSON(w, http.StatusOK, true, "user deleted", struct {
+		PublicID string `json:"public_id"`
+		Email    string `json:"email"`
+	}{
+		PublicID: publicID,
+		Email:    email,
+	})
+}
+
+// revokeUserSessions signs the user out everywhere: sessions and refresh
+// tokens are revoked and access tokens denylisted.
+func (server *Server) revokeUserSessions(userID uint32) error {
+	session := models.Session{}
+	err := session.RevokeUserSessions(server.DB, userID)
+	if err != nil {
+		return err
+	}
+
+	refreshToken := models.RefreshToken{}
+	err = refreshToken.RevokeUserRefreshTokens(server.DB, userID)
+	if err != nil {
+		return err
+	}
+
+	return jwt.RevokeAllTokens(userID)
+}
+
+func (server *Server) respondAdminUser(w http.ResponseWriter, userID uint32, message string) {
+	user := models.User{}
+	err := server.DB.Debug().Model(models.User{}).Where("id = ?", userID).Take(&user).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	found, err := toAdminUser(&user)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, message, found)
+}
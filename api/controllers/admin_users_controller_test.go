@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+)
+
+func TestDisableUserSignsOut(t *testing.T) {
+	server := newTestServer(t, &models.User{}, &models.Session{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.AuditEvent{})
+	jwt.SetRevocationStore(&models.TokenRevocations{DB: server.DB})
+	t.Cleanup(func() { jwt.SetRevocationStore(nil) })
+
+	user := models.User{Name: "Jane", Email: "jane@example.com", Password: "password"}
+	err := server.DB.Create(&user).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := (&models.Session{}).SaveSession(server.DB, user.ID, "192.0.2.1", "curl/8.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, err := (&models.RefreshToken{}).SaveRefreshToken(server.DB, user.ID, "web", session.PublicID, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/v1/admin/users/"+user.PublicID+"/disable", nil), map[string]string{"public_id": user.PublicID})
+	w := httptest.NewRecorder()
+	server.DisableUser(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("disabling: %d %s", w.Code, w.Body)
+	}
+
+	sessions, err := (&models.Session{}).FindUserSessions(server.DB, user.ID)
+	if err != nil || len(*sessions) != 0 {
+		t.Errorf("sessions of a disabled user: %v %v", sessions, err)
+	}
+	_, err = (&models.RefreshToken{}).RotateRefreshToken(server.DB, refreshToken, "")
+	if err != models.ErrInvalidRefreshToken {
+		t.Errorf("rotating a refresh token of a disabled user: %v, want %v", err, models.ErrInvalidRefreshToken)
+	}
+
+	// access tokens issued until now are rejected
+	revoked, err := (&models.TokenRevocations{DB: server.DB}).IsRevoked("", user.ID, "", time.Now().Add(-time.Second))
+	if err != nil || !revoked {
+		t.Errorf("access tokens of a disabled user: revoked %v, %v", revoked, err)
+	}
+
+	events := []models.AuditEvent{}
+	server.DB.Where("action = ?", models.AuditAdminUserDisable).Find(&events)
+	if len(events) != 1 || events[0].TargetID == nil || *events[0].TargetID != user.ID {
+		t.Errorf("audit events: %+v", events)
+	}
+
+	r = mux.SetURLVars(httptest.NewRequest("POST", "/v1/admin/users/unknown/disable", nil), map[string]string{"public_id": "unknown"})
+	w = httptest.NewRecorder()
+	server.DisableUser(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("disabling an unknown user: %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/middlewares"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+)
+
+// Sign in methods recorded as the detail of login events.
+const (
+	loginMethodPassword     = "password"
+	loginMethodTOTP         = "totp"
+	loginMethodRecoveryCode = "recovery-code"
+	loginMethodMagicLink    = "magic-link"
+	loginMethodPasskey      = "passkey"
+	loginMethodDevice       = "device"
+)
+
+// audit appends event to the audit log with the client IP address and user
+// agent of r. The actor is the signed in user, or else the target of a
+// successful action; a failed sign in does not prove who tried. Writing the
+// log never fails the request it describes.
+func (server *Server) audit(r *http.Request, event models.AuditEvent, target *models.User) {
+	if target != nil {
+		event.TargetID = &target.ID
+		event.TargetEmail = target.Email
+	}
+
+	if tokenID, err := jwt.ExtractTokenID(r); err == nil {
+		event.ActorID = &tokenID
+		if target != nil && target.ID == tokenID {
+			event.ActorEmail = target.Email
+		} else {
+			actor := models.User{}
+			if server.DB.Debug().Model(models.User{}).Where("id = ?", tokenID).Take(&actor).Error == nil {
+				event.ActorEmail = actor.Email
+			}
+		}
+	} else if target != nil && event.Result == models.AuditResultSuccess {
+		event.ActorID = event.TargetID
+		event.ActorEmail = event.TargetEmail
+	}
+
+	event.IP = middlewares.ClientIP(r)
+	event.UserAgent = r.UserAgent()
+
+	_, err := event.SaveAuditEvent(server.DB)
+	if err != nil {
+		log.Printf("audit %s %s: %v", event.Action, event.Result, err)
+	}
+}
+
+func auditSuccess(action, detail string) models.AuditEvent {
+	return models.AuditEvent{Action: action, Result: models.AuditResultSuccess, Detail: detail}
+}
+
+func auditFailure(action, detail string, err error) models.AuditEvent {
+	if detail != "" {
+		detail += ": "
+	}
+
+	return models.AuditEvent{Action: action, Result: models.AuditResultFailure, Detail: detail + err.Error()}
+}
+
+// auditLoginFailure records a refused sign in for email, which may not be
+// registered.
+func (server *Server) auditLoginFailure(r *http.Request, email, method string, err error) {
+	event := auditFailure(models.AuditLogin, method, err)
+	event.TargetEmail = email
+
+	user := models.User{}
+	if server.DB.Debug().Model(models.User{}).Where("email = ?", email).Take(&user).Error != nil {
+		server.audit(r, event, nil)
+		return
+	}
+
+	server.audit(r, event, &user)
+}
+
+func (server *Server) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	keys := r.URL.Query()
+
+	page, perPage, err := pagination(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	filter := models.AuditEventFilter{
+		Action: keys.Get("action"),
+		Result: keys.Get("result"),
+		Email:  keys.Get("email"),
+		IP:     keys.Get("ip"),
+	}
+	if filter.Result != "" && filter.Result != models.AuditResultSuccess && filter.Result != models.AuditResultFailure {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("result must be success or failure"))
+		return
+	}
+	filter.From, err = parseDate(keys.Get("from"))
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("invalid from"))
+		return
+	}
+	filter.To, err = parseDate(keys.Get("to"))
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("invalid to"))
+		return
+	}
+
+	user := models.User{}
+	if value := keys.Get("actor"); value != "" {
+		actor, err := user.FindUserByPublicID(server.DB, value)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("invalid actor"))
+			return
+		}
+		filter.ActorID = &actor.ID
+	}
+	if value := keys.Get("target"); value != "" {
+		target, err := user.FindUserByPublicID(server.DB, value)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("invalid target"))
+			return
+		}
+		filter.TargetID = &target.ID
+	}
+
+	server.respondAuditEvents(w, filter, page, perPage)
+}
+
+// ShowLoginHistory lists the sign ins, successful or not, on the signed in
+// user's account.
+func (server *Server) ShowLoginHistory(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	page, perPage, err := pagination(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	server.respondAuditEvents(w, models.AuditEventFilter{Action: models.AuditLogin, TargetID: &tokenID}, page, perPage)
+}
+
+func (server *Server) respondAuditEvents(w http.ResponseWriter, filter models.AuditEventFilter, page, perPage int) {
+	auditEvent := models.AuditEvent{}
+	auditEvents, total, err := auditEvent.FindAuditEvents(server.DB, filter, page, perPage)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), struct {
+		Events  []models.AuditEvent `json:"events"`
+		Page    int                 `json:"page"`
+		PerPage int                 `json:"per_page"`
+		Total   int                 `json:"total"`
+	}{
+		Events:  *auditEvents,
+		Page:    page,
+		PerPage: perPage,
+		Total:   total,
+	})
+}
@@ -8,11 +8,16 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/middlewares"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/webauthn"
 )
 
 type Server struct {
-	DB     *gorm.DB
-	Router *mux.Router
+	DB           *gorm.DB
+	Router       *mux.Router
+	RelyingParty *webauthn.RelyingParty
 }
 
 func (server *Server) Initialize(DBDriver, DBUser, DBPassword, DBPort, DBHost, DBName string) {
@@ -29,6 +34,20 @@ func (server *Server) Initialize(DBDriver, DBUser, DBPassword, DBPort, DBHost, D
 		}
 	}
 
+	if err = jwt.LoadConfig(); err != nil {
+		log.Fatal("Error: ", err)
+	}
+	if err = middlewares.LoadTrustedProxies(); err != nil {
+		log.Fatal("Error: ", err)
+	}
+	jwt.SetRevocationStore(&models.TokenRevocations{DB: server.DB})
+	middlewares.SetSessionTracker(&models.SessionActivity{DB: server.DB})
+
+	server.RelyingParty, err = webauthn.LoadRelyingParty()
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+
 	server.Router = mux.NewRouter()
 
 	server.InitializeRoutes()
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+)
+
+// clientMetadata is the client metadata of RFC 7591 section 2 that the
+// service understands.
+type clientMetadata struct {
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	ClientName              string   `json:"client_name,omitempty"`
+	LogoURI                 string   `json:"logo_uri,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+}
+
+// clientInformation is the registration response of RFC 7591 section 3.2.1.
+type clientInformation struct {
+	ClientID              string `json:"client_id"`
+	ClientSecret          string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt      int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt *int64 `json:"client_secret_expires_at,omitempty"`
+	clientMetadata
+}
+
+// RegisterClient is the dynamic client registration endpoint (RFC 7591).
+// It needs an initial access token from
+// POST /v1/admin/client-registration-tokens, which is used up by a
+// successful registration.
+func (server *Server) RegisterClient(w http.ResponseWriter, r *http.Request) {
+	initialAccessToken := jwt.ExtractToken(r)
+	_, err := jwt.ParseActionToken(initialAccessToken, jwt.PurposeClientRegistration)
+	if err != nil {
+		responses.BearerError(w, http.StatusUnauthorized, "invalid_token", "invalid or expired initial access token")
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+
+	metadata := clientMetadata{}
+	err = json.Unmarshal(body, &metadata)
+	if err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+
+	client := models.OAuthClient{
+		Name:         metadata.ClientName,
+		LogoURI:      metadata.LogoURI,
+		RedirectURIs: strings.Join(metadata.RedirectURIs, " "),
+		GrantTypes:   strings.Join(metadata.GrantTypes, " "),
+		Scopes:       metadata.Scope,
+	}
+	switch metadata.TokenEndpointAuthMethod {
+	case "", "client_secret_basic", "client_secret_post":
+		client.Type = models.OAuthClientConfidential
+	case "none":
+		client.Type = models.OAuthClientPublic
+	default:
+		oauthError(w, http.StatusBadRequest, "invalid_client_metadata", "unsupported token_endpoint_auth_method")
+		return
+	}
+	for _, responseType := range metadata.ResponseTypes {
+		if responseType != "code" {
+			oauthError(w, http.StatusBadRequest, "invalid_client_metadata", "unsupported response_type "+responseType)
+			return
+		}
+	}
+	if !validScope(metadata.Scope) {
+		oauthError(w, http.StatusBadRequest, "invalid_client_metadata", "invalid scope")
+		return
+	}
+
+	client.Prepare()
+	err = client.ValidateRedirectURIs()
+	if err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_redirect_uri", err.Error())
+		return
+	}
+	err = client.Validate()
+	if err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_client_metadata", err.Error())
+		return
+	}
+
+	// the token is only used up once the request is known to be valid
+	_, err = jwt.ConsumeActionToken(initialAccessToken, jwt.PurposeClientRegistration)
+	if err != nil {
+		responses.BearerError(w, http.StatusUnauthorized, "invalid_token", "invalid or expired initial access token")
+		return
+	}
+
+	clientCreated, clientSecret, err := client.SaveOAuthClient(server.DB)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditOAuthClientRegister, "client="+clientCreated.ClientID), nil)
+
+	information := clientInformation{
+		ClientID:         clientCreated.ClientID,
+		ClientSecret:     clientSecret,
+		ClientIDIssuedAt: clientCreated.CreatedAt.Unix(),
+		clientMetadata: clientMetadata{
+			RedirectURIs:            strings.Fields(clientCreated.RedirectURIs),
+			TokenEndpointAuthMethod: "client_secret_basic",
+			GrantTypes:              strings.Fields(clientCreated.GrantTypes),
+			ResponseTypes:           metadata.ResponseTypes,
+			ClientName:              clientCreated.Name,
+			LogoURI:                 clientCreated.LogoURI,
+			Scope:                   clientCreated.Scopes,
+		},
+	}
+	if clientCreated.Public() {
+		information.TokenEndpointAuthMethod = "none"
+	} else {
+		// the secret does not expire, it is rotated by an admin
+		neverExpires := int64(0)
+		information.ClientSecretExpiresAt = &neverExpires
+		if metadata.TokenEndpointAuthMethod != "" {
+			information.TokenEndpointAuthMethod = metadata.TokenEndpointAuthMethod
+		}
+	}
+	if information.ResponseTypes == nil && clientCreated.AllowsGrant(models.GrantAuthorizationCode) {
+		information.ResponseTypes = []string{"code"}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	responses.RAW(w, http.StatusCreated, information)
+}
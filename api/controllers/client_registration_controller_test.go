@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+func register(server *Server, token, metadata string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/oauth/register", strings.NewReader(metadata))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	server.RegisterClient(w, r)
+	return w
+}
+
+func TestRegisterClient(t *testing.T) {
+	server := newTestServer(t, &models.User{}, &models.Session{}, &models.RevokedToken{}, &models.OAuthClient{}, &models.AuditEvent{})
+	jwt.SetRevocationStore(&models.TokenRevocations{DB: server.DB})
+	t.Cleanup(func() { jwt.SetRevocationStore(nil) })
+
+	admin := models.User{Name: "Admin", Email: "admin@example.com", Password: "password"}
+	err := server.DB.Create(&admin).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicID, err := crypto.Encrypt(fmt.Sprint(admin.ID), testAppKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.CreateActionToken(jwt.PurposeClientRegistration, publicID, "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := register(server, "", `{"client_name":"orders"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("without an initial access token: %d, want 401", w.Code)
+	}
+
+	// invalid metadata does not use the token up
+	w := register(server, token, `{"client_name":"orders","redirect_uris":["https://orders.example.com/callback"],"response_types":["token"]}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_client_metadata") {
+		t.Errorf("unsupported response type: %d %s", w.Code, w.Body)
+	}
+	w = register(server, token, `{"client_name":"orders","redirect_uris":["/callback"]}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_redirect_uri") {
+		t.Errorf("relative redirect URI: %d %s", w.Code, w.Body)
+	}
+
+	w = register(server, token, `{"client_name":"orders","redirect_uris":["https://orders.example.com/callback"],"scope":"openid orders:read"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("registering: %d %s", w.Code, w.Body)
+	}
+	information := clientInformation{}
+	err = json.NewDecoder(w.Body).Decode(&information)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if information.ClientSecret == "" || information.TokenEndpointAuthMethod != "client_secret_basic" || len(information.ResponseTypes) != 1 {
+		t.Errorf("client information: %+v", information)
+	}
+	client, err := (&models.OAuthClient{}).Authenticate(server.DB, information.ClientID, information.ClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Scopes != "openid orders:read" || client.RedirectURIs != "https://orders.example.com/callback" {
+		t.Errorf("registered client: %+v", client)
+	}
+
+	// the initial access token registers a single client
+	if w := register(server, token, `{"client_name":"again","token_endpoint_auth_method":"none","grant_types":["urn:ietf:params:oauth:grant-type:device_code"]}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("reusing the initial access token: %d, want 401", w.Code)
+	}
+}
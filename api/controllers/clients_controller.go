@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+// ClientSecretGracePeriodInHour is how long the previous secret of a client
+// keeps working after a rotation, unless the request says otherwise.
+const ClientSecretGracePeriodInHour = 24
+
+// ClientRegistrationTokenExpiryInHour is how long an initial access token
+// for dynamic client registration can be used.
+const ClientRegistrationTokenExpiryInHour = 24
+
+type oauthClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Type         string    `json:"type"`
+	Name         string    `json:"name"`
+	LogoURI      string    `json:"logo_uri,omitempty"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func newOAuthClientResponse(client *models.OAuthClient) oauthClientResponse {
+	return oauthClientResponse{
+		ClientID:     client.ClientID,
+		Type:         client.Type,
+		Name:         client.Name,
+		LogoURI:      client.LogoURI,
+		RedirectURIs: strings.Fields(client.RedirectURIs),
+		GrantTypes:   strings.Fields(client.GrantTypes),
+		Scopes:       strings.Fields(client.Scopes),
+		CreatedAt:    client.CreatedAt,
+		UpdatedAt:    client.UpdatedAt,
+	}
+}
+
+// oauthClientRequest is the body of the create and update endpoints.
+type oauthClientRequest struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	LogoURI      string   `json:"logo_uri"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+}
+
+func readOAuthClientRequest(r *http.Request) (models.OAuthClient, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return models.OAuthClient{}, err
+	}
+
+	request := oauthClientRequest{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		return models.OAuthClient{}, err
+	}
+
+	for _, scope := range request.Scopes {
+		if scope == "" || strings.Contains(scope, " ") || !validScope(scope) {
+			return models.OAuthClient{}, errors.New("invalid scope " + scope)
+		}
+	}
+
+	return models.OAuthClient{
+		Name:         request.Name,
+		Type:         request.Type,
+		LogoURI:      request.LogoURI,
+		RedirectURIs: strings.Join(request.RedirectURIs, " "),
+		GrantTypes:   strings.Join(request.GrantTypes, " "),
+		Scopes:       strings.Join(request.Scopes, " "),
+	}, nil
+}
+
+func (server *Server) ListOAuthClients(w http.ResponseWriter, r *http.Request) {
+	client := models.OAuthClient{}
+	clients, err := client.FindAllOAuthClients(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	found := []oauthClientResponse{}
+	for i := range *clients {
+		found = append(found, newOAuthClientResponse(&(*clients)[i]))
+	}
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), found)
+}
+
+func (server *Server) ShowOAuthClient(w http.ResponseWriter, r *http.Request) {
+	client := models.OAuthClient{}
+	found, err := client.FindOAuthClientByClientID(server.DB, mux.Vars(r)["client_id"])
+	if err == models.ErrInvalidClient {
+		responses.ERROR(w, http.StatusNotFound, models.ErrOAuthClientNotFound)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), newOAuthClientResponse(found))
+}
+
+// CreateOAuthClient registers a client. The generated client secret is only
+// returned here; public clients get none.
+func (server *Server) CreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	client, err := readOAuthClientRequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	client.Prepare()
+	err = client.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	clientCreated, clientSecret, err := client.SaveOAuthClient(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminClientCreate, "client="+clientCreated.ClientID), nil)
+
+	created := newOAuthClientResponse(clientCreated)
+	created.ClientSecret = clientSecret
+	w.Header().Set("Cache-Control", "no-store")
+	responses.JSON(w, http.StatusCreated, true, http.StatusText(http.StatusCreated), created)
+}
+
+// UpdateOAuthClient replaces the metadata of a client. Its type cannot be
+// changed, since that would add or drop its secret.
+func (server *Server) UpdateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	client := models.OAuthClient{}
+	found, err := client.FindOAuthClientByClientID(server.DB, mux.Vars(r)["client_id"])
+	if err == models.ErrInvalidClient {
+		responses.ERROR(w, http.StatusNotFound, models.ErrOAuthClientNotFound)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	update, err := readOAuthClientRequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if update.Type != "" && strings.ToLower(strings.TrimSpace(update.Type)) != found.Type {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("the type of a client cannot be changed"))
+		return
+	}
+
+	update.Type = found.Type
+	update.Prepare()
+	err = update.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	updated, err := update.UpdateOAuthClient(server.DB, found.ClientID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminClientUpdate, "client="+updated.ClientID), nil)
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), newOAuthClientResponse(updated))
+}
+
+// RotateOAuthClientSecret issues a new secret for a confidential client and
+// returns it once. The previous secret keeps working for grace_period
+// (e.g. "1h", default 24 hours); "0s" stops it at once.
+func (server *Server) RotateOAuthClientSecret(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		GracePeriod *string `json:"grace_period"`
+	}{}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	gracePeriod := time.Hour * ClientSecretGracePeriodInHour
+	if request.GracePeriod != nil {
+		gracePeriod, err = time.ParseDuration(*request.GracePeriod)
+		if err != nil || gracePeriod < 0 {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("invalid grace_period"))
+			return
+		}
+	}
+
+	client := models.OAuthClient{}
+	clientSecret, err := client.RotateOAuthClientSecret(server.DB, mux.Vars(r)["client_id"], gracePeriod)
+	if err == models.ErrOAuthClientNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err == models.ErrPublicClient {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminClientRotate, "client="+mux.Vars(r)["client_id"]), nil)
+
+	rotated := struct {
+		ClientID                string     `json:"client_id"`
+		ClientSecret            string     `json:"client_secret"`
+		PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	}{
+		ClientID:     mux.Vars(r)["client_id"],
+		ClientSecret: clientSecret,
+	}
+	if gracePeriod > 0 {
+		expiresAt := time.Now().Add(gracePeriod)
+		rotated.PreviousSecretExpiresAt = &expiresAt
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	responses.JSON(w, http.StatusOK, true, "client secret rotated", rotated)
+}
+
+// DeleteOAuthClient removes a client. Refresh tokens issued to it are
+// revoked; its access tokens stop passing introspection.
+func (server *Server) DeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	client := models.OAuthClient{}
+	err := client.DeleteOAuthClient(server.DB, mux.Vars(r)["client_id"])
+	if err == models.ErrOAuthClientNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminClientDelete, "client="+mux.Vars(r)["client_id"]), nil)
+
+	responses.JSON(w, http.StatusOK, true, "client deleted", nil)
+}
+
+// CreateClientRegistrationToken issues an initial access token for
+// POST /oauth/register. It registers a single client and is revoked with
+// the tokens of the admin who issued it.
+func (server *Server) CreateClientRegistrationToken(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	publicID, err := crypto.Encrypt(strconv.Itoa(int(tokenID)), os.Getenv("APP_KEY"))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	lifetime := time.Hour * ClientRegistrationTokenExpiryInHour
+	token, err := jwt.CreateActionToken(jwt.PurposeClientRegistration, publicID, "", lifetime)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminClientIssueToken, ""), nil)
+
+	w.Header().Set("Cache-Control", "no-store")
+	responses.JSON(w, http.StatusCreated, true, http.StatusText(http.StatusCreated), struct {
+		InitialAccessToken string `json:"initial_access_token"`
+		ExpiresIn          int    `json:"expires_in"`
+	}{
+		InitialAccessToken: token,
+		ExpiresIn:          int(lifetime.Seconds()),
+	})
+}
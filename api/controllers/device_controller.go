@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/middlewares"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+)
+
+// deviceAuthorization is the response body of RFC 8628 section 3.2.
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceAuthorization is the device authorization endpoint. A device
+// without a browser, e.g. a CLI, gets a user code to show and a device code
+// to poll the token endpoint with.
+func (server *Server) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+		return
+	}
+
+	client, err := server.authenticateTokenClient(r)
+	if err == models.ErrInvalidClient {
+		if _, _, ok := r.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+		oauthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	if !client.AllowsGrant(models.GrantDeviceCode) {
+		oauthError(w, http.StatusBadRequest, "unauthorized_client", "the client may not use the device flow")
+		return
+	}
+
+	scope := models.JoinScopes(r.PostFormValue("scope"))
+	if !validScope(scope) || !models.ScopeCovers(client.Scopes, scope) {
+		oauthError(w, http.StatusBadRequest, "invalid_scope", "invalid scope")
+		return
+	}
+	if openIDUnavailable(scope) {
+		oauthError(w, http.StatusBadRequest, "invalid_scope", jwt.ErrNoIDTokenKey.Error())
+		return
+	}
+
+	deviceCode := models.OAuthDeviceCode{ClientID: client.ID, Scope: scope}
+	code, userCode, err := deviceCode.SaveOAuthDeviceCode(server.DB)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	verificationURI := baseURL() + "/oauth/device"
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	responses.RAW(w, http.StatusOK, deviceAuthorization{
+		DeviceCode:              code,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {userCode}}.Encode(),
+		ExpiresIn:               models.DeviceCodeExpiryInMinute * 60,
+		Interval:                models.DeviceCodePollIntervalInSecond,
+	})
+}
+
+// VerifyDevice is the page where the user enters the code shown on a
+// device and, once signed in, approves or denies it.
+func (server *Server) VerifyDevice(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		renderOAuthPage(w, http.StatusBadRequest, oauthPage{Step: oauthStepError, Error: "invalid request"})
+		return
+	}
+
+	userCode := models.FormatUserCode(r.FormValue("user_code"))
+	page := oauthPage{Action: r.URL.Path}
+	if userCode != "" {
+		page.Hidden = []hiddenField{{"user_code", userCode}}
+	}
+
+	user, session, ok := server.browserSession(r)
+	if !ok {
+		user, session, ok = server.browserSignIn(w, r, page)
+		if !ok {
+			return
+		}
+	}
+
+	if userCode == "" {
+		renderOAuthPage(w, http.StatusOK, oauthPage{Step: oauthStepDevice, Action: r.URL.Path})
+		return
+	}
+
+	deviceCode := models.OAuthDeviceCode{}
+	found, err := deviceCode.FindPendingOAuthDeviceCode(server.DB, userCode)
+	if err == models.ErrInvalidUserCode {
+		renderOAuthPage(w, http.StatusUnprocessableEntity, oauthPage{Step: oauthStepDevice, Action: r.URL.Path, UserCode: userCode, Error: err.Error()})
+		return
+	}
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+		return
+	}
+
+	client := models.OAuthClient{}
+	foundClient, err := client.FindOAuthClientByID(server.DB, found.ClientID)
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+		return
+	}
+
+	page.ClientName = foundClient.Name
+	page.LogoURI = foundClient.LogoURI
+	page.UserCode = userCode
+	page.Scopes = strings.Fields(found.Scope)
+
+	// the user code is what the consent form is bound to
+	if r.Method != http.MethodPost || r.PostFormValue("step") != oauthStepConsent {
+		server.renderConsent(w, user, session, found.UserCodeHash, page, "")
+		return
+	}
+
+	consentToken, err := jwt.ConsumeActionToken(r.PostFormValue("consent_token"), jwt.PurposeOAuthConsent)
+	if err != nil || consentToken.UserID != user.ID || consentToken.SessionID != session.PublicID || consentToken.Subject != found.UserCodeHash {
+		server.renderConsent(w, user, session, found.UserCodeHash, page, "request expired, please try again")
+		return
+	}
+
+	if r.PostFormValue("decision") != "allow" {
+		err = found.DenyOAuthDeviceCode(server.DB)
+		if err != nil && err != models.ErrInvalidUserCode {
+			renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+			return
+		}
+		renderOAuthPage(w, http.StatusOK, oauthPage{Step: oauthStepDone, Message: "The request was denied. You can close this window."})
+		return
+	}
+
+	err = found.ApproveOAuthDeviceCode(server.DB, user.ID, session.PublicID)
+	if err == models.ErrInvalidUserCode {
+		renderOAuthPage(w, http.StatusUnprocessableEntity, oauthPage{Step: oauthStepDevice, Action: r.URL.Path, Error: err.Error()})
+		return
+	}
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+		return
+	}
+	server.audit(r, auditSuccess(models.AuditOAuthConsent, strings.TrimSpace(foundClient.ClientID+" "+found.Scope)), user)
+
+	renderOAuthPage(w, http.StatusOK, oauthPage{Step: oauthStepDone, Message: "Your device is connected. You can return to it and close this window."})
+}
+
+// exchangeDeviceCode answers the device polling the token endpoint. Once the
+// user has approved it, the device signs in with a session of its own, so
+// it shows up and can be revoked separately from the browser.
+func (server *Server) exchangeDeviceCode(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	code := r.PostFormValue("device_code")
+	if code == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "device_code is required")
+		return
+	}
+
+	deviceCode := models.OAuthDeviceCode{}
+	found, err := deviceCode.PollOAuthDeviceCode(server.DB, code, client.ID)
+	switch err {
+	case nil:
+	case models.ErrAuthorizationPending:
+		oauthError(w, http.StatusBadRequest, "authorization_pending", err.Error())
+		return
+	case models.ErrSlowDown:
+		oauthError(w, http.StatusBadRequest, "slow_down", err.Error())
+		return
+	case models.ErrDeviceAccessDenied:
+		oauthError(w, http.StatusBadRequest, "access_denied", err.Error())
+		return
+	case models.ErrExpiredDeviceCode:
+		oauthError(w, http.StatusBadRequest, "expired_token", err.Error())
+		return
+	case models.ErrInvalidDeviceCode:
+		oauthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	default:
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	user, ok := server.activeUser(*found.UserID)
+	if !ok {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", models.ErrInvalidDeviceCode.Error())
+		return
+	}
+
+	// the browser session the request was approved in has to be active
+	session := models.Session{}
+	approvedIn, err := session.FindActiveSession(server.DB, user.ID, found.SessionID)
+	if err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", models.ErrInvalidDeviceCode.Error())
+		return
+	}
+	authTime := approvedIn.CreatedAt
+
+	deviceSession := models.Session{}
+	_, err = deviceSession.SaveSession(server.DB, user.ID, middlewares.ClientIP(r), r.UserAgent())
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	// like every client token it has no roles and is issued for the client audience
+	audience := jwt.ClientAudience()
+	token, err := server.createAccessToken(user, jwt.Grant{Audience: audience, SessionID: deviceSession.PublicID, ClientID: client.ClientID, Scope: found.Scope})
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	plainRefreshToken, err := server.createClientRefreshToken(user, client, audience, deviceSession.PublicID, found.Scope)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	idToken, err := server.createIDToken(user, client, found.Scope, "", authTime)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditLogin, loginMethodDevice), user)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	responses.RAW(w, http.StatusOK, oauthTokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(jwt.TokenLifetime(audience).Seconds()),
+		RefreshToken: plainRefreshToken,
+		Scope:        found.Scope,
+		IDToken:      idToken,
+	})
+}
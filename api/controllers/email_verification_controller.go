@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+	"github.com/norfabagas/auth-global/api/utils/smtp"
+)
+
+const EmailVerificationExpiryInHour = 24
+
+// absoluteURL builds a link to this service for emails.
+func absoluteURL(path string, query url.Values) string {
+	return baseURL() + path + "?" + query.Encode()
+}
+
+// baseURL is APP_URL, which is required at startup. Links are never built
+// from the Host header, a request could point them at another site.
+func baseURL() string {
+	return strings.TrimRight(os.Getenv("APP_URL"), "/")
+}
+
+// linkToken reads the token of an emailed link. Mail scanners and link
+// previews open links on their own, so a GET only shows a page that posts
+// the token back; the token is returned, and may be used up, on POST only.
+// message and button describe what the page confirms.
+func linkToken(w http.ResponseWriter, r *http.Request, message, button string) (string, bool) {
+	token := r.URL.Query().Get("token")
+	if r.Method != http.MethodPost {
+		if token == "" {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("required token"))
+			return "", false
+		}
+
+		query := r.URL.Query()
+		query.Del("token")
+		action := r.URL.Path
+		if len(query) > 0 {
+			action += "?" + query.Encode()
+		}
+		renderOAuthPage(w, http.StatusOK, oauthPage{
+			Step:    oauthStepConfirm,
+			Action:  action,
+			Message: message,
+			Button:  button,
+			Hidden:  []hiddenField{{"token", token}},
+		})
+		return "", false
+	}
+
+	if token == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		token = r.PostFormValue("token")
+	} else if token == "" {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return "", false
+		}
+
+		request := struct {
+			Token string `json:"token"`
+		}{}
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return "", false
+		}
+		token = request.Token
+	}
+
+	if token == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("required token"))
+		return "", false
+	}
+
+	return token, true
+}
+
+func (server *Server) sendVerificationEmail(r *http.Request, user *models.User) error {
+	publicID, err := crypto.Encrypt(strconv.Itoa(int(user.ID)), os.Getenv("APP_KEY"))
+	if err != nil {
+		return err
+	}
+
+	token, err := jwt.CreateActionToken(jwt.PurposeVerifyEmail, publicID, user.PublicID, time.Hour*EmailVerificationExpiryInHour)
+	if err != nil {
+		return err
+	}
+
+	link := absoluteURL("/v1/verify-email", url.Values{"token": {token}})
+	message := fmt.Sprintf("Hello %s,\nPlease confirm your email address by opening the link below within %d hours:\n%s\n\nIf you did not create an account, you can ignore this email.\n\nThanks", user.Email, EmailVerificationExpiryInHour, link)
+	subject := "Verify Your Email"
+
+	go smtp.Send([]string{user.Email}, []string{}, subject, message)
+
+	return nil
+}
+
+func (server *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token, ok := linkToken(w, r, "Confirm your email address", "Confirm")
+	if !ok {
+		return
+	}
+
+	verification, err := jwt.ConsumeActionToken(token, jwt.PurposeVerifyEmail)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("invalid or expired verification token"))
+		return
+	}
+
+	user := models.User{}
+	_, err = user.VerifyEmail(server.DB, verification.UserID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", verification.UserID).Take(&user).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("invalid or expired verification token"))
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, "email verified", struct {
+		PublicID        string     `json:"public_id"`
+		Email           string     `json:"email"`
+		EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	}{
+		PublicID:        user.PublicID,
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+	})
+}
+
+func (server *Server) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	user := models.User{}
+	err = json.Unmarshal(body, &user)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	user.Prepare()
+	err = user.Validate("forget")
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// the response never tells whether the address is registered
+	userFound := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("email = ?", user.Email).Take(&userFound).Error
+	if err == nil && userFound.EmailVerifiedAt == nil {
+		err = server.sendVerificationEmail(r, &userFound)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	responses.JSON(w, http.StatusOK, true, "Kindly check your email inbox/spam", struct {
+		Email string `json:"email"`
+	}{
+		Email: user.Email,
+	})
+}
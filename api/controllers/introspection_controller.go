@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+)
+
+// introspection is the RFC 7662 response body. An inactive token only
+// carries active=false.
+type introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Nbf       int64  `json:"nbf,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Aud       string `json:"aud,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+// authenticateClient accepts client credentials through HTTP Basic
+// authentication or the client_id and client_secret form parameters.
+func (server *Server) authenticateClient(r *http.Request) (*models.OAuthClient, error) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostFormValue("client_id")
+		clientSecret = r.PostFormValue("client_secret")
+	}
+
+	client := models.OAuthClient{}
+	return client.Authenticate(server.DB, clientID, clientSecret)
+}
+
+func (server *Server) Introspect(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		responses.RAW(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	_, err = server.authenticateClient(r)
+	if err == models.ErrInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="introspect"`)
+		responses.RAW(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err != nil {
+		responses.RAW(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		responses.RAW(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	var result introspection
+	if r.PostFormValue("token_type_hint") == "refresh_token" {
+		result = server.introspectRefreshToken(token)
+		if !result.Active {
+			result = server.introspectAccessToken(token)
+		}
+	} else {
+		result = server.introspectAccessToken(token)
+		if !result.Active {
+			result = server.introspectRefreshToken(token)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	responses.RAW(w, http.StatusOK, result)
+}
+
+func (server *Server) introspectAccessToken(token string) introspection {
+	info, err := jwt.ParseToken(token)
+	if err != nil {
+		return introspection{}
+	}
+	if info.UserID == 0 {
+		return server.introspectClientToken(info)
+	}
+
+	user, ok := server.activeUser(info.UserID)
+	if !ok || !server.clientGrants(info.ClientID, info.Scope) {
+		return introspection{}
+	}
+
+	return introspection{
+		Active:    true,
+		Scope:     info.Scope,
+		ClientID:  info.ClientID,
+		Username:  user.Email,
+		TokenType: "Bearer",
+		Exp:       info.ExpiresAt.Unix(),
+		Iat:       info.IssuedAt.Unix(),
+		Nbf:       info.NotBefore.Unix(),
+		Sub:       user.PublicID,
+		Aud:       info.Audience,
+		Iss:       info.Issuer,
+		Jti:       info.ID,
+	}
+}
+
+// introspectClientToken reports a client_credentials token as active while
+// the client it was issued to is still registered with its scope.
+func (server *Server) introspectClientToken(info *jwt.TokenInfo) introspection {
+	if !server.clientGrants(info.ClientID, info.Scope) {
+		return introspection{}
+	}
+
+	return introspection{
+		Active:    true,
+		Scope:     info.Scope,
+		ClientID:  info.ClientID,
+		TokenType: "Bearer",
+		Exp:       info.ExpiresAt.Unix(),
+		Iat:       info.IssuedAt.Unix(),
+		Nbf:       info.NotBefore.Unix(),
+		Sub:       info.Subject,
+		Aud:       info.Audience,
+		Iss:       info.Issuer,
+		Jti:       info.ID,
+	}
+}
+
+func (server *Server) introspectRefreshToken(token string) introspection {
+	refreshToken := models.RefreshToken{}
+	found, err := refreshToken.FindRefreshToken(server.DB, token)
+	if err != nil || found.RotatedAt != nil || found.RevokedAt != nil || time.Now().After(found.ExpiresAt) {
+		return introspection{}
+	}
+
+	user, ok := server.activeUser(found.UserID)
+	if !ok || !server.clientGrants(found.ClientID, found.Scope) {
+		return introspection{}
+	}
+
+	return introspection{
+		Active:    true,
+		Scope:     found.Scope,
+		ClientID:  found.ClientID,
+		Username:  user.Email,
+		TokenType: "refresh_token",
+		Exp:       found.ExpiresAt.Unix(),
+		Iat:       found.CreatedAt.Unix(),
+		Sub:       user.PublicID,
+		Aud:       found.Audience,
+	}
+}
+
+// clientGrants reports whether the client a token was issued to is still
+// registered and still allowed every scope of the token. Tokens of the
+// service itself carry no client.
+func (server *Server) clientGrants(clientID, scope string) bool {
+	if clientID == "" {
+		return true
+	}
+
+	client := models.OAuthClient{}
+	found, err := client.FindOAuthClientByClientID(server.DB, clientID)
+	if err != nil {
+		return false
+	}
+
+	return found.GrantsScope(scope)
+}
+
+// activeUser returns the user a token belongs to, as long as the account
+// can still be used.
+func (server *Server) activeUser(userID uint32) (*models.User, bool) {
+	user := models.User{}
+	err := server.DB.Debug().Model(models.User{}).Where("id = ?", userID).Take(&user).Error
+	if err != nil || user.CanSignIn() != nil {
+		return &models.User{}, false
+	}
+
+	return &user, true
+}
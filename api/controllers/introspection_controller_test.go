@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+const testAppKey = "0123456789abcdef0123456789abcdef"
+
+// newTestServer serves an in-memory database with the tables of models.
+func newTestServer(t *testing.T, tables ...interface{}) *Server {
+	t.Helper()
+
+	jwt.SetConfig(jwt.Config{
+		Issuer:          "auth-global",
+		Audiences:       []string{"web"},
+		DefaultAudience: "web",
+		ClientAudience:  "auth-global/oauth",
+		DefaultLifetime: 15 * time.Minute,
+		Lifetimes:       map[string]time.Duration{},
+	})
+	os.Setenv("API_SECRET", "secret")
+	os.Setenv("APP_KEY", testAppKey)
+	t.Cleanup(func() {
+		os.Unsetenv("API_SECRET")
+		os.Unsetenv("APP_KEY")
+	})
+
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	db.LogMode(false)
+	err = db.AutoMigrate(tables...).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Server{DB: db}
+}
+
+// introspect posts token to the introspection endpoint with the client
+// credentials and returns the status and the decoded body.
+func introspect(server *Server, clientID, clientSecret, token, hint string) (int, introspection) {
+	form := url.Values{"token": {token}}
+	if hint != "" {
+		form.Set("token_type_hint", hint)
+	}
+	r := httptest.NewRequest("POST", "/v1/introspect", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(clientID, clientSecret)
+	w := httptest.NewRecorder()
+	server.Introspect(w, r)
+
+	result := introspection{}
+	json.NewDecoder(w.Body).Decode(&result)
+	return w.Code, result
+}
+
+func TestIntrospect(t *testing.T) {
+	server := newTestServer(t, &models.User{}, &models.OAuthClient{}, &models.RefreshToken{})
+
+	client := models.OAuthClient{Name: "gateway", GrantTypes: models.GrantClientCredentials, Scopes: "orders:read"}
+	client.Prepare()
+	registered, secret, err := client.SaveOAuthClient(server.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com", Password: "password"}
+	err = server.DB.Create(&user).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicID, err := crypto.Encrypt(fmt.Sprint(user.ID), testAppKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, err := jwt.CreateToken(jwt.Grant{UserPublicID: publicID, Subject: user.PublicID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, err := (&models.RefreshToken{}).SaveRefreshToken(server.DB, user.ID, "web", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientToken, err := jwt.CreateClientToken(registered.ClientID, "", "orders:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, result := introspect(server, registered.ClientID, secret, accessToken, "")
+	if code != http.StatusOK || !result.Active || result.Username != user.Email || result.TokenType != "Bearer" {
+		t.Errorf("access token: %d %+v", code, result)
+	}
+	code, result = introspect(server, registered.ClientID, secret, refreshToken, "refresh_token")
+	if code != http.StatusOK || !result.Active || result.TokenType != "refresh_token" {
+		t.Errorf("refresh token: %d %+v", code, result)
+	}
+	code, result = introspect(server, registered.ClientID, secret, clientToken, "")
+	if code != http.StatusOK || !result.Active || result.ClientID != registered.ClientID || result.Scope != "orders:read" {
+		t.Errorf("client token: %d %+v", code, result)
+	}
+	code, result = introspect(server, registered.ClientID, secret, "not a token", "")
+	if code != http.StatusOK || result.Active {
+		t.Errorf("unknown token: %d %+v", code, result)
+	}
+
+	// a disabled account takes its access and refresh tokens with it
+	now := time.Now()
+	err = server.DB.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{"disabled_at": now}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, result = introspect(server, registered.ClientID, secret, accessToken, ""); result.Active {
+		t.Errorf("access token of a disabled user: %+v", result)
+	}
+	if _, result = introspect(server, registered.ClientID, secret, refreshToken, "refresh_token"); result.Active {
+		t.Errorf("refresh token of a disabled user: %+v", result)
+	}
+
+	// and a client token goes once the client loses its scope
+	update := models.OAuthClient{Name: "gateway", GrantTypes: models.GrantClientCredentials, Scopes: "orders:write"}
+	_, err = update.UpdateOAuthClient(server.DB, registered.ClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, result = introspect(server, registered.ClientID, secret, clientToken, ""); result.Active {
+		t.Errorf("client token after losing its scope: %+v", result)
+	}
+}
+
+func TestIntrospectClientAuthentication(t *testing.T) {
+	server := newTestServer(t, &models.OAuthClient{})
+
+	confidential := models.OAuthClient{Name: "gateway", GrantTypes: models.GrantClientCredentials}
+	confidential.Prepare()
+	registered, secret, err := confidential.SaveOAuthClient(server.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := models.OAuthClient{Name: "app", Type: models.OAuthClientPublic, GrantTypes: models.GrantDeviceCode}
+	public.Prepare()
+	publicClient, _, err := public.SaveOAuthClient(server.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentials := map[string][2]string{
+		"wrong secret":  {registered.ClientID, "wrong"},
+		"no secret":     {registered.ClientID, ""},
+		"unknown":       {"unknown", secret},
+		"public client": {publicClient.ClientID, ""},
+	}
+	for name, credential := range credentials {
+		form := url.Values{"token": {"token"}}
+		r := httptest.NewRequest("POST", "/v1/introspect", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth(credential[0], credential[1])
+		w := httptest.NewRecorder()
+		server.Introspect(w, r)
+
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: %d, want 401 with a challenge", name, w.Code)
+		}
+	}
+
+	if code, _ := introspect(server, registered.ClientID, secret, "", ""); code != http.StatusBadRequest {
+		t.Errorf("without a token: %d, want 400", code)
+	}
+}
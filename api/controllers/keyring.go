@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"log"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+)
+
+const DefaultSigningAlgorithm = "RS256"
+
+// InitializeKeyring loads the signing keys from the database. On first start
+// the key at privateKeyPath, if any, is imported as the active key.
+func (server *Server) InitializeKeyring(privateKeyPath string) error {
+	signingKey := models.SigningKey{}
+	stored, err := signingKey.FindAllSigningKeys(server.DB)
+	if err != nil {
+		return err
+	}
+
+	if len(*stored) == 0 && privateKeyPath != "" {
+		key, err := jwt.ReadPrivateKeyFile(privateKeyPath)
+		if err != nil {
+			return err
+		}
+		key.State = jwt.KeyStateActive
+		key.ActivatesAt = time.Now()
+
+		_, err = signingKey.SaveSigningKey(server.DB, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return server.RefreshKeyring()
+}
+
+// WatchKeyring reloads the keyring periodically so rotations made by another
+// instance, or scheduled activations, take effect without a restart.
+func (server *Server) WatchKeyring(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := server.RefreshKeyring(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// RefreshKeyring loads the stored keys, moves superseded keys to verify-only
+// and expired keys to retired, and installs the result in the jwt package.
+func (server *Server) RefreshKeyring() error {
+	signingKey := models.SigningKey{}
+	stored, err := signingKey.FindAllSigningKeys(server.DB)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	keyring := []*jwt.SigningKey{}
+	var current *jwt.SigningKey
+
+	// stored keys are ordered by activation date, newest first
+	for _, storedKey := range *stored {
+		key, err := storedKey.Decode()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case key.State != jwt.KeyStateRetired && key.RetiresAt != nil && !now.Before(*key.RetiresAt):
+			key.State = jwt.KeyStateRetired
+			err = signingKey.UpdateSigningKeyState(server.DB, key.ID, string(key.State), key.RetiresAt)
+
+		case key.State == jwt.KeyStateActive && !now.Before(key.ActivatesAt):
+			if current == nil {
+				current = key
+				break
+			}
+			key.State = jwt.KeyStateVerifyOnly
+			if key.RetiresAt == nil {
+				retiresAt := current.ActivatesAt.Add(jwt.MaxTokenLifetime() + time.Minute)
+				key.RetiresAt = &retiresAt
+			}
+			err = signingKey.UpdateSigningKeyState(server.DB, key.ID, string(key.State), key.RetiresAt)
+		}
+		if err != nil {
+			return err
+		}
+
+		keyring = append(keyring, key)
+	}
+
+	jwt.SetSigningKeys(keyring)
+	return nil
+}
+
+// RotateSigningKey generates a new key that takes over signing after
+// activationDelay. The delay lets JWKS caches learn the new key first, and
+// the previous keys keep verifying until their tokens have expired.
+func (server *Server) RotateSigningKey(algorithm string, activationDelay time.Duration) (*jwt.SigningKey, error) {
+	key, err := jwt.GenerateSigningKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	key.State = jwt.KeyStateActive
+	key.ActivatesAt = time.Now().Add(activationDelay)
+
+	signingKey := models.SigningKey{}
+	stored, err := signingKey.FindAllSigningKeys(server.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	retiresAt := key.ActivatesAt.Add(jwt.MaxTokenLifetime() + time.Minute)
+	for _, storedKey := range *stored {
+		if storedKey.State != string(jwt.KeyStateActive) || storedKey.RetiresAt != nil {
+			continue
+		}
+		err = signingKey.UpdateSigningKeyState(server.DB, storedKey.KID, storedKey.State, &retiresAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = signingKey.SaveSigningKey(server.DB, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, server.RefreshKeyring()
+}
+
+// RetireSigningKey immediately stops accepting tokens signed with kid, e.g.
+// after the key has been compromised.
+func (server *Server) RetireSigningKey(kid string) error {
+	now := time.Now()
+
+	signingKey := models.SigningKey{}
+	err := signingKey.UpdateSigningKeyState(server.DB, kid, string(jwt.KeyStateRetired), &now)
+	if err != nil {
+		return err
+	}
+
+	return server.RefreshKeyring()
+}
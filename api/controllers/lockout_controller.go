@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/middlewares"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+	"github.com/norfabagas/auth-global/api/utils/smtp"
+)
+
+const UnlockExpiryInHour = 24
+
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+}
+
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	setRetryAfter(w, retryAfter)
+	responses.ERROR(w, http.StatusTooManyRequests, errors.New("too many requests, please try again later"))
+}
+
+func accountLocked(w http.ResponseWriter, retryAfter time.Duration) {
+	setRetryAfter(w, retryAfter)
+	responses.ERROR(w, http.StatusLocked, models.ErrAccountLocked)
+}
+
+// loginThrottled answers the request when the caller's IP address or the
+// account has to wait before the next password or code is checked.
+func (server *Server) loginThrottled(w http.ResponseWriter, r *http.Request, email string) bool {
+	retryAfter, locked, err := server.loginRetryAfter(r, email)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return true
+	}
+	if locked {
+		accountLocked(w, retryAfter)
+		return true
+	}
+	if retryAfter > 0 {
+		tooManyRequests(w, retryAfter)
+		return true
+	}
+
+	return false
+}
+
+// loginRetryAfter returns how long the caller's IP address or the account
+// has to wait before the next password or code is checked, and whether the
+// account is locked.
+func (server *Server) loginRetryAfter(r *http.Request, email string) (time.Duration, bool, error) {
+	policy := models.LoginLockoutPolicy()
+
+	loginFailure := models.LoginFailure{}
+	retryAfter, err := loginFailure.IPRetryAfter(server.DB, middlewares.ClientIP(r), policy)
+	if err != nil || retryAfter > 0 {
+		return retryAfter, false, err
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("email = ?", email).Take(&user).Error
+	if err != nil {
+		return 0, false, nil
+	}
+	if lockedFor := user.LockedFor(); lockedFor > 0 {
+		return lockedFor, true, nil
+	}
+
+	return user.RetryAfter(policy), false, nil
+}
+
+// respondLoginFailure counts a wrong password or code against the IP address
+// and the account, and locks the account once the threshold is reached.
+func (server *Server) respondLoginFailure(w http.ResponseWriter, r *http.Request, email, method string, status int, failure error) {
+	locked, err := server.recordLoginFailure(r, email, method, failure)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if locked {
+		accountLocked(w, models.LoginLockoutPolicy().Duration)
+		return
+	}
+
+	responses.ERROR(w, status, failure)
+}
+
+// recordLoginFailure counts and audits a wrong password or code, and reports
+// whether it locked the account, in which case the unlock email is sent.
+func (server *Server) recordLoginFailure(r *http.Request, email, method string, failure error) (bool, error) {
+	policy := models.LoginLockoutPolicy()
+
+	loginFailure := models.LoginFailure{}
+	err := loginFailure.SaveLoginFailure(server.DB, email, middlewares.ClientIP(r))
+	if err != nil {
+		return false, err
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("email = ?", email).Take(&user).Error
+	if err != nil {
+		server.auditLoginFailure(r, email, method, failure)
+		return false, nil
+	}
+
+	locked, err := user.RecordLoginFailure(server.DB, user.ID, policy)
+	if err != nil {
+		return false, err
+	}
+	if !locked {
+		server.audit(r, auditFailure(models.AuditLogin, method, failure), &user)
+		return false, nil
+	}
+
+	server.audit(r, auditFailure(models.AuditLogin, method, models.ErrAccountLocked), &user)
+
+	return true, server.sendUnlockEmail(r, &user, policy)
+}
+
+// resetLoginFailures forgets the failed attempts after a successful sign in.
+func (server *Server) resetLoginFailures(user *models.User) error {
+	if user.FailedLoginCount == 0 && user.LockedUntil == nil {
+		return nil
+	}
+
+	return user.UnlockUser(server.DB, user.ID)
+}
+
+func (server *Server) sendUnlockEmail(r *http.Request, user *models.User, policy models.LockoutPolicy) error {
+	publicID, err := crypto.Encrypt(strconv.Itoa(int(user.ID)), os.Getenv("APP_KEY"))
+	if err != nil {
+		return err
+	}
+
+	token, err := jwt.CreateActionToken(jwt.PurposeUnlock, publicID, user.PublicID, time.Hour*UnlockExpiryInHour)
+	if err != nil {
+		return err
+	}
+
+	link := absoluteURL("/v1/unlock-account", url.Values{"token": {token}})
+	message := fmt.Sprintf("Hello %s,\nYour account was locked for %s after too many failed sign in attempts. If this was you, you can unlock it right away with the link below within %d hours:\n%s\n\nIf this was not you, consider changing your password.\n\nThanks", user.Email, policy.Duration, UnlockExpiryInHour, link)
+	subject := "Your Account Has Been Locked"
+
+	go smtp.Send([]string{user.Email}, []string{}, subject, message)
+
+	return nil
+}
+
+func (server *Server) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	token, ok := linkToken(w, r, "Unlock your account", "Unlock")
+	if !ok {
+		return
+	}
+
+	unlock, err := jwt.ConsumeActionToken(token, jwt.PurposeUnlock)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("invalid or expired unlock token"))
+		return
+	}
+
+	user := models.User{}
+	err = user.UnlockUser(server.DB, unlock.UserID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, "account unlocked", nil)
+}
@@ -2,20 +2,21 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"strconv"
 	"time"
 
+	"github.com/jinzhu/gorm"
 	"github.com/norfabagas/auth-global/api/jwt"
 	"github.com/norfabagas/auth-global/api/models"
 	"github.com/norfabagas/auth-global/api/responses"
 	"github.com/norfabagas/auth-global/api/utils/crypto"
-	"github.com/norfabagas/auth-global/api/utils/formatting"
 	"github.com/norfabagas/auth-global/api/utils/smtp"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func (server *Server) Login(w http.ResponseWriter, r *http.Request) {
@@ -39,41 +40,155 @@ func (server *Server) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := server.signIn(user.Email, user.Password)
+	if server.loginThrottled(w, r, user.Email) {
+		return
+	}
+
+	signedIn, err := server.signIn(user.Email, user.Password)
+	if err == models.ErrInvalidCredentials {
+		server.respondLoginFailure(w, r, user.Email, loginMethodPassword, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err == models.ErrUserDisabled || err == models.ErrPasswordResetRequired {
+		server.auditLoginFailure(r, user.Email, loginMethodPassword, err)
+		responses.ERROR(w, http.StatusForbidden, err)
+		return
+	}
 	if err != nil {
+		server.auditLoginFailure(r, user.Email, loginMethodPassword, err)
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = server.DB.Debug().Model(models.User{}).Where("email = ?", user.Email).Take(&user).Error
+	audience, err := jwt.Audience(r.URL.Query().Get("audience"))
 	if err != nil {
-		formattedError := formatting.FormatError(err.Error())
-		responses.ERROR(w, http.StatusUnprocessableEntity, formattedError)
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
+	// the failures are only forgotten once the second factor is passed too
+	if signedIn.TOTPEnabled() {
+		server.respondMFAChallenge(w, signedIn)
+		return
+	}
+
+	err = server.resetLoginFailures(signedIn)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.respondSignIn(w, r, signedIn, audience, loginMethodPassword)
+}
+
+// respondSignIn issues a new session for user, the final step of every way
+// of signing in, and records the sign in with its method.
+func (server *Server) respondSignIn(w http.ResponseWriter, r *http.Request, user *models.User, audience, method string) {
+	tokens, err := server.createTokens(r, user, audience)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditLogin, method), user)
+
 	// decrypt name
-	user.Name, err = crypto.Decrypt(user.Name, os.Getenv("APP_KEY"))
+	name, err := crypto.Decrypt(user.Name, os.Getenv("APP_KEY"))
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), struct {
-		Token string `json:"token"`
-		Email string `json:"email"`
-		Name  string `json:"name"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Email        string `json:"email"`
+		Name         string `json:"name"`
 	}{
-		Token: token,
-		Email: user.Email,
-		Name:  user.Name,
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		Email:        user.Email,
+		Name:         name,
 	})
 }
 
+func (server *Server) Logout(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// the refresh token is optional, but without it the session can be renewed
+	request := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	info, err := jwt.ExtractTokenInfo(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	tokenID := info.UserID
+
+	err = jwt.RevokeToken(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if info.SessionID != "" {
+		session := models.Session{}
+		err = session.RevokeSession(server.DB, tokenID, info.SessionID)
+		if err != nil && err != models.ErrSessionNotFound {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if request.RefreshToken != "" {
+		refreshToken := models.RefreshToken{}
+		found, err := refreshToken.FindRefreshToken(server.DB, request.RefreshToken)
+		if err == nil && found.UserID == tokenID {
+			err = refreshToken.RevokeRefreshTokenFamily(server.DB, found.FamilyID)
+		}
+		if err != nil && err != models.ErrInvalidRefreshToken {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	responses.JSON(w, http.StatusOK, true, "logged out", nil)
+}
+
+func (server *Server) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	err = server.revokeUserSessions(tokenID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, "logged out from all devices", nil)
+}
+
 func (server *Server) ForgetPassword(w http.ResponseWriter, r *http.Request) {
 	requestTime := time.Now()
 
-	keys := r.URL.Query()
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
@@ -94,82 +209,189 @@ func (server *Server) ForgetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userFound, err := user.FindUserByEmail(server.DB, user.Email)
+	// the response never tells whether the address is registered
+	userFound := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("email = ?", user.Email).Take(&userFound).Error
+	if err == nil && userFound.DisabledAt == nil {
+		err = server.sendPasswordResetEmail(r, &userFound)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	responses.JSON(w, http.StatusOK, true, "Kindly check your email inbox/spam", struct {
+		Email       string    `json:"email"`
+		RequestTime time.Time `json:"request_time"`
+	}{
+		Email:       user.Email,
+		RequestTime: requestTime,
+	})
+}
+
+func (server *Server) sendPasswordResetEmail(r *http.Request, user *models.User) error {
+	passwordReset := models.PasswordReset{}
+	token, err := passwordReset.SavePasswordReset(server.DB, user.ID)
 	if err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		return err
+	}
+
+	// PASSWORD_RESET_URL points at the page where the new password is entered
+	link := os.Getenv("PASSWORD_RESET_URL")
+	if link == "" {
+		link = absoluteURL("/v1/reset-password", url.Values{"token": {token}})
+	} else {
+		link += "?" + url.Values{"token": {token}}.Encode()
+	}
+
+	message := fmt.Sprintf("Hello %s,\nWe received a request to reset your password. Please use the link below within %d minutes:\n%s\n\nIf you did not request this, you can ignore this email.\n\nThanks", user.Email, models.PasswordResetExpiryInMinute, link)
+	subject := "Reset Password"
+
+	go smtp.Send([]string{user.Email}, []string{}, subject, message)
+
+	return nil
+}
+
+func (server *Server) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	if userFound.ID == 0 {
-		responses.ERROR(w, http.StatusNotFound, formatting.FormatError("notFound"))
+	request := struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.Token == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("required token"))
 		return
 	}
 
-	generatedPassword := crypto.MD5Hash(time.Now().String())
+	user := models.User{Password: request.Password}
+	user.Prepare()
+	err = user.Validate("password")
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
 
-	changedUser, err := user.ChangePassword(server.DB, userFound.ID, generatedPassword)
+	passwordReset := models.PasswordReset{}
+	found, err := passwordReset.FindPasswordReset(server.DB, request.Token)
+	if err == models.ErrInvalidPasswordReset {
+		server.audit(r, auditFailure(models.AuditPasswordReset, "", err), nil)
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	notifyEmail := keys.Get("notify")
-	if notifyEmail != "" && notifyEmail == "true" {
-		message := fmt.Sprintf("Hello %s,\nWe would like to inform your newly generated password. Please use below:\n%s\n\nThanks", changedUser.Email, generatedPassword)
-		subject := "Change Password"
+	// a rejected password leaves the token usable for another try
+	account := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", found.UserID).Take(&account).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, models.ErrInvalidPasswordReset)
+		return
+	}
+	err = account.ValidatePassword(user.Password)
+	if err != nil {
+		respondValidationError(w, err)
+		return
+	}
+	passwordHistory := models.PasswordHistory{}
+	err = passwordHistory.CheckPasswordHistory(server.DB, account.ID, user.Password)
+	if err == models.ErrPasswordReused {
+		respondValidationError(w, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
 
-		go smtp.Send([]string{changedUser.Email}, []string{}, subject, message)
+	consumed, err := passwordReset.ConsumePasswordReset(server.DB, request.Token)
+	if err == models.ErrInvalidPasswordReset {
+		server.audit(r, auditFailure(models.AuditPasswordReset, "", err), nil)
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
 
-		if err != nil {
-			responses.ERROR(w, http.StatusInternalServerError, err)
-			return
-		}
+	changedUser, err := user.ChangePassword(server.DB, consumed.UserID, user.Password)
+	if err == models.ErrPasswordReused {
+		respondValidationError(w, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
 	}
 
-	// if display newly generated password
-	visible := keys.Get("visible")
-	if visible != "" && visible == "true" {
-		responses.JSON(w, http.StatusOK, true, "new password generated", struct {
-			Email             string    `json:"email"`
-			GeneratedPassword string    `json:"generated_password"`
-			RequestTime       time.Time `json:"request_time"`
-		}{
-			Email:             changedUser.Email,
-			GeneratedPassword: generatedPassword,
-			RequestTime:       requestTime,
-		})
-	} else {
-		responses.JSON(w, http.StatusOK, true, "Kindly check your email inbox/spam", struct {
-			Email       string    `json:"email"`
-			RequestTime time.Time `json:"request_time"`
-		}{
-			Email:       changedUser.Email,
-			RequestTime: requestTime,
-		})
+	err = server.revokeUserSessions(changedUser.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
 	}
 
+	server.audit(r, auditSuccess(models.AuditPasswordReset, ""), changedUser)
+
+	subject := "Your Password Has Been Reset"
+	message := "Your password was reset and you have been signed out of all devices.\nIf this action is not from you, please contact us."
+	go smtp.Send([]string{changedUser.Email}, []string{}, subject, message)
+
+	responses.JSON(w, http.StatusOK, true, "password has been reset", struct {
+		PublicID        string    `json:"public_id"`
+		Email           string    `json:"email"`
+		PasswordResetAt time.Time `json:"password_reset_at"`
+	}{
+		PublicID:        changedUser.PublicID,
+		Email:           changedUser.Email,
+		PasswordResetAt: changedUser.UpdatedAt,
+	})
 }
 
-func (server *Server) signIn(email, password string) (string, error) {
+// dummyPasswordHash is compared against when the email is unknown, so the
+// response time does not reveal which addresses are registered.
+var dummyPasswordHash, _ = models.Hash("dummy password")
+
+func (server *Server) signIn(email, password string) (*models.User, error) {
 	var err error
 
 	user := models.User{}
 	err = server.DB.Debug().Model(models.User{}).Where("email = ?", email).Take(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		models.VerifyPassword(string(dummyPasswordHash), password)
+		return &models.User{}, models.ErrInvalidCredentials
+	}
 	if err != nil {
-		return "", err
+		return &models.User{}, err
 	}
 	err = models.VerifyPassword(user.Password, password)
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
-		return "", formatting.FormatError(err.Error())
+	if err != nil {
+		return &models.User{}, models.ErrInvalidCredentials
 	}
 
-	fmt.Println(user)
-
-	stringID := strconv.Itoa(int(user.ID))
+	// upgrade hashes from an older algorithm or cost while the password is
+	// at hand; the sign in goes ahead if this fails
+	_, err = user.RehashPassword(server.DB, user.ID, password)
+	if err != nil {
+		log.Printf("rehash password of user %d: %v", user.ID, err)
+	}
 
-	publicID, err := crypto.Encrypt(stringID, os.Getenv("APP_KEY"))
+	err = user.CanSignIn()
 	if err != nil {
-		return "", err
+		return &models.User{}, err
 	}
-	return jwt.CreateToken(publicID)
+
+	return &user, nil
 }
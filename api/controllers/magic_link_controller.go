@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+	"github.com/norfabagas/auth-global/api/utils/smtp"
+)
+
+const MagicLinkExpiryInMinute = 15
+
+func (server *Server) SendMagicLink(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	user := models.User{}
+	err = json.Unmarshal(body, &user)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	user.Prepare()
+	err = user.Validate("forget")
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// the response never tells whether the address is registered; opening
+	// the link proves the address, so unverified users may use it
+	userFound := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("email = ?", user.Email).Take(&userFound).Error
+	if err == nil {
+		err = userFound.CanSignIn()
+		if err == nil || err == models.ErrEmailNotVerified {
+			err = server.sendMagicLinkEmail(r, &userFound)
+			if err != nil {
+				responses.ERROR(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+	}
+
+	responses.JSON(w, http.StatusOK, true, "Kindly check your email inbox/spam", struct {
+		Email string `json:"email"`
+	}{
+		Email: user.Email,
+	})
+}
+
+func (server *Server) sendMagicLinkEmail(r *http.Request, user *models.User) error {
+	publicID, err := crypto.Encrypt(strconv.Itoa(int(user.ID)), os.Getenv("APP_KEY"))
+	if err != nil {
+		return err
+	}
+
+	token, err := jwt.CreateActionToken(jwt.PurposeMagicLink, publicID, user.PublicID, time.Minute*MagicLinkExpiryInMinute)
+	if err != nil {
+		return err
+	}
+
+	// MAGIC_LINK_URL points at the page that exchanges the token for a session
+	link := os.Getenv("MAGIC_LINK_URL")
+	if link == "" {
+		link = absoluteURL("/v1/login/magic-link/verify", url.Values{"token": {token}})
+	} else {
+		link += "?" + url.Values{"token": {token}}.Encode()
+	}
+
+	message := fmt.Sprintf("Hello %s,\nUse the link below within %d minutes to sign in. It can only be used once:\n%s\n\nIf you did not request this, you can ignore this email.\n\nThanks", user.Email, MagicLinkExpiryInMinute, link)
+	subject := "Your Sign In Link"
+
+	go smtp.Send([]string{user.Email}, []string{}, subject, message)
+
+	return nil
+}
+
+func (server *Server) VerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	token, ok := linkToken(w, r, "Sign in to your account", "Sign in")
+	if !ok {
+		return
+	}
+
+	audience, err := jwt.Audience(r.URL.Query().Get("audience"))
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	magicLink, err := jwt.ConsumeActionToken(token, jwt.PurposeMagicLink)
+	if err != nil {
+		err = errors.New("invalid or expired sign in link")
+		server.audit(r, auditFailure(models.AuditLogin, loginMethodMagicLink, err), nil)
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	user := models.User{}
+	_, err = user.VerifyEmail(server.DB, magicLink.UserID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", magicLink.UserID).Take(&user).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("invalid or expired sign in link"))
+		return
+	}
+
+	err = user.CanSignIn()
+	if err != nil {
+		server.audit(r, auditFailure(models.AuditLogin, loginMethodMagicLink, err), &user)
+	}
+	if err == models.ErrUserDisabled || err == models.ErrPasswordResetRequired {
+		responses.ERROR(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if user.TOTPEnabled() {
+		server.respondMFAChallenge(w, &user)
+		return
+	}
+
+	server.respondSignIn(w, r, &user, audience, loginMethodMagicLink)
+}
@@ -0,0 +1,382 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+	"github.com/norfabagas/auth-global/api/utils/totp"
+	"github.com/skip2/go-qrcode"
+)
+
+const MFAChallengeExpiryInMinute = 5
+
+type mfaRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	Password     string `json:"password"`
+}
+
+func readMFARequest(r *http.Request) (mfaRequest, error) {
+	request := mfaRequest{}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return request, err
+	}
+	err = json.Unmarshal(body, &request)
+
+	return request, err
+}
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+
+	return "auth-global"
+}
+
+// respondMFAChallenge answers a correct password for an account with two
+// factors enabled. The challenge token is exchanged at /v1/login/mfa.
+func (server *Server) respondMFAChallenge(w http.ResponseWriter, user *models.User) {
+	publicID, err := crypto.Encrypt(strconv.Itoa(int(user.ID)), os.Getenv("APP_KEY"))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	token, err := jwt.CreateActionToken(jwt.PurposeMFA, publicID, user.PublicID, time.Minute*MFAChallengeExpiryInMinute)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, "two-factor authentication required", struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   MFAChallengeExpiryInMinute * 60,
+	})
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (server *Server) verifySecondFactor(user *models.User, request mfaRequest) error {
+	if request.RecoveryCode != "" {
+		recoveryCode := models.RecoveryCode{}
+		used, err := recoveryCode.UseRecoveryCode(server.DB, user.ID, request.RecoveryCode)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return models.ErrInvalidTOTPCode
+		}
+
+		return nil
+	}
+	if request.Code == "" {
+		return errors.New("required code or recovery_code")
+	}
+
+	return user.VerifyTOTP(server.DB, request.Code)
+}
+
+func (server *Server) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	request, err := readMFARequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.MFAToken == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("required mfa_token"))
+		return
+	}
+
+	audience, err := jwt.Audience(r.URL.Query().Get("audience"))
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	challenge, err := jwt.ParseActionToken(request.MFAToken, jwt.PurposeMFA)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("invalid or expired mfa_token"))
+		return
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", challenge.UserID).Take(&user).Error
+	if err == nil {
+		err = user.CanSignIn()
+	}
+	if err != nil || !user.TOTPEnabled() {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("invalid or expired mfa_token"))
+		return
+	}
+
+	if server.loginThrottled(w, r, user.Email) {
+		return
+	}
+
+	method := loginMethodTOTP
+	if request.RecoveryCode != "" {
+		method = loginMethodRecoveryCode
+	}
+
+	err = server.verifySecondFactor(&user, request)
+	if err == models.ErrInvalidTOTPCode {
+		server.respondLoginFailure(w, r, user.Email, method, http.StatusUnauthorized, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = server.resetLoginFailures(&user)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the challenge is only good for one session
+	_, err = jwt.ConsumeActionToken(request.MFAToken, jwt.PurposeMFA)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("invalid or expired mfa_token"))
+		return
+	}
+
+	server.respondSignIn(w, r, &user, audience, method)
+}
+
+func (server *Server) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", tokenID).Take(&user).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if user.TOTPEnabled() {
+		responses.ERROR(w, http.StatusConflict, models.ErrTOTPAlreadyEnabled)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = user.EnrollTOTP(server.DB, user.ID, secret)
+	if err == models.ErrTOTPAlreadyEnabled {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	uri := totp.URI(totpIssuer(), user.Email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, "scan the QR code and confirm with a code", struct {
+		Secret string `json:"secret"`
+		URI    string `json:"otpauth_uri"`
+		QRCode string `json:"qr_code"`
+	}{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+func (server *Server) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	request, err := readMFARequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.Code == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("required code"))
+		return
+	}
+
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", tokenID).Take(&user).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if user.TOTPEnabled() {
+		responses.ERROR(w, http.StatusConflict, models.ErrTOTPAlreadyEnabled)
+		return
+	}
+
+	err = user.VerifyTOTP(server.DB, request.Code)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = user.EnableTOTP(server.DB, user.ID)
+	if err == models.ErrTOTPAlreadyEnabled {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.respondRecoveryCodes(w, user.ID, "two-factor authentication enabled")
+}
+
+func (server *Server) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	request, err := readMFARequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.Password == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("required password"))
+		return
+	}
+
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", tokenID).Take(&user).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// a stolen access token must not allow guessing the factors here
+	if server.loginThrottled(w, r, user.Email) {
+		return
+	}
+
+	err = models.VerifyPassword(user.Password, request.Password)
+	if err != nil {
+		server.respondLoginFailure(w, r, user.Email, loginMethodPassword, http.StatusUnprocessableEntity, errors.New("incorrect password"))
+		return
+	}
+
+	if user.TOTPEnabled() {
+		method := loginMethodTOTP
+		if request.RecoveryCode != "" {
+			method = loginMethodRecoveryCode
+		}
+
+		err = server.verifySecondFactor(&user, request)
+		if err == models.ErrInvalidTOTPCode {
+			server.respondLoginFailure(w, r, user.Email, method, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	err = user.DisableTOTP(server.DB, user.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, "two-factor authentication disabled", nil)
+}
+
+func (server *Server) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	request, err := readMFARequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", tokenID).Take(&user).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if !user.TOTPEnabled() {
+		responses.ERROR(w, http.StatusConflict, errors.New("two-factor authentication is not enabled"))
+		return
+	}
+
+	if request.Code == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("required code"))
+		return
+	}
+	if server.loginThrottled(w, r, user.Email) {
+		return
+	}
+	err = user.VerifyTOTP(server.DB, request.Code)
+	if err == models.ErrInvalidTOTPCode {
+		server.respondLoginFailure(w, r, user.Email, loginMethodTOTP, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	server.respondRecoveryCodes(w, user.ID, "recovery codes regenerated")
+}
+
+func (server *Server) respondRecoveryCodes(w http.ResponseWriter, userID uint32, message string) {
+	recoveryCode := models.RecoveryCode{}
+	codes, err := recoveryCode.GenerateRecoveryCodes(server.DB, userID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, message, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: codes,
+	})
+}
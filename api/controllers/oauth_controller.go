@@ -0,0 +1,930 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/middlewares"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+// BrowserSessionExpiryInHour is how long a sign in at /oauth/authorize
+// lasts before the user has to sign in again.
+const BrowserSessionExpiryInHour = 12
+
+const OAuthConsentExpiryInMinute = 10
+
+const browserSessionCookie = "auth_global_session"
+
+// authorizationRequest holds the parameters of an authorization request
+// (RFC 6749 section 4.1.1, RFC 7636 section 4.3, OpenID Connect Core
+// section 3.1.2.1).
+type authorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	Prompt              string
+	MaxAge              string
+}
+
+func readAuthorizationRequest(r *http.Request) authorizationRequest {
+	return authorizationRequest{
+		ClientID:            r.FormValue("client_id"),
+		RedirectURI:         r.FormValue("redirect_uri"),
+		ResponseType:        r.FormValue("response_type"),
+		Scope:               models.JoinScopes(r.FormValue("scope")),
+		State:               r.FormValue("state"),
+		CodeChallenge:       r.FormValue("code_challenge"),
+		CodeChallengeMethod: r.FormValue("code_challenge_method"),
+		Nonce:               r.FormValue("nonce"),
+		Prompt:              r.FormValue("prompt"),
+		MaxAge:              r.FormValue("max_age"),
+	}
+}
+
+func (request authorizationRequest) prompts(value string) bool {
+	for _, prompt := range strings.Fields(request.Prompt) {
+		if prompt == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validPrompt checks prompt and max_age; none may not be combined with
+// another prompt.
+func (request authorizationRequest) validPrompt() bool {
+	for _, prompt := range strings.Fields(request.Prompt) {
+		switch prompt {
+		case "none", "login", "consent", "select_account":
+		default:
+			return false
+		}
+	}
+	if request.prompts("none") && len(strings.Fields(request.Prompt)) > 1 {
+		return false
+	}
+
+	if request.MaxAge != "" {
+		maxAge, err := strconv.Atoi(request.MaxAge)
+		if err != nil || maxAge < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reauthenticate reports whether the user has to sign in again although
+// session is still active, because of prompt=login or max_age.
+func (request authorizationRequest) reauthenticate(session *models.Session) bool {
+	if request.prompts("login") {
+		return true
+	}
+
+	maxAge, err := strconv.Atoi(request.MaxAge)
+	return err == nil && time.Since(session.CreatedAt) > time.Duration(maxAge)*time.Second
+}
+
+// signedIn drops what a fresh sign in satisfies, so the following forms do
+// not ask for it again.
+func (request authorizationRequest) signedIn() authorizationRequest {
+	prompts := []string{}
+	for _, prompt := range strings.Fields(request.Prompt) {
+		if prompt != "login" {
+			prompts = append(prompts, prompt)
+		}
+	}
+	request.Prompt = strings.Join(prompts, " ")
+	request.MaxAge = ""
+
+	return request
+}
+
+// hidden carries the request through the login and consent forms.
+func (request authorizationRequest) hidden() []hiddenField {
+	fields := []hiddenField{}
+	for _, field := range []hiddenField{
+		{"client_id", request.ClientID},
+		{"redirect_uri", request.RedirectURI},
+		{"response_type", request.ResponseType},
+		{"scope", request.Scope},
+		{"state", request.State},
+		{"code_challenge", request.CodeChallenge},
+		{"code_challenge_method", request.CodeChallengeMethod},
+		{"nonce", request.Nonce},
+		{"prompt", request.Prompt},
+		{"max_age", request.MaxAge},
+	} {
+		if field.Value != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// fingerprint binds a consent form to the request it was shown for.
+func (request authorizationRequest) fingerprint() string {
+	return crypto.SHA256Hash(strings.Join([]string{
+		request.ClientID, request.RedirectURI, request.Scope, request.State, request.CodeChallenge, request.Nonce,
+	}, "\n"))
+}
+
+// validScope checks the scope syntax of RFC 6749 section 3.3.
+func validScope(scope string) bool {
+	for _, c := range scope {
+		if c != ' ' && (c < 0x21 || c == 0x22 || c == 0x5c || c > 0x7e) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// redirectWithParams sends the browser back to the client with params added
+// to redirectURI.
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		renderOAuthPage(w, http.StatusBadRequest, oauthPage{Step: oauthStepError, Error: "invalid redirect_uri"})
+		return
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func redirectOAuthError(w http.ResponseWriter, r *http.Request, redirectURI, state, code, description string) {
+	params := url.Values{"error": {code}, "error_description": {description}}
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	redirectWithParams(w, r, redirectURI, params)
+}
+
+// Authorize is the OAuth authorization endpoint. It signs the user in,
+// asks for consent the first time a client wants a scope, and redirects
+// back to the client with an authorization code.
+func (server *Server) Authorize(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		renderOAuthPage(w, http.StatusBadRequest, oauthPage{Step: oauthStepError, Error: "invalid request"})
+		return
+	}
+
+	request := readAuthorizationRequest(r)
+
+	// without a known client and redirect URI there is nowhere safe to
+	// send an error
+	client := models.OAuthClient{}
+	foundClient, err := client.FindOAuthClientByClientID(server.DB, request.ClientID)
+	if err != nil {
+		renderOAuthPage(w, http.StatusBadRequest, oauthPage{Step: oauthStepError, Error: "unknown client"})
+		return
+	}
+	redirectURI, ok := foundClient.RedirectURI(request.RedirectURI)
+	if !ok {
+		renderOAuthPage(w, http.StatusBadRequest, oauthPage{Step: oauthStepError, Error: "invalid redirect_uri"})
+		return
+	}
+
+	if request.ResponseType != "code" {
+		redirectOAuthError(w, r, redirectURI, request.State, "unsupported_response_type", "response_type must be code")
+		return
+	}
+	if !models.ValidPKCEValue(request.CodeChallenge) {
+		redirectOAuthError(w, r, redirectURI, request.State, "invalid_request", "code_challenge is required")
+		return
+	}
+	if request.CodeChallengeMethod != "S256" {
+		redirectOAuthError(w, r, redirectURI, request.State, "invalid_request", "code_challenge_method must be S256")
+		return
+	}
+	if !foundClient.AllowsGrant(models.GrantAuthorizationCode) {
+		redirectOAuthError(w, r, redirectURI, request.State, "unauthorized_client", "the client may not use authorization_code")
+		return
+	}
+	if !validScope(request.Scope) || !models.ScopeCovers(foundClient.Scopes, request.Scope) {
+		redirectOAuthError(w, r, redirectURI, request.State, "invalid_scope", "invalid scope")
+		return
+	}
+	if openIDUnavailable(request.Scope) {
+		redirectOAuthError(w, r, redirectURI, request.State, "invalid_scope", jwt.ErrNoIDTokenKey.Error())
+		return
+	}
+	if !request.validPrompt() {
+		redirectOAuthError(w, r, redirectURI, request.State, "invalid_request", "invalid prompt or max_age")
+		return
+	}
+
+	page := oauthPage{
+		Action:     r.URL.Path,
+		ClientName: foundClient.Name,
+		LogoURI:    foundClient.LogoURI,
+		Scopes:     strings.Fields(request.Scope),
+		Hidden:     request.hidden(),
+	}
+
+	user, session, ok := server.browserSession(r)
+	if ok && request.reauthenticate(session) {
+		ok = false
+	}
+	if !ok {
+		if request.prompts("none") {
+			redirectOAuthError(w, r, redirectURI, request.State, "login_required", "the user is not signed in")
+			return
+		}
+
+		user, session, ok = server.browserSignIn(w, r, page)
+		if !ok {
+			return
+		}
+
+		request = request.signedIn()
+		page.Hidden = request.hidden()
+	}
+
+	consent := models.OAuthConsent{}
+	consented, err := consent.HasOAuthConsent(server.DB, user.ID, foundClient.ID, request.Scope)
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+		return
+	}
+
+	if !consented || request.prompts("consent") {
+		if r.Method != http.MethodPost || r.PostFormValue("step") != oauthStepConsent {
+			if request.prompts("none") {
+				redirectOAuthError(w, r, redirectURI, request.State, "consent_required", "the user has not allowed the requested scope")
+				return
+			}
+			server.renderConsent(w, user, session, request.fingerprint(), page, "")
+			return
+		}
+
+		consentToken, err := jwt.ConsumeActionToken(r.PostFormValue("consent_token"), jwt.PurposeOAuthConsent)
+		if err != nil || consentToken.UserID != user.ID || consentToken.SessionID != session.PublicID || consentToken.Subject != request.fingerprint() {
+			server.renderConsent(w, user, session, request.fingerprint(), page, "request expired, please try again")
+			return
+		}
+
+		if r.PostFormValue("decision") != "allow" {
+			redirectOAuthError(w, r, redirectURI, request.State, "access_denied", "the user denied the request")
+			return
+		}
+
+		err = consent.SaveOAuthConsent(server.DB, user.ID, foundClient.ID, request.Scope)
+		if err != nil {
+			renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+			return
+		}
+		server.audit(r, auditSuccess(models.AuditOAuthConsent, strings.TrimSpace(foundClient.ClientID+" "+request.Scope)), user)
+	}
+
+	authorizationCode := models.OAuthAuthorizationCode{
+		ClientID:        foundClient.ID,
+		UserID:          user.ID,
+		SessionID:       session.PublicID,
+		RedirectURI:     redirectURI,
+		RedirectURISent: request.RedirectURI != "",
+		Scope:           request.Scope,
+		Nonce:           request.Nonce,
+		CodeChallenge:   request.CodeChallenge,
+	}
+	code, err := authorizationCode.SaveOAuthAuthorizationCode(server.DB)
+	if err != nil {
+		redirectOAuthError(w, r, redirectURI, request.State, "server_error", "could not issue an authorization code")
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	redirectWithParams(w, r, redirectURI, params)
+}
+
+// renderConsent asks the user to allow a request. The form carries a
+// consent token bound to the user, the session and the fingerprint of the
+// request.
+func (server *Server) renderConsent(w http.ResponseWriter, user *models.User, session *models.Session, fingerprint string, page oauthPage, message string) {
+	publicID, err := crypto.Encrypt(strconv.Itoa(int(user.ID)), os.Getenv("APP_KEY"))
+	if err == nil {
+		page.ConsentToken, err = jwt.CreateSessionActionToken(jwt.PurposeOAuthConsent, publicID, fingerprint, session.PublicID, time.Minute*OAuthConsentExpiryInMinute)
+	}
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+		return
+	}
+
+	page.Step = oauthStepConsent
+	page.Error = message
+	renderOAuthPage(w, http.StatusOK, page)
+}
+
+// browserSession returns the user signed in by the session cookie, as long
+// as the session is still active and the account can be used.
+func (server *Server) browserSession(r *http.Request) (*models.User, *models.Session, bool) {
+	cookie, err := r.Cookie(browserSessionCookie)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	token, err := jwt.ParseActionToken(cookie.Value, jwt.PurposeBrowserSession)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", token.UserID).Take(&user).Error
+	if err != nil || user.CanSignIn() != nil {
+		return nil, nil, false
+	}
+
+	session := models.Session{}
+	found, err := session.FindActiveSession(server.DB, user.ID, token.SessionID)
+	if err != nil {
+		return nil, nil, false
+	}
+	err = session.TouchSession(server.DB, found.PublicID, middlewares.ClientIP(r), time.Now())
+	if err != nil {
+		log.Printf("session %s: %v", found.PublicID, err)
+	}
+
+	return &user, found, true
+}
+
+// browserSignIn shows the sign in form and checks what it posts, the
+// password and then, for accounts with two factors, a code. Once signed
+// in, a session is started and remembered in a cookie.
+func (server *Server) browserSignIn(w http.ResponseWriter, r *http.Request, page oauthPage) (*models.User, *models.Session, bool) {
+	page.Step = oauthStepLogin
+	if r.Method != http.MethodPost {
+		renderOAuthPage(w, http.StatusOK, page)
+		return nil, nil, false
+	}
+
+	var (
+		user   *models.User
+		method string
+	)
+	switch r.PostFormValue("step") {
+	case oauthStepLogin:
+		user, method = server.browserPasswordSignIn(w, r, page)
+	case oauthStepMFA:
+		user, method = server.browserMFASignIn(w, r, page)
+	default:
+		renderOAuthPage(w, http.StatusOK, page)
+	}
+	if user == nil {
+		return nil, nil, false
+	}
+
+	session, err := server.startBrowserSession(w, r, user, method)
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+		return nil, nil, false
+	}
+
+	return user, session, true
+}
+
+func (server *Server) browserPasswordSignIn(w http.ResponseWriter, r *http.Request, page oauthPage) (*models.User, string) {
+	credentials := models.User{Email: r.PostFormValue("email"), Password: r.PostFormValue("password")}
+	credentials.Prepare()
+	page.Email = credentials.Email
+
+	err := credentials.Validate("login")
+	if err != nil {
+		page.Error = err.Error()
+		renderOAuthPage(w, http.StatusUnprocessableEntity, page)
+		return nil, ""
+	}
+
+	if server.browserThrottled(w, r, credentials.Email, page) {
+		return nil, ""
+	}
+
+	signedIn, err := server.signIn(credentials.Email, credentials.Password)
+	if err == models.ErrInvalidCredentials {
+		server.browserLoginFailure(w, r, credentials.Email, loginMethodPassword, err, page)
+		return nil, ""
+	}
+	if err != nil {
+		server.auditLoginFailure(r, credentials.Email, loginMethodPassword, err)
+		page.Error = err.Error()
+		renderOAuthPage(w, http.StatusForbidden, page)
+		return nil, ""
+	}
+
+	// the failures are only forgotten once the second factor is passed too
+	if signedIn.TOTPEnabled() {
+		publicID, err := crypto.Encrypt(strconv.Itoa(int(signedIn.ID)), os.Getenv("APP_KEY"))
+		if err == nil {
+			page.MFAToken, err = jwt.CreateActionToken(jwt.PurposeMFA, publicID, signedIn.PublicID, time.Minute*MFAChallengeExpiryInMinute)
+		}
+		if err != nil {
+			renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+			return nil, ""
+		}
+
+		page.Step = oauthStepMFA
+		page.Error = ""
+		renderOAuthPage(w, http.StatusOK, page)
+		return nil, ""
+	}
+
+	err = server.resetLoginFailures(signedIn)
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+		return nil, ""
+	}
+
+	return signedIn, loginMethodPassword
+}
+
+func (server *Server) browserMFASignIn(w http.ResponseWriter, r *http.Request, page oauthPage) (*models.User, string) {
+	request := mfaRequest{
+		MFAToken:     r.PostFormValue("mfa_token"),
+		Code:         strings.TrimSpace(r.PostFormValue("code")),
+		RecoveryCode: strings.TrimSpace(r.PostFormValue("recovery_code")),
+	}
+
+	challenge, err := jwt.ParseActionToken(request.MFAToken, jwt.PurposeMFA)
+	if err != nil {
+		page.Error = "sign in expired, please try again"
+		renderOAuthPage(w, http.StatusUnauthorized, page)
+		return nil, ""
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", challenge.UserID).Take(&user).Error
+	if err == nil {
+		err = user.CanSignIn()
+	}
+	if err != nil || !user.TOTPEnabled() {
+		page.Error = "sign in expired, please try again"
+		renderOAuthPage(w, http.StatusUnauthorized, page)
+		return nil, ""
+	}
+
+	page.Step = oauthStepMFA
+	page.MFAToken = request.MFAToken
+	if server.browserThrottled(w, r, user.Email, page) {
+		return nil, ""
+	}
+
+	method := loginMethodTOTP
+	if request.RecoveryCode != "" {
+		method = loginMethodRecoveryCode
+	}
+
+	err = server.verifySecondFactor(&user, request)
+	if err == models.ErrInvalidTOTPCode {
+		server.browserLoginFailure(w, r, user.Email, method, err, page)
+		return nil, ""
+	}
+	if err != nil {
+		page.Error = err.Error()
+		renderOAuthPage(w, http.StatusUnprocessableEntity, page)
+		return nil, ""
+	}
+
+	err = server.resetLoginFailures(&user)
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+		return nil, ""
+	}
+
+	// the challenge is only good for one session
+	_, err = jwt.ConsumeActionToken(request.MFAToken, jwt.PurposeMFA)
+	if err != nil {
+		page.Step = oauthStepLogin
+		page.Error = "sign in expired, please try again"
+		renderOAuthPage(w, http.StatusUnauthorized, page)
+		return nil, ""
+	}
+
+	return &user, method
+}
+
+// browserThrottled is loginThrottled for the sign in page.
+func (server *Server) browserThrottled(w http.ResponseWriter, r *http.Request, email string, page oauthPage) bool {
+	retryAfter, locked, err := server.loginRetryAfter(r, email)
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+		return true
+	}
+	if retryAfter <= 0 {
+		return false
+	}
+
+	setRetryAfter(w, retryAfter)
+	if locked {
+		page.Error = models.ErrAccountLocked.Error()
+		renderOAuthPage(w, http.StatusLocked, page)
+		return true
+	}
+	page.Error = "too many requests, please try again later"
+	renderOAuthPage(w, http.StatusTooManyRequests, page)
+	return true
+}
+
+// browserLoginFailure is respondLoginFailure for the sign in page.
+func (server *Server) browserLoginFailure(w http.ResponseWriter, r *http.Request, email, method string, failure error, page oauthPage) {
+	locked, err := server.recordLoginFailure(r, email, method, failure)
+	if err != nil {
+		renderOAuthPage(w, http.StatusInternalServerError, oauthPage{Step: oauthStepError, Error: "something went wrong, please try again"})
+		return
+	}
+	if locked {
+		setRetryAfter(w, models.LoginLockoutPolicy().Duration)
+		page.Error = models.ErrAccountLocked.Error()
+		renderOAuthPage(w, http.StatusLocked, page)
+		return
+	}
+
+	page.Error = failure.Error()
+	renderOAuthPage(w, http.StatusUnauthorized, page)
+}
+
+// startBrowserSession starts a session for user on this browser, remembers
+// it in the session cookie and records the sign in.
+func (server *Server) startBrowserSession(w http.ResponseWriter, r *http.Request, user *models.User, method string) (*models.Session, error) {
+	session := models.Session{}
+	_, err := session.SaveSession(server.DB, user.ID, middlewares.ClientIP(r), r.UserAgent())
+	if err != nil {
+		return nil, err
+	}
+
+	publicID, err := crypto.Encrypt(strconv.Itoa(int(user.ID)), os.Getenv("APP_KEY"))
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime := time.Hour * BrowserSessionExpiryInHour
+	token, err := jwt.CreateSessionActionToken(jwt.PurposeBrowserSession, publicID, user.PublicID, session.PublicID, lifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     browserSessionCookie,
+		Value:    token,
+		Path:     "/oauth",
+		MaxAge:   int(lifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(os.Getenv("APP_URL"), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	server.audit(r, auditSuccess(models.AuditLogin, method), user)
+
+	return &session, nil
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+func oauthError(w http.ResponseWriter, statusCode int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	responses.RAW(w, statusCode, map[string]string{"error": code, "error_description": description})
+}
+
+// authenticateTokenClient identifies the client of a token request.
+// Confidential clients authenticate with their secret, through HTTP Basic
+// authentication or the form; public clients only send their client_id.
+func (server *Server) authenticateTokenClient(r *http.Request) (*models.OAuthClient, error) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostFormValue("client_id")
+		clientSecret = r.PostFormValue("client_secret")
+	}
+
+	client := models.OAuthClient{}
+	found, err := client.FindOAuthClientByClientID(server.DB, clientID)
+	if err != nil {
+		return &models.OAuthClient{}, err
+	}
+	if found.Public() {
+		if clientSecret != "" {
+			return &models.OAuthClient{}, models.ErrInvalidClient
+		}
+		return found, nil
+	}
+
+	return client.Authenticate(server.DB, clientID, clientSecret)
+}
+
+// Token is the OAuth token endpoint.
+func (server *Server) Token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+		return
+	}
+
+	client, err := server.authenticateTokenClient(r)
+	if err == models.ErrInvalidClient {
+		if _, _, ok := r.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+		oauthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	grantType := r.PostFormValue("grant_type")
+	switch grantType {
+	case models.GrantAuthorizationCode, models.GrantRefreshToken, models.GrantClientCredentials, models.GrantDeviceCode:
+	case "":
+		oauthError(w, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	default:
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type", "unsupported grant_type")
+		return
+	}
+	if !client.AllowsGrant(grantType) {
+		oauthError(w, http.StatusBadRequest, "unauthorized_client", "the client may not use "+grantType)
+		return
+	}
+
+	switch grantType {
+	case models.GrantAuthorizationCode:
+		server.exchangeAuthorizationCode(w, r, client)
+	case models.GrantRefreshToken:
+		server.refreshClientToken(w, r, client)
+	case models.GrantClientCredentials:
+		server.issueClientToken(w, r, client)
+	case models.GrantDeviceCode:
+		server.exchangeDeviceCode(w, r, client)
+	}
+}
+
+func (server *Server) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	code := r.PostFormValue("code")
+	if code == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "code is required")
+		return
+	}
+
+	authorizationCode := models.OAuthAuthorizationCode{}
+	found, err := authorizationCode.FindOAuthAuthorizationCode(server.DB, code)
+	if err == models.ErrInvalidAuthorizationCode {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	if found.ClientID != client.ID {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", models.ErrInvalidAuthorizationCode.Error())
+		return
+	}
+	err = found.VerifyRedirectURI(r.PostFormValue("redirect_uri"))
+	if err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+
+	err = found.VerifyCodeVerifier(r.PostFormValue("code_verifier"))
+	if err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+
+	session := models.Session{}
+	err = found.ConsumeOAuthAuthorizationCode(server.DB)
+	if err == models.ErrReusedAuthorizationCode {
+		// the code may have leaked, end what was issued for it
+		err = session.RevokeSession(server.DB, found.UserID, found.SessionID)
+		if err != nil && err != models.ErrSessionNotFound {
+			oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+		oauthError(w, http.StatusBadRequest, "invalid_grant", models.ErrInvalidAuthorizationCode.Error())
+		return
+	}
+	if err == models.ErrInvalidAuthorizationCode {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	user, ok := server.activeUser(found.UserID)
+	if !ok {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", models.ErrInvalidAuthorizationCode.Error())
+		return
+	}
+	signedIn, err := session.FindActiveSession(server.DB, user.ID, found.SessionID)
+	if err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", models.ErrInvalidAuthorizationCode.Error())
+		return
+	}
+
+	audience := jwt.ClientAudience()
+	token, err := server.createAccessToken(user, jwt.Grant{Audience: audience, SessionID: found.SessionID, ClientID: client.ClientID, Scope: found.Scope})
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	// the client's refresh tokens belong to the session the user signed in with
+	plainRefreshToken, err := server.createClientRefreshToken(user, client, audience, found.SessionID, found.Scope)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	idToken, err := server.createIDToken(user, client, found.Scope, found.Nonce, signedIn.CreatedAt)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	responses.RAW(w, http.StatusOK, oauthTokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(jwt.TokenLifetime(audience).Seconds()),
+		RefreshToken: plainRefreshToken,
+		Scope:        found.Scope,
+		IDToken:      idToken,
+	})
+}
+
+func (server *Server) refreshClientToken(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	if r.PostFormValue("refresh_token") == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+		return
+	}
+
+	// the request is checked in full before the token is rotated, a rotated
+	// token that never reaches the client would revoke the session on retry
+	presented := models.RefreshToken{}
+	_, err := presented.FindRefreshToken(server.DB, r.PostFormValue("refresh_token"))
+	if err == nil && presented.ClientID != client.ClientID {
+		err = models.ErrInvalidRefreshToken
+	}
+	switch err {
+	case nil:
+	case models.ErrInvalidRefreshToken:
+		oauthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	default:
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	// a narrower scope may be asked for, never a wider one
+	scope := presented.Scope
+	if requested := models.JoinScopes(r.PostFormValue("scope")); requested != "" {
+		if !models.ScopeCovers(presented.Scope, requested) {
+			oauthError(w, http.StatusBadRequest, "invalid_scope", "scope exceeds the granted scope")
+			return
+		}
+		scope = requested
+	}
+
+	user, ok := server.activeUser(presented.UserID)
+	if !ok {
+		presented.RevokeRefreshTokenFamily(server.DB, presented.FamilyID)
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "unauthorized")
+		return
+	}
+
+	refreshToken := models.RefreshToken{}
+	rotatedToken, err := refreshToken.RotateRefreshToken(server.DB, r.PostFormValue("refresh_token"), client.ClientID)
+	switch err {
+	case nil:
+	case models.ErrInvalidRefreshToken, models.ErrExpiredRefreshToken, models.ErrReusedRefreshToken:
+		oauthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	default:
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	audience := jwt.ClientAudience()
+	token, err := server.createAccessToken(user, jwt.Grant{Audience: audience, SessionID: refreshToken.FamilyID, ClientID: client.ClientID, Scope: scope})
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	session := models.Session{}
+	err = session.TouchSession(server.DB, refreshToken.FamilyID, middlewares.ClientIP(r), time.Now())
+	if err != nil {
+		log.Printf("session %s: %v", refreshToken.FamilyID, err)
+	}
+
+	// a refreshed ID token keeps the time the user signed in
+	var authTime time.Time
+	if signedIn, err := session.FindActiveSession(server.DB, user.ID, refreshToken.FamilyID); err == nil {
+		authTime = signedIn.CreatedAt
+	}
+	idToken, err := server.createIDToken(user, client, scope, "", authTime)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	responses.RAW(w, http.StatusOK, oauthTokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(jwt.TokenLifetime(audience).Seconds()),
+		RefreshToken: rotatedToken,
+		Scope:        scope,
+		IDToken:      idToken,
+	})
+}
+
+// createClientRefreshToken issues a refresh token in the session familyID,
+// or none when the client may not use the refresh_token grant.
+func (server *Server) createClientRefreshToken(user *models.User, client *models.OAuthClient, audience, familyID, scope string) (string, error) {
+	if !client.AllowsGrant(models.GrantRefreshToken) {
+		return "", nil
+	}
+
+	refreshToken := models.RefreshToken{}
+	return refreshToken.SaveRefreshToken(server.DB, user.ID, audience, familyID, client.ClientID, scope)
+}
+
+// issueClientToken answers the client_credentials grant: a confidential
+// client gets an access token for itself, limited to its registered scopes.
+// No refresh token is issued, the client simply asks again.
+func (server *Server) issueClientToken(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	if client.Public() {
+		oauthError(w, http.StatusBadRequest, "unauthorized_client", "public clients cannot use client_credentials")
+		return
+	}
+
+	scope := models.JoinScopes(client.Scopes)
+	if requested := models.JoinScopes(r.PostFormValue("scope")); requested != "" {
+		if !models.ScopeCovers(client.Scopes, requested) {
+			oauthError(w, http.StatusBadRequest, "invalid_scope", "scope exceeds the scopes registered for the client")
+			return
+		}
+		scope = requested
+	}
+
+	audience, err := jwt.Audience(r.PostFormValue("audience"))
+	if err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	token, err := jwt.CreateClientToken(client.ClientID, audience, scope)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	responses.RAW(w, http.StatusOK, oauthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(jwt.TokenLifetime(audience).Seconds()),
+		Scope:       scope,
+	})
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// Steps of the pages shown by /oauth/authorize and /oauth/device. The
+// confirm step is shown by emailed links before their token is used.
+const (
+	oauthStepLogin   = "login"
+	oauthStepMFA     = "mfa"
+	oauthStepConsent = "consent"
+	oauthStepError   = "error"
+	oauthStepDevice  = "device"
+	oauthStepDone    = "done"
+	oauthStepConfirm = "confirm"
+)
+
+type hiddenField struct {
+	Name  string
+	Value string
+}
+
+// oauthPage is what the authorization pages show. Hidden carries the
+// authorization request from one step to the next.
+type oauthPage struct {
+	Step         string
+	Action       string
+	ClientName   string
+	LogoURI      string
+	Error        string
+	Message      string
+	Button       string
+	UserCode     string
+	Email        string
+	MFAToken     string
+	ConsentToken string
+	Scopes       []string
+	Hidden       []hiddenField
+}
+
+var oauthTemplate = template.Must(template.New("oauth").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if eq .Step "consent"}}Authorize {{.ClientName}}{{else if eq .Step "error"}}Authorization error{{else if or (eq .Step "device") (eq .Step "done")}}Connect a device{{else if eq .Step "confirm"}}{{.Message}}{{else}}Sign in{{end}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; background: #f4f5f7; margin: 0; }
+main { max-width: 360px; margin: 10vh auto; background: #fff; padding: 2rem; border-radius: 8px; box-shadow: 0 1px 4px rgba(0, 0, 0, .1); }
+h1 { font-size: 1.25rem; margin-top: 0; }
+label { display: block; margin: 1rem 0 .25rem; font-size: .9rem; }
+input[type=email], input[type=password], input[type=text] { width: 100%; box-sizing: border-box; padding: .5rem; font-size: 1rem; }
+button { margin-top: 1.5rem; padding: .6rem 1rem; font-size: 1rem; cursor: pointer; }
+.error { color: #b00020; }
+.secondary { background: none; border: 1px solid #999; }
+.logo { display: block; max-width: 64px; max-height: 64px; margin-bottom: 1rem; }
+</style>
+</head>
+<body>
+<main>
+{{if eq .Step "error"}}
+<h1>Authorization error</h1>
+<p class="error">{{.Error}}</p>
+{{else if eq .Step "done"}}
+<h1>Connect a device</h1>
+<p>{{.Message}}</p>
+{{else}}
+<form method="post" action="{{.Action}}">
+{{range .Hidden}}<input type="hidden" name="{{.Name}}" value="{{.Value}}">
+{{end}}
+{{if eq .Step "login"}}
+<h1>{{if .ClientName}}Sign in to continue to {{.ClientName}}{{else}}Sign in{{end}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<input type="hidden" name="step" value="login">
+<label for="email">Email</label>
+<input type="email" id="email" name="email" value="{{.Email}}" autocomplete="username" required autofocus>
+<label for="password">Password</label>
+<input type="password" id="password" name="password" autocomplete="current-password" required>
+<button type="submit">Sign in</button>
+{{else if eq .Step "mfa"}}
+<h1>Two-factor authentication</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<input type="hidden" name="step" value="mfa">
+<input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+<label for="code">Code from your authenticator app</label>
+<input type="text" id="code" name="code" inputmode="numeric" autocomplete="one-time-code" autofocus>
+<label for="recovery_code">Or a recovery code</label>
+<input type="text" id="recovery_code" name="recovery_code" autocomplete="off">
+<button type="submit">Verify</button>
+{{else if eq .Step "consent"}}
+{{if .LogoURI}}<img class="logo" src="{{.LogoURI}}" alt="">{{end}}
+<h1>{{.ClientName}} wants to access your account</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .UserCode}}<p>Only continue if your device shows the code <strong>{{.UserCode}}</strong>.</p>{{end}}
+{{if .Scopes}}<p>It asks for:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+<input type="hidden" name="step" value="consent">
+<input type="hidden" name="consent_token" value="{{.ConsentToken}}">
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny" class="secondary">Deny</button>
+{{else if eq .Step "device"}}
+<h1>Connect a device</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<input type="hidden" name="step" value="device">
+<label for="user_code">Code shown on your device</label>
+<input type="text" id="user_code" name="user_code" value="{{.UserCode}}" autocomplete="off" autocapitalize="characters" required autofocus>
+<button type="submit">Continue</button>
+{{else if eq .Step "confirm"}}
+<h1>{{.Message}}</h1>
+<button type="submit">{{.Button}}</button>
+{{end}}
+</form>
+{{end}}
+</main>
+</body>
+</html>
+`))
+
+func renderOAuthPage(w http.ResponseWriter, statusCode int, page oauthPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src https:; frame-ancestors 'none'")
+	w.WriteHeader(statusCode)
+
+	err := oauthTemplate.Execute(w, page)
+	if err != nil {
+		log.Printf("render %s page: %v", page.Step, err)
+	}
+}
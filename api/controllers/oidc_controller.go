@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+// OpenID Connect scopes. openid asks for an ID token, email and profile for
+// the claims they name.
+const (
+	scopeOpenID  = "openid"
+	scopeEmail   = "email"
+	scopeProfile = "profile"
+)
+
+// createIDToken issues an ID token when scope includes openid, and returns
+// an empty string otherwise.
+func (server *Server) createIDToken(user *models.User, client *models.OAuthClient, scope, nonce string, authTime time.Time) (string, error) {
+	// openid is refused on authorization while ID tokens cannot be signed,
+	// a refresh in the meantime gets none
+	if !models.ScopeCovers(scope, scopeOpenID) || !jwt.IDTokensEnabled() {
+		return "", nil
+	}
+
+	idToken := jwt.IDToken{
+		Subject:        user.PublicID,
+		ClientID:       client.ClientID,
+		Nonce:          nonce,
+		AuthTime:       authTime,
+		Email:          user.Email,
+		EmailVerified:  user.EmailVerifiedAt != nil,
+		IncludeEmail:   models.ScopeCovers(scope, scopeEmail),
+		IncludeProfile: models.ScopeCovers(scope, scopeProfile),
+	}
+	if idToken.IncludeProfile {
+		name, err := crypto.Decrypt(user.Name, os.Getenv("APP_KEY"))
+		if err != nil {
+			return "", err
+		}
+		idToken.Name = name
+	}
+
+	return jwt.CreateIDToken(idToken)
+}
+
+type userInfo struct {
+	Subject       string `json:"sub"`
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// UserInfo is the OpenID Connect userinfo endpoint, behind
+// RequireScope(openid). Tokens issued to a client only see the claims their
+// scopes grant; first party tokens see every claim.
+func (server *Server) UserInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := jwt.ParseToken(jwt.ExtractToken(r))
+	if err != nil {
+		responses.BearerError(w, http.StatusUnauthorized, "invalid_token", "invalid or expired access token")
+		return
+	}
+
+	scope := strings.Join([]string{scopeOpenID, scopeEmail, scopeProfile}, " ")
+	if info.ClientID != "" {
+		scope = info.Scope
+	}
+
+	user, ok := server.activeUser(info.UserID)
+	if !ok {
+		responses.BearerError(w, http.StatusUnauthorized, "invalid_token", "invalid or expired access token")
+		return
+	}
+
+	claims := userInfo{Subject: user.PublicID}
+	if models.ScopeCovers(scope, scopeEmail) {
+		emailVerified := user.EmailVerifiedAt != nil
+		claims.Email = user.Email
+		claims.EmailVerified = &emailVerified
+	}
+	if models.ScopeCovers(scope, scopeProfile) {
+		// decrypt name
+		claims.Name, err = crypto.Decrypt(user.Name, os.Getenv("APP_KEY"))
+		if err != nil {
+			responses.RAW(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	responses.RAW(w, http.StatusOK, claims)
+}
+
+// OpenIDConfiguration is the discovery document of OpenID Connect
+// Discovery 1.0, so client libraries configure themselves from the issuer.
+func (server *Server) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	base := baseURL()
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	responses.RAW(w, http.StatusOK, struct {
+		Issuer                            string   `json:"issuer"`
+		AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+		TokenEndpoint                     string   `json:"token_endpoint"`
+		DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+		RegistrationEndpoint              string   `json:"registration_endpoint"`
+		UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+		JWKSURI                           string   `json:"jwks_uri"`
+		IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+		ScopesSupported                   []string `json:"scopes_supported"`
+		ResponseTypesSupported            []string `json:"response_types_supported"`
+		ResponseModesSupported            []string `json:"response_modes_supported"`
+		GrantTypesSupported               []string `json:"grant_types_supported"`
+		SubjectTypesSupported             []string `json:"subject_types_supported"`
+		IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+		TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+		CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+		ClaimsSupported                   []string `json:"claims_supported"`
+	}{
+		Issuer:                            jwt.Issuer(),
+		AuthorizationEndpoint:             base + "/oauth/authorize",
+		TokenEndpoint:                     base + "/oauth/token",
+		DeviceAuthorizationEndpoint:       base + "/oauth/device_authorization",
+		RegistrationEndpoint:              base + "/oauth/register",
+		UserInfoEndpoint:                  base + "/userinfo",
+		JWKSURI:                           base + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             base + "/v1/introspect",
+		ScopesSupported:                   supportedScopes(),
+		ResponseTypesSupported:            []string{"code"},
+		ResponseModesSupported:            []string{"query"},
+		GrantTypesSupported:               []string{models.GrantAuthorizationCode, models.GrantRefreshToken, models.GrantClientCredentials, models.GrantDeviceCode},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  jwt.SigningAlgorithms(),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "azp", "email", "email_verified", "name"},
+	})
+}
+
+// supportedScopes lists openid only while ID tokens can be signed.
+func supportedScopes() []string {
+	if !jwt.IDTokensEnabled() {
+		return []string{scopeEmail, scopeProfile}
+	}
+
+	return []string{scopeOpenID, scopeEmail, scopeProfile}
+}
+
+// openIDUnavailable reports whether scope asks for ID tokens while none can
+// be signed.
+func openIDUnavailable(scope string) bool {
+	return models.ScopeCovers(scope, scopeOpenID) && !jwt.IDTokensEnabled()
+}
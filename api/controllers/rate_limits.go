@@ -0,0 +1,27 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/norfabagas/auth-global/api/middlewares"
+)
+
+// Rate limits of the public endpoints. Each can be changed with
+// RATE_LIMIT_<NAME>=limit/window, e.g. RATE_LIMIT_LOGIN_IP=30/1m.
+var (
+	registerIPLimit              = middlewares.RatePolicy{Name: "register-ip", Algorithm: middlewares.SlidingWindow, Limit: 10, Window: time.Hour}
+	loginIPLimit                 = middlewares.RatePolicy{Name: "login-ip", Algorithm: middlewares.TokenBucket, Limit: 30, Window: time.Minute}
+	loginEmailLimit              = middlewares.RatePolicy{Name: "login-email", Algorithm: middlewares.TokenBucket, Limit: 10, Window: time.Minute}
+	loginMFAIPLimit              = middlewares.RatePolicy{Name: "login-mfa-ip", Algorithm: middlewares.TokenBucket, Limit: 30, Window: time.Minute}
+	magicLinkIPLimit             = middlewares.RatePolicy{Name: "magic-link-ip", Algorithm: middlewares.SlidingWindow, Limit: 10, Window: 15 * time.Minute}
+	magicLinkEmailLimit          = middlewares.RatePolicy{Name: "magic-link-email", Algorithm: middlewares.SlidingWindow, Limit: 3, Window: 15 * time.Minute}
+	forgetPasswordIPLimit        = middlewares.RatePolicy{Name: "forget-password-ip", Algorithm: middlewares.SlidingWindow, Limit: 10, Window: time.Hour}
+	forgetPasswordEmailLimit     = middlewares.RatePolicy{Name: "forget-password-email", Algorithm: middlewares.SlidingWindow, Limit: 3, Window: time.Hour}
+	resetPasswordIPLimit         = middlewares.RatePolicy{Name: "reset-password-ip", Algorithm: middlewares.TokenBucket, Limit: 10, Window: time.Minute}
+	verificationResendIPLimit    = middlewares.RatePolicy{Name: "verify-email-resend-ip", Algorithm: middlewares.SlidingWindow, Limit: 10, Window: time.Hour}
+	verificationResendEmailLimit = middlewares.RatePolicy{Name: "verify-email-resend-email", Algorithm: middlewares.SlidingWindow, Limit: 3, Window: time.Hour}
+	webAuthnLoginIPLimit         = middlewares.RatePolicy{Name: "webauthn-login-ip", Algorithm: middlewares.TokenBucket, Limit: 30, Window: time.Minute}
+	changePasswordUserLimit      = middlewares.RatePolicy{Name: "change-password-user", Algorithm: middlewares.SlidingWindow, Limit: 5, Window: time.Hour}
+	deviceAuthorizationIPLimit   = middlewares.RatePolicy{Name: "device-authorization-ip", Algorithm: middlewares.TokenBucket, Limit: 10, Window: time.Minute}
+	deviceVerificationIPLimit    = middlewares.RatePolicy{Name: "device-verification-ip", Algorithm: middlewares.TokenBucket, Limit: 30, Window: time.Minute}
+)
@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+)
+
+func (server *Server) ListRoles(w http.ResponseWriter, r *http.Request) {
+	role := models.Role{}
+	roles, err := role.FindAllRoles(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), roles)
+}
+
+func (server *Server) ShowRole(w http.ResponseWriter, r *http.Request) {
+	role := models.Role{}
+	found, err := role.FindRoleByName(server.DB, mux.Vars(r)["name"])
+	if err == models.ErrRoleNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), found)
+}
+
+func (server *Server) CreateRole(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	role := models.Role{}
+	err = json.Unmarshal(body, &role)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	permissions := role.Permissions
+	role.Prepare()
+	err = role.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	roleCreated, err := role.SaveRole(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	for _, permission := range permissions {
+		err = role.GrantPermission(server.DB, roleCreated.Name, permission)
+		if err == models.ErrPermissionNotFound {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("permission not found: "+permission))
+			return
+		}
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	roleCreated, err = role.FindRoleByName(server.DB, roleCreated.Name)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminRoleCreate, "role="+roleCreated.Name), nil)
+
+	responses.JSON(w, http.StatusCreated, true, http.StatusText(http.StatusCreated), roleCreated)
+}
+
+func (server *Server) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	role := models.Role{}
+	err := role.DeleteRole(server.DB, mux.Vars(r)["name"])
+	if err == models.ErrRoleNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminRoleDelete, "role="+mux.Vars(r)["name"]), nil)
+
+	responses.JSON(w, http.StatusOK, true, "role deleted", nil)
+}
+
+func (server *Server) GrantPermission(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Permission string `json:"permission"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.Permission == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("required permission"))
+		return
+	}
+
+	role := models.Role{}
+	err = role.GrantPermission(server.DB, mux.Vars(r)["name"], request.Permission)
+	if err == models.ErrRoleNotFound || err == models.ErrPermissionNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	found, err := role.FindRoleByName(server.DB, mux.Vars(r)["name"])
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminPermissionGrant, "role="+found.Name+" permission="+request.Permission), nil)
+
+	responses.JSON(w, http.StatusOK, true, "permission granted", found)
+}
+
+func (server *Server) RevokePermission(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	role := models.Role{}
+	err := role.RevokePermission(server.DB, vars["name"], vars["permission"])
+	if err == models.ErrRoleNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	found, err := role.FindRoleByName(server.DB, vars["name"])
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminPermissionRevoke, "role="+found.Name+" permission="+vars["permission"]), nil)
+
+	responses.JSON(w, http.StatusOK, true, "permission revoked", found)
+}
+
+func (server *Server) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	permission := models.Permission{}
+	permissions, err := permission.FindAllPermissions(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), permissions)
+}
+
+func (server *Server) CreatePermission(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	permission := models.Permission{}
+	err = json.Unmarshal(body, &permission)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	permission.Prepare()
+	err = permission.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	permissionCreated, err := permission.SavePermission(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminPermissionCreate, "permission="+permissionCreated.Name), nil)
+
+	responses.JSON(w, http.StatusCreated, true, http.StatusText(http.StatusCreated), permissionCreated)
+}
+
+func (server *Server) DeletePermission(w http.ResponseWriter, r *http.Request) {
+	permission := models.Permission{}
+	err := permission.DeletePermission(server.DB, mux.Vars(r)["name"])
+	if err == models.ErrPermissionNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminPermissionDelete, "permission="+mux.Vars(r)["name"]), nil)
+
+	responses.JSON(w, http.StatusOK, true, "permission deleted", nil)
+}
+
+func (server *Server) ShowUserRoles(w http.ResponseWriter, r *http.Request) {
+	user := models.User{}
+	found, err := user.FindUserByPublicID(server.DB, mux.Vars(r)["public_id"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	server.respondUserRoles(w, found, http.StatusText(http.StatusOK))
+}
+
+func (server *Server) AssignRole(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Role string `json:"role"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.Role == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("required role"))
+		return
+	}
+
+	user := models.User{}
+	found, err := user.FindUserByPublicID(server.DB, mux.Vars(r)["public_id"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	err = user.AssignRole(server.DB, found.ID, request.Role)
+	if err == models.ErrRoleNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// force a refresh so the new role shows up in the user's tokens
+	err = jwt.RevokeAllTokens(found.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminRoleAssign, "role="+request.Role), found)
+
+	server.respondUserRoles(w, found, "role assigned")
+}
+
+func (server *Server) UnassignRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	user := models.User{}
+	found, err := user.FindUserByPublicID(server.DB, vars["public_id"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	err = user.UnassignRole(server.DB, found.ID, vars["role"])
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// tokens still carrying the removed role must not be accepted any more
+	err = jwt.RevokeAllTokens(found.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	server.audit(r, auditSuccess(models.AuditAdminRoleUnassign, "role="+vars["role"]), found)
+
+	server.respondUserRoles(w, found, "role unassigned")
+}
+
+func (server *Server) respondUserRoles(w http.ResponseWriter, user *models.User, message string) {
+	roles, err := user.FindUserRoles(server.DB, user.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	permissions, err := user.FindUserPermissions(server.DB, user.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, message, struct {
+		PublicID    string   `json:"public_id"`
+		Roles       []string `json:"roles"`
+		Permissions []string `json:"permissions"`
+	}{
+		PublicID:    user.PublicID,
+		Roles:       roles,
+		Permissions: permissions,
+	})
+}
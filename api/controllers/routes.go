@@ -5,14 +5,80 @@ import "github.com/norfabagas/auth-global/api/middlewares"
 func (s *Server) InitializeRoutes() {
 	// Base route
 	s.Router.HandleFunc("/", middlewares.SetMiddlewareJSON(s.Home)).Methods("GET")
-	s.Router.HandleFunc("/api-secret", middlewares.SetMiddlewareJSON(s.ApiSecret)).Methods("GET")
+	s.Router.HandleFunc("/.well-known/jwks.json", middlewares.SetMiddlewareJSON(s.JWKS)).Methods("GET")
+	s.Router.HandleFunc("/.well-known/openid-configuration", middlewares.SetMiddlewareJSON(s.OpenIDConfiguration)).Methods("GET")
+
+	// OAuth 2.0 authorization server and OpenID Connect provider
+	s.Router.HandleFunc("/oauth/authorize", s.Authorize).Methods("GET", "POST")
+	s.Router.HandleFunc("/oauth/token", middlewares.SetMiddlewareJSON(s.Token)).Methods("POST")
+	s.Router.HandleFunc("/oauth/device_authorization", middlewares.SetMiddlewareJSON(middlewares.RateLimit(deviceAuthorizationIPLimit, middlewares.ByIP)(s.DeviceAuthorization))).Methods("POST")
+	s.Router.HandleFunc("/oauth/device", middlewares.RateLimit(deviceVerificationIPLimit, middlewares.ByIP)(s.VerifyDevice)).Methods("GET", "POST")
+	s.Router.HandleFunc("/oauth/register", middlewares.SetMiddlewareJSON(s.RegisterClient)).Methods("POST")
+	s.Router.HandleFunc("/userinfo", middlewares.SetMiddlewareJSON(middlewares.RequireScope(scopeOpenID)(s.UserInfo))).Methods("GET", "POST")
 
 	// /v1 prefix routes
 	v1 := s.Router.PathPrefix("/v1").Subrouter()
-	v1.HandleFunc("/login", middlewares.SetMiddlewareJSON(s.Login)).Methods("POST")
-	v1.HandleFunc("/register", middlewares.SetMiddlewareJSON(s.CreateUser)).Methods("POST")
+	v1.HandleFunc("/login", middlewares.SetMiddlewareJSON(middlewares.RateLimit(loginIPLimit, middlewares.ByIP)(middlewares.RateLimit(loginEmailLimit, middlewares.ByEmail)(s.Login)))).Methods("POST")
+	v1.HandleFunc("/login/magic-link", middlewares.SetMiddlewareJSON(middlewares.RateLimit(magicLinkIPLimit, middlewares.ByIP)(middlewares.RateLimit(magicLinkEmailLimit, middlewares.ByEmail)(s.SendMagicLink)))).Methods("POST")
+	v1.HandleFunc("/login/magic-link/verify", middlewares.SetMiddlewareJSON(s.VerifyMagicLink)).Methods("GET", "POST")
+	v1.HandleFunc("/login/mfa", middlewares.SetMiddlewareJSON(middlewares.RateLimit(loginMFAIPLimit, middlewares.ByIP)(s.LoginMFA))).Methods("POST")
+	v1.HandleFunc("/token/refresh", middlewares.SetMiddlewareJSON(s.RefreshToken)).Methods("POST")
+	v1.HandleFunc("/logout", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.Logout))).Methods("POST")
+	v1.HandleFunc("/logout-all", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.LogoutAll))).Methods("POST")
+	v1.HandleFunc("/introspect", middlewares.SetMiddlewareJSON(s.Introspect)).Methods("POST")
+	v1.HandleFunc("/register", middlewares.SetMiddlewareJSON(middlewares.RateLimit(registerIPLimit, middlewares.ByIP)(s.CreateUser))).Methods("POST")
+	v1.HandleFunc("/verify-email", middlewares.SetMiddlewareJSON(s.VerifyEmail)).Methods("GET", "POST")
+	v1.HandleFunc("/verify-email/resend", middlewares.SetMiddlewareJSON(middlewares.RateLimit(verificationResendIPLimit, middlewares.ByIP)(middlewares.RateLimit(verificationResendEmailLimit, middlewares.ByEmail)(s.ResendVerificationEmail)))).Methods("POST")
 	v1.HandleFunc("/user", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.ShowUser))).Methods("GET")
 	v1.HandleFunc("/user/edit", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.UpdateUser))).Methods("PUT")
-	v1.HandleFunc("/user/change-password", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.ChangePassword))).Methods("POST")
-	v1.HandleFunc("/forget-password", middlewares.SetMiddlewareJSON(s.ForgetPassword)).Methods("POST")
+	v1.HandleFunc("/user/login-history", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.ShowLoginHistory))).Methods("GET")
+	v1.HandleFunc("/user/sessions", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.ListSessions))).Methods("GET")
+	v1.HandleFunc("/user/sessions/{id}", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.RevokeSession))).Methods("DELETE")
+	v1.HandleFunc("/user/change-password", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(middlewares.RateLimit(changePasswordUserLimit, middlewares.ByUser)(s.ChangePassword)))).Methods("POST")
+	v1.HandleFunc("/user/mfa/totp/enroll", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.EnrollTOTP))).Methods("POST")
+	v1.HandleFunc("/user/mfa/totp/confirm", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.ConfirmTOTP))).Methods("POST")
+	v1.HandleFunc("/user/mfa/totp/disable", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.DisableTOTP))).Methods("POST")
+	v1.HandleFunc("/user/mfa/recovery-codes", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.RegenerateRecoveryCodes))).Methods("POST")
+	v1.HandleFunc("/user/webauthn/credentials", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.ListWebAuthnCredentials))).Methods("GET")
+	v1.HandleFunc("/user/webauthn/credentials/{id}", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.DeleteWebAuthnCredential))).Methods("DELETE")
+	v1.HandleFunc("/forget-password", middlewares.SetMiddlewareJSON(middlewares.RateLimit(forgetPasswordIPLimit, middlewares.ByIP)(middlewares.RateLimit(forgetPasswordEmailLimit, middlewares.ByEmail)(s.ForgetPassword)))).Methods("POST")
+	v1.HandleFunc("/reset-password", middlewares.SetMiddlewareJSON(middlewares.RateLimit(resetPasswordIPLimit, middlewares.ByIP)(s.ResetPassword))).Methods("POST")
+	v1.HandleFunc("/unlock-account", middlewares.SetMiddlewareJSON(s.UnlockAccount)).Methods("GET", "POST")
+
+	// /v1/webauthn prefix routes, passkey registration and sign in
+	webAuthn := v1.PathPrefix("/webauthn").Subrouter()
+	webAuthn.HandleFunc("/register/begin", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.BeginWebAuthnRegistration))).Methods("POST")
+	webAuthn.HandleFunc("/register/finish", middlewares.SetMiddlewareAuth(middlewares.SetMiddlewareJSON(s.FinishWebAuthnRegistration))).Methods("POST")
+	webAuthn.HandleFunc("/login/begin", middlewares.SetMiddlewareJSON(middlewares.RateLimit(webAuthnLoginIPLimit, middlewares.ByIP)(s.BeginWebAuthnLogin))).Methods("POST")
+	webAuthn.HandleFunc("/login/finish", middlewares.SetMiddlewareJSON(middlewares.RateLimit(webAuthnLoginIPLimit, middlewares.ByIP)(s.FinishWebAuthnLogin))).Methods("POST")
+
+	// /v1/admin prefix routes, authorized by the roles and permissions in the token
+	admin := v1.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/roles", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:read")(s.ListRoles))).Methods("GET")
+	admin.HandleFunc("/roles", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:write")(s.CreateRole))).Methods("POST")
+	admin.HandleFunc("/roles/{name}", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:read")(s.ShowRole))).Methods("GET")
+	admin.HandleFunc("/roles/{name}", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:write")(s.DeleteRole))).Methods("DELETE")
+	admin.HandleFunc("/roles/{name}/permissions", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:write")(s.GrantPermission))).Methods("POST")
+	admin.HandleFunc("/roles/{name}/permissions/{permission}", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:write")(s.RevokePermission))).Methods("DELETE")
+	admin.HandleFunc("/permissions", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:read")(s.ListPermissions))).Methods("GET")
+	admin.HandleFunc("/permissions", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:write")(s.CreatePermission))).Methods("POST")
+	admin.HandleFunc("/permissions/{name}", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:write")(s.DeletePermission))).Methods("DELETE")
+	admin.HandleFunc("/users/{public_id}/roles", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:read")(s.ShowUserRoles))).Methods("GET")
+	admin.HandleFunc("/users/{public_id}/roles", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:write")(s.AssignRole))).Methods("POST")
+	admin.HandleFunc("/users/{public_id}/roles/{role}", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("roles:write")(s.UnassignRole))).Methods("DELETE")
+	admin.HandleFunc("/oauth-clients", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("clients:read")(s.ListOAuthClients))).Methods("GET")
+	admin.HandleFunc("/oauth-clients", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("clients:write")(s.CreateOAuthClient))).Methods("POST")
+	admin.HandleFunc("/oauth-clients/{client_id}", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("clients:read")(s.ShowOAuthClient))).Methods("GET")
+	admin.HandleFunc("/oauth-clients/{client_id}", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("clients:write")(s.UpdateOAuthClient))).Methods("PUT")
+	admin.HandleFunc("/oauth-clients/{client_id}", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("clients:write")(s.DeleteOAuthClient))).Methods("DELETE")
+	admin.HandleFunc("/oauth-clients/{client_id}/secret", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("clients:write")(s.RotateOAuthClientSecret))).Methods("POST")
+	admin.HandleFunc("/client-registration-tokens", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("clients:write")(s.CreateClientRegistrationToken))).Methods("POST")
+	admin.HandleFunc("/audit-events", middlewares.SetMiddlewareJSON(middlewares.RequirePermission("audit:read")(s.ListAuditEvents))).Methods("GET")
+	admin.HandleFunc("/users", middlewares.SetMiddlewareJSON(middlewares.RequireRole("admin")(s.ListUsers))).Methods("GET")
+	admin.HandleFunc("/users/{public_id}", middlewares.SetMiddlewareJSON(middlewares.RequireRole("admin")(s.ShowUserByPublicID))).Methods("GET")
+	admin.HandleFunc("/users/{public_id}", middlewares.SetMiddlewareJSON(middlewares.RequireRole("admin")(s.DeleteUserByPublicID))).Methods("DELETE")
+	admin.HandleFunc("/users/{public_id}/disable", middlewares.SetMiddlewareJSON(middlewares.RequireRole("admin")(s.DisableUser))).Methods("POST")
+	admin.HandleFunc("/users/{public_id}/enable", middlewares.SetMiddlewareJSON(middlewares.RequireRole("admin")(s.EnableUser))).Methods("POST")
+	admin.HandleFunc("/users/{public_id}/unlock", middlewares.SetMiddlewareJSON(middlewares.RequireRole("admin")(s.UnlockUser))).Methods("POST")
+	admin.HandleFunc("/users/{public_id}/force-password-reset", middlewares.SetMiddlewareJSON(middlewares.RequireRole("admin")(s.ForcePasswordReset))).Methods("POST")
 }
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+)
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+// ListSessions lists the devices the user is signed in on, marking the one
+// making the request.
+func (server *Server) ListSessions(w http.ResponseWriter, r *http.Request) {
+	info, err := jwt.ExtractTokenInfo(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	session := models.Session{}
+	sessions, err := session.FindUserSessions(server.DB, info.UserID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	found := []sessionResponse{}
+	for _, session := range *sessions {
+		found = append(found, sessionResponse{
+			ID:         session.PublicID,
+			Device:     session.Device,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			Current:    session.PublicID == info.SessionID,
+		})
+	}
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), struct {
+		Sessions []sessionResponse `json:"sessions"`
+	}{
+		Sessions: found,
+	})
+}
+
+// RevokeSession signs the user out of one of their sessions, which may be
+// the current one.
+func (server *Server) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	sessionID := mux.Vars(r)["id"]
+
+	session := models.Session{}
+	err = session.RevokeSession(server.DB, tokenID, sessionID)
+	if err == models.ErrSessionNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	user := models.User{}
+	if server.DB.Debug().Model(models.User{}).Where("id = ?", tokenID).Take(&user).Error == nil {
+		server.audit(r, auditSuccess(models.AuditSessionRevoke, sessionID), &user)
+	}
+
+	responses.JSON(w, http.StatusOK, true, "session revoked", nil)
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/middlewares"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// createAccessToken issues an access token for user. grant names the
+// audience, session and, for OAuth clients, the client and scope; the rest
+// is filled in from user. Roles and permissions are left out of tokens for
+// OAuth clients, which only get their scope.
+func (server *Server) createAccessToken(user *models.User, grant jwt.Grant) (string, error) {
+	publicID, err := crypto.Encrypt(strconv.Itoa(int(user.ID)), os.Getenv("APP_KEY"))
+	if err != nil {
+		return "", err
+	}
+
+	grant.UserPublicID = publicID
+	grant.Subject = user.PublicID
+	grant.EmailVerified = user.EmailVerifiedAt != nil
+	if grant.ClientID != "" {
+		return jwt.CreateToken(grant)
+	}
+
+	roles, err := user.FindUserRoles(server.DB, user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	permissions, err := user.FindUserPermissions(server.DB, user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	if !grant.EmailVerified && models.EmailVerificationPolicy() == models.EmailVerificationRestrict {
+		roles, permissions = nil, nil
+	}
+
+	grant.Roles = roles
+	grant.Permissions = permissions
+
+	return jwt.CreateToken(grant)
+}
+
+// createTokens starts a session for user on the device of r and issues its
+// access token and first refresh token.
+func (server *Server) createTokens(r *http.Request, user *models.User, audience string) (tokenPair, error) {
+	audience, err := jwt.Audience(audience)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	session := models.Session{}
+	_, err = session.SaveSession(server.DB, user.ID, middlewares.ClientIP(r), r.UserAgent())
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	token, err := server.createAccessToken(user, jwt.Grant{Audience: audience, SessionID: session.PublicID})
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	// the refresh tokens of a session form its family
+	refreshToken := models.RefreshToken{}
+	plainRefreshToken, err := refreshToken.SaveRefreshToken(server.DB, user.ID, audience, session.PublicID, "", "")
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	return tokenPair{
+		Token:        token,
+		RefreshToken: plainRefreshToken,
+		ExpiresIn:    int(jwt.TokenLifetime(audience).Seconds()),
+	}, nil
+}
+
+func (server *Server) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if request.RefreshToken == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("required refresh_token"))
+		return
+	}
+
+	refreshToken := models.RefreshToken{}
+	rotatedToken, err := refreshToken.RotateRefreshToken(server.DB, request.RefreshToken, "")
+	switch err {
+	case nil:
+	case models.ErrInvalidRefreshToken, models.ErrExpiredRefreshToken, models.ErrReusedRefreshToken:
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	default:
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", refreshToken.UserID).Take(&user).Error
+	if err == nil {
+		err = user.CanSignIn()
+	}
+	if err != nil {
+		refreshToken.RevokeRefreshTokenFamily(server.DB, refreshToken.FamilyID)
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	audience, err := jwt.Audience(refreshToken.Audience)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	token, err := server.createAccessToken(&user, jwt.Grant{Audience: audience, SessionID: refreshToken.FamilyID})
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	session := models.Session{}
+	err = session.TouchSession(server.DB, refreshToken.FamilyID, middlewares.ClientIP(r), time.Now())
+	if err != nil {
+		log.Printf("session %s: %v", refreshToken.FamilyID, err)
+	}
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), tokenPair{
+		Token:        token,
+		RefreshToken: rotatedToken,
+		ExpiresIn:    int(jwt.TokenLifetime(audience).Seconds()),
+	})
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"github.com/norfabagas/auth-global/api/responses"
 	"github.com/norfabagas/auth-global/api/utils/crypto"
 	"github.com/norfabagas/auth-global/api/utils/formatting"
+	"github.com/norfabagas/auth-global/api/utils/passwordpolicy"
 	"github.com/norfabagas/auth-global/api/utils/smtp"
 )
 
@@ -33,16 +35,27 @@ func (server *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 	user.Prepare()
 	err = user.Validate("register")
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		respondValidationError(w, err)
 		return
 	}
 	userCreated, err := user.SaveUser(server.DB)
 	if err != nil {
 		formattedError := formatting.FormatError(err.Error())
+		event := auditFailure(models.AuditRegister, "", formattedError)
+		event.TargetEmail = user.Email
+		server.audit(r, event, nil)
 		responses.ERROR(w, http.StatusInternalServerError, formattedError)
 		return
 	}
 
+	server.audit(r, auditSuccess(models.AuditRegister, ""), userCreated)
+
+	err = server.sendVerificationEmail(r, userCreated)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
 	w.Header().Set("Location", fmt.Sprintf("%s%s%d", r.Host, r.RequestURI, userCreated.ID))
 	responses.JSON(w, http.StatusCreated, true, http.StatusText(http.StatusCreated), struct {
 		Name      string    `json:"name"`
@@ -80,15 +93,19 @@ func (server *Server) ShowUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), struct {
-		PublicID   string    `json:"public_id"`
-		Name       string    `json:"name"`
-		Email      string    `json:"email"`
-		LastUpdate time.Time `json:"last_update"`
+		PublicID        string     `json:"public_id"`
+		Name            string     `json:"name"`
+		Email           string     `json:"email"`
+		EmailVerifiedAt *time.Time `json:"email_verified_at"`
+		TOTPEnabledAt   *time.Time `json:"totp_enabled_at"`
+		LastUpdate      time.Time  `json:"last_update"`
 	}{
-		PublicID:   user.PublicID,
-		Name:       name,
-		Email:      user.Email,
-		LastUpdate: user.UpdatedAt,
+		PublicID:        user.PublicID,
+		Name:            name,
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		TOTPEnabledAt:   user.TOTPEnabledAt,
+		LastUpdate:      user.UpdatedAt,
 	})
 }
 
@@ -124,6 +141,8 @@ func (server *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	server.audit(r, auditSuccess(models.AuditProfileUpdate, "name"), updatedUser)
+
 	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), struct {
 		PublicID    string    `json:"public_id"`
 		Email       string    `json:"email"`
@@ -145,8 +164,15 @@ func (server *Server) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := models.User{}
-	json.Unmarshal(body, &user)
+	request := struct {
+		CurrentPassword string `json:"current_password"`
+		Password        string `json:"password"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
 
 	tokenID, err := jwt.ExtractTokenID(r)
 	if err != nil {
@@ -154,19 +180,52 @@ func (server *Server) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := models.User{Password: request.Password}
 	user.Prepare()
 	err = user.Validate("password")
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
+	if request.CurrentPassword == "" {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("required current_password"))
+		return
+	}
+
+	account := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", tokenID).Take(&account).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = models.VerifyPassword(account.Password, request.CurrentPassword)
+	if err != nil {
+		err = errors.New("incorrect current password")
+		server.audit(r, auditFailure(models.AuditPasswordChange, "", err), &account)
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = account.ValidatePassword(user.Password)
+	if err != nil {
+		respondValidationError(w, err)
+		return
+	}
 
 	changedUser, err := user.ChangePassword(server.DB, tokenID, user.Password)
+	if err == models.ErrPasswordReused {
+		server.audit(r, auditFailure(models.AuditPasswordChange, "", err), &account)
+		respondValidationError(w, err)
+		return
+	}
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	server.audit(r, auditSuccess(models.AuditPasswordChange, ""), changedUser)
+
 	notify := keys.Get("notify")
 	if notify != "" && notify == "true" {
 		subject := "New Password Change!"
@@ -184,3 +243,21 @@ func (server *Server) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		PasswordChangedAt: changedUser.UpdatedAt,
 	})
 }
+
+// respondValidationError answers invalid input, listing every failed rule
+// when the password policy rejected the password.
+func respondValidationError(w http.ResponseWriter, err error) {
+	policyError, ok := err.(*passwordpolicy.Error)
+	if !ok {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusUnprocessableEntity, false, http.StatusText(http.StatusUnprocessableEntity), struct {
+		Error      string                     `json:"error"`
+		Violations []passwordpolicy.Violation `json:"violations"`
+	}{
+		Error:      policyError.Error(),
+		Violations: policyError.Violations,
+	})
+}
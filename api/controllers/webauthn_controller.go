@@ -0,0 +1,365 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/models"
+	"github.com/norfabagas/auth-global/api/responses"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+	"github.com/norfabagas/auth-global/api/webauthn"
+)
+
+var errWebAuthnNotConfigured = errors.New("webauthn is not configured")
+
+func (server *Server) BeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	if server.RelyingParty == nil {
+		responses.ERROR(w, http.StatusNotImplemented, errWebAuthnNotConfigured)
+		return
+	}
+
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", tokenID).Take(&user).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	name, err := crypto.Decrypt(user.Name, os.Getenv("APP_KEY"))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// registering the same authenticator twice is refused by the browser
+	exclude, err := server.credentialDescriptors(user.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	challenge := models.WebAuthnChallenge{}
+	value, err := challenge.SaveWebAuthnChallenge(server.DB, models.CeremonyRegistration, &user.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	options := server.RelyingParty.CreationOptions(value, webauthn.UserEntity{
+		ID:          []byte(user.PublicID),
+		Name:        user.Email,
+		DisplayName: name,
+	}, exclude)
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), struct {
+		PublicKey webauthn.CreationOptions `json:"publicKey"`
+	}{
+		PublicKey: options,
+	})
+}
+
+func (server *Server) FinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	if server.RelyingParty == nil {
+		responses.ERROR(w, http.StatusNotImplemented, errWebAuthnNotConfigured)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Name       string                       `json:"name"`
+		Credential webauthn.AttestationResponse `json:"credential"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	value, err := request.Credential.Challenge()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	challenge := models.WebAuthnChallenge{}
+	found, err := challenge.ConsumeWebAuthnChallenge(server.DB, models.CeremonyRegistration, value)
+	if err == nil && (found.UserID == nil || *found.UserID != tokenID) {
+		err = models.ErrInvalidWebAuthnChallenge
+	}
+	if err == models.ErrInvalidWebAuthnChallenge {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	credential, err := server.RelyingParty.VerifyRegistration(value, &request.Credential)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	webAuthnCredential := models.NewWebAuthnCredential(tokenID, request.Name, credential)
+	credentialCreated, err := webAuthnCredential.SaveWebAuthnCredential(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusCreated, true, "passkey registered", credentialCreated)
+}
+
+func (server *Server) BeginWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	if server.RelyingParty == nil {
+		responses.ERROR(w, http.StatusNotImplemented, errWebAuthnNotConfigured)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// without an email the authenticator offers its discoverable credentials
+	request := struct {
+		Email string `json:"email"`
+	}{}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	allow := []webauthn.CredentialDescriptor{}
+	if request.Email != "" {
+		user := models.User{}
+		err = server.DB.Debug().Model(models.User{}).Where("email = ?", models.EscapeAndTrimString(request.Email)).Take(&user).Error
+		if err == nil {
+			allow, err = server.credentialDescriptors(user.ID)
+			if err != nil {
+				responses.ERROR(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+	}
+
+	challenge := models.WebAuthnChallenge{}
+	value, err := challenge.SaveWebAuthnChallenge(server.DB, models.CeremonyLogin, nil)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), struct {
+		PublicKey webauthn.RequestOptions `json:"publicKey"`
+	}{
+		PublicKey: server.RelyingParty.RequestOptions(value, allow),
+	})
+}
+
+func (server *Server) FinishWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	if server.RelyingParty == nil {
+		responses.ERROR(w, http.StatusNotImplemented, errWebAuthnNotConfigured)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	request := struct {
+		Credential webauthn.AssertionResponse `json:"credential"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	audience, err := jwt.Audience(r.URL.Query().Get("audience"))
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	value, err := request.Credential.Challenge()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	challenge := models.WebAuthnChallenge{}
+	_, err = challenge.ConsumeWebAuthnChallenge(server.DB, models.CeremonyLogin, value)
+	if err == models.ErrInvalidWebAuthnChallenge {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	webAuthnCredential := models.WebAuthnCredential{}
+	found, err := webAuthnCredential.FindWebAuthnCredential(server.DB, models.EncodeCredentialID(request.Credential.RawID))
+	if err == models.ErrWebAuthnCredentialNotFound {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", found.UserID).Take(&user).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+	if userHandle := request.Credential.Response.UserHandle; len(userHandle) > 0 && string(userHandle) != user.PublicID {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("user handle does not match the credential"))
+		return
+	}
+
+	credential, err := found.Credential()
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	authData, err := server.RelyingParty.VerifyAssertion(value, &request.Credential, credential)
+	if err != nil {
+		server.audit(r, auditFailure(models.AuditLogin, loginMethodPasskey, err), &user)
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	err = webAuthnCredential.UseWebAuthnCredential(server.DB, found.ID, authData.SignCount)
+	if err == webauthn.ErrSignCountRegression {
+		server.audit(r, auditFailure(models.AuditLogin, loginMethodPasskey, err), &user)
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = user.CanSignIn()
+	if err != nil {
+		server.audit(r, auditFailure(models.AuditLogin, loginMethodPasskey, err), &user)
+	}
+	if err == models.ErrUserDisabled || err == models.ErrPasswordResetRequired {
+		responses.ERROR(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// a user verified passkey already is a second factor
+	if user.TOTPEnabled() && !authData.UserVerified() {
+		server.respondMFAChallenge(w, &user)
+		return
+	}
+
+	server.respondSignIn(w, r, &user, audience, loginMethodPasskey)
+}
+
+func (server *Server) ListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	webAuthnCredential := models.WebAuthnCredential{}
+	credentials, err := webAuthnCredential.FindUserWebAuthnCredentials(server.DB, tokenID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, http.StatusText(http.StatusOK), credentials)
+}
+
+func (server *Server) DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, models.ErrWebAuthnCredentialNotFound)
+		return
+	}
+
+	webAuthnCredential := models.WebAuthnCredential{}
+	err = webAuthnCredential.DeleteWebAuthnCredential(server.DB, tokenID, uint32(id))
+	if err == models.ErrWebAuthnCredentialNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, true, "passkey deleted", nil)
+}
+
+func (server *Server) credentialDescriptors(userID uint32) ([]webauthn.CredentialDescriptor, error) {
+	webAuthnCredential := models.WebAuthnCredential{}
+	credentials, err := webAuthnCredential.FindUserWebAuthnCredentials(server.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors := []webauthn.CredentialDescriptor{}
+	for _, found := range *credentials {
+		credential, err := found.Credential()
+		if err != nil {
+			return nil, err
+		}
+		descriptors = append(descriptors, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         credential.ID,
+			Transports: credential.Transports,
+		})
+	}
+
+	return descriptors, nil
+}
@@ -0,0 +1,118 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+// Purposes of action tokens. Each purpose is its own audience, so an action
+// token is never accepted as an access token or for another action.
+const (
+	PurposeVerifyEmail = "verify-email"
+	PurposeMFA         = "mfa"
+	PurposeMagicLink   = "magic-link"
+	PurposeUnlock      = "unlock"
+	// PurposeBrowserSession tokens sign the browser in to the OAuth
+	// authorization endpoint, PurposeOAuthConsent tokens protect its consent
+	// form. Both belong to a session, see CreateSessionActionToken.
+	PurposeBrowserSession = "browser-session"
+	PurposeOAuthConsent   = "oauth-consent"
+	// PurposeClientRegistration tokens are the initial access tokens of
+	// dynamic client registration, issued by an admin.
+	PurposeClientRegistration = "client-registration"
+)
+
+// MaxActionTokenLifetime is the longest an action token may be issued for.
+// Superseded signing keys keep verifying at least this long, see
+// MaxTokenLifetime.
+const MaxActionTokenLifetime = 24 * time.Hour
+
+var ErrActionTokenLifetime = errors.New("action token lifetime is too long")
+
+// ActionToken is a short-lived token for a single action, usually delivered
+// as a link by email.
+type ActionToken struct {
+	ID        string
+	UserID    uint32
+	Subject   string
+	SessionID string
+	ExpiresAt time.Time
+}
+
+func actionAudience(purpose string) string {
+	return "action:" + purpose
+}
+
+func CreateActionToken(purpose, userPublicID, subject string, lifetime time.Duration) (string, error) {
+	return createActionToken(purpose, userPublicID, subject, "", lifetime)
+}
+
+// CreateSessionActionToken issues an action token that is rejected as soon
+// as the session sessionID is revoked.
+func CreateSessionActionToken(purpose, userPublicID, subject, sessionID string, lifetime time.Duration) (string, error) {
+	return createActionToken(purpose, userPublicID, subject, sessionID, lifetime)
+}
+
+func createActionToken(purpose, userPublicID, subject, sessionID string, lifetime time.Duration) (string, error) {
+	if lifetime > MaxActionTokenLifetime {
+		return "", ErrActionTokenLifetime
+	}
+
+	jti, err := crypto.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	claims["jti"] = jti
+	claims["iss"] = currentConfig().Issuer
+	claims["sub"] = subject
+	claims["aud"] = actionAudience(purpose)
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(lifetime).Unix()
+	claims["user_id"] = userPublicID
+	if sessionID != "" {
+		claims["sid"] = sessionID
+	}
+
+	return signToken(claims)
+}
+
+func ParseActionToken(tokenString, purpose string) (*ActionToken, error) {
+	claims, userID, err := verifyToken(tokenString, []string{actionAudience(purpose)})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ActionToken{
+		ID:        claimString(claims, "jti"),
+		UserID:    userID,
+		Subject:   claimString(claims, "sub"),
+		SessionID: claimString(claims, "sid"),
+		ExpiresAt: claimTime(claims, "exp"),
+	}, nil
+}
+
+// ConsumeActionToken parses the token and denylists it, so it can only be
+// used once.
+func ConsumeActionToken(tokenString, purpose string) (*ActionToken, error) {
+	token, err := ParseActionToken(tokenString, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if token.ID == "" {
+		return nil, errors.New("invalid token")
+	}
+
+	err = revocations.revoke(token.ID, token.UserID, token.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
@@ -0,0 +1,180 @@
+package jwt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config controls the registered claims stamped on and required from
+// every token.
+type Config struct {
+	Issuer          string
+	Audiences       []string
+	DefaultAudience string
+	// ClientAudience is the audience of tokens issued to OAuth clients for a
+	// user; it is kept apart from Audiences so first party services do not
+	// accept them.
+	ClientAudience  string
+	DefaultLifetime time.Duration
+	Lifetimes       map[string]time.Duration
+	Leeway          time.Duration
+}
+
+var (
+	configMu sync.RWMutex
+	config   = Config{
+		Issuer:          "auth-global",
+		Audiences:       []string{"auth-global"},
+		DefaultAudience: "auth-global",
+		ClientAudience:  "auth-global/oauth",
+		DefaultLifetime: 15 * time.Minute,
+		Lifetimes:       map[string]time.Duration{},
+		Leeway:          30 * time.Second,
+	}
+)
+
+// LoadConfig reads the token configuration from the environment:
+//
+//	JWT_ISSUER              iss claim, defaults to auth-global
+//	JWT_AUDIENCES           comma separated accepted audiences
+//	JWT_DEFAULT_AUDIENCE    audience used when none is requested
+//	JWT_CLIENT_AUDIENCE     audience of OAuth client tokens, defaults to <issuer>/oauth
+//	JWT_DEFAULT_LIFETIME    access token lifetime, defaults to 15m
+//	JWT_AUDIENCE_LIFETIMES  per audience lifetimes, e.g. web=15m,cli=1h
+//	JWT_LEEWAY              allowed clock skew, defaults to 30s
+func LoadConfig() error {
+	loaded := Config{
+		Issuer:          os.Getenv("JWT_ISSUER"),
+		DefaultAudience: os.Getenv("JWT_DEFAULT_AUDIENCE"),
+		ClientAudience:  os.Getenv("JWT_CLIENT_AUDIENCE"),
+		DefaultLifetime: 15 * time.Minute,
+		Lifetimes:       map[string]time.Duration{},
+		Leeway:          30 * time.Second,
+	}
+	if loaded.Issuer == "" {
+		loaded.Issuer = "auth-global"
+	}
+
+	for _, audience := range strings.Split(os.Getenv("JWT_AUDIENCES"), ",") {
+		if audience = strings.TrimSpace(audience); audience != "" {
+			loaded.Audiences = append(loaded.Audiences, audience)
+		}
+	}
+	if len(loaded.Audiences) == 0 {
+		loaded.Audiences = []string{loaded.Issuer}
+	}
+	if loaded.DefaultAudience == "" {
+		loaded.DefaultAudience = loaded.Audiences[0]
+	}
+	if !contains(loaded.Audiences, loaded.DefaultAudience) {
+		return fmt.Errorf("JWT_DEFAULT_AUDIENCE %q is not listed in JWT_AUDIENCES", loaded.DefaultAudience)
+	}
+	if loaded.ClientAudience == "" {
+		loaded.ClientAudience = loaded.Issuer + "/oauth"
+	}
+	if contains(loaded.Audiences, loaded.ClientAudience) {
+		return fmt.Errorf("JWT_CLIENT_AUDIENCE %q must not be listed in JWT_AUDIENCES", loaded.ClientAudience)
+	}
+
+	var err error
+	if value := os.Getenv("JWT_DEFAULT_LIFETIME"); value != "" {
+		if loaded.DefaultLifetime, err = time.ParseDuration(value); err != nil {
+			return fmt.Errorf("invalid JWT_DEFAULT_LIFETIME: %v", err)
+		}
+	}
+	if value := os.Getenv("JWT_LEEWAY"); value != "" {
+		if loaded.Leeway, err = time.ParseDuration(value); err != nil {
+			return fmt.Errorf("invalid JWT_LEEWAY: %v", err)
+		}
+	}
+
+	for _, pair := range strings.Split(os.Getenv("JWT_AUDIENCE_LIFETIMES"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || !contains(loaded.Audiences, parts[0]) && parts[0] != loaded.ClientAudience {
+			return fmt.Errorf("invalid JWT_AUDIENCE_LIFETIMES entry %q", pair)
+		}
+		lifetime, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid JWT_AUDIENCE_LIFETIMES entry %q: %v", pair, err)
+		}
+		loaded.Lifetimes[parts[0]] = lifetime
+	}
+
+	SetConfig(loaded)
+	return nil
+}
+
+func SetConfig(c Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	config = c
+}
+
+func currentConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	return config
+}
+
+// Audience resolves a requested audience, falling back to the default one.
+func Audience(requested string) (string, error) {
+	c := currentConfig()
+	if requested == "" {
+		return c.DefaultAudience, nil
+	}
+	if !contains(c.Audiences, requested) {
+		return "", fmt.Errorf("unknown audience %q", requested)
+	}
+
+	return requested, nil
+}
+
+// ClientAudience returns the audience of tokens issued to OAuth clients.
+func ClientAudience() string {
+	return currentConfig().ClientAudience
+}
+
+// TokenLifetime returns the access token lifetime for audience.
+func TokenLifetime(audience string) time.Duration {
+	c := currentConfig()
+	if lifetime, ok := c.Lifetimes[audience]; ok {
+		return lifetime
+	}
+
+	return c.DefaultLifetime
+}
+
+// MaxTokenLifetime is the longest a token signed now can remain valid:
+// access and ID tokens, and action tokens such as emailed links or the
+// browser session of the authorization endpoint.
+func MaxTokenLifetime() time.Duration {
+	c := currentConfig()
+	max := MaxActionTokenLifetime
+	if c.DefaultLifetime > max {
+		max = c.DefaultLifetime
+	}
+	for _, lifetime := range c.Lifetimes {
+		if lifetime > max {
+			max = lifetime
+		}
+	}
+
+	return max + c.Leeway
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
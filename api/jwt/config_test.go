@@ -0,0 +1,40 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxTokenLifetime(t *testing.T) {
+	defer SetConfig(currentConfig())
+
+	tests := []struct {
+		name        string
+		config      Config
+		wantAtLeast time.Duration
+	}{
+		{
+			name:        "action tokens outlive access tokens",
+			config:      Config{DefaultLifetime: 15 * time.Minute, Leeway: 30 * time.Second},
+			wantAtLeast: MaxActionTokenLifetime + 30*time.Second,
+		},
+		{
+			name:        "long audience lifetime",
+			config:      Config{DefaultLifetime: 15 * time.Minute, Lifetimes: map[string]time.Duration{"cli": 48 * time.Hour}},
+			wantAtLeast: 48 * time.Hour,
+		},
+	}
+	for _, test := range tests {
+		SetConfig(test.config)
+		if got := MaxTokenLifetime(); got < test.wantAtLeast {
+			t.Errorf("%s: MaxTokenLifetime() = %v, want at least %v", test.name, got, test.wantAtLeast)
+		}
+	}
+}
+
+func TestCreateActionTokenLifetime(t *testing.T) {
+	_, err := CreateActionToken(PurposeUnlock, "", "", MaxActionTokenLifetime+time.Second)
+	if err != ErrActionTokenLifetime {
+		t.Errorf("got %v, want %v", err, ErrActionTokenLifetime)
+	}
+}
@@ -0,0 +1,123 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys downstream services use to verify tokens.
+func JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range keys.published(time.Now()) {
+		jwk, err := publicJWK(key.PublicKey)
+		if err != nil {
+			continue
+		}
+		jwk.KeyID = key.ID
+		jwk.Use = "sig"
+		jwk.Algorithm = key.Method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func publicJWK(publicKey interface{}) (JSONWebKey, error) {
+	switch public := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{
+			KeyType: "RSA",
+			N:       encodeBase64URL(public.N.Bytes()),
+			E:       encodeBase64URL(big.NewInt(int64(public.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		return JSONWebKey{
+			KeyType: "EC",
+			Curve:   public.Curve.Params().Name,
+			X:       encodeBase64URL(padBytes(public.X.Bytes(), size)),
+			Y:       encodeBase64URL(padBytes(public.Y.Bytes(), size)),
+		}, nil
+	case ed25519.PublicKey:
+		return JSONWebKey{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       encodeBase64URL(public),
+		}, nil
+	}
+
+	return JSONWebKey{}, fmt.Errorf("unsupported public key type %T", publicKey)
+}
+
+// Thumbprint computes the RFC 7638 thumbprint, used as the key ID.
+func (jwk JSONWebKey) Thumbprint() (string, error) {
+	var members interface{}
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Curve, jwk.KeyType, jwk.X, jwk.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(b)
+
+	return encodeBase64URL(hash[:]), nil
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
@@ -0,0 +1,166 @@
+package jwt
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+type KeyState string
+
+const (
+	// KeyStateActive keys sign tokens once their activation date is reached.
+	KeyStateActive KeyState = "active"
+	// KeyStateVerifyOnly keys no longer sign but still verify until retired.
+	KeyStateVerifyOnly KeyState = "verify-only"
+	// KeyStateRetired keys are neither published nor accepted.
+	KeyStateRetired KeyState = "retired"
+)
+
+func (key *SigningKey) CanSign(now time.Time) bool {
+	return key.State == KeyStateActive && !now.Before(key.ActivatesAt) && key.CanVerify(now)
+}
+
+func (key *SigningKey) CanVerify(now time.Time) bool {
+	return key.State != KeyStateRetired && (key.RetiresAt == nil || now.Before(*key.RetiresAt))
+}
+
+type keyring struct {
+	mu   sync.RWMutex
+	keys []*SigningKey
+}
+
+// keys is empty when no asymmetric key is configured, in which case tokens
+// are signed HS256 with API_SECRET. They still are after the first key is
+// rotated in, until it activates.
+var keys = &keyring{}
+
+// SetSigningKeys replaces the keyring used to sign and verify tokens.
+func SetSigningKeys(signingKeys []*SigningKey) {
+	sorted := make([]*SigningKey, len(signingKeys))
+	copy(sorted, signingKeys)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ActivatesAt.After(sorted[j].ActivatesAt)
+	})
+
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+
+	keys.keys = sorted
+}
+
+// signing returns the most recently activated key allowed to sign.
+func (k *keyring) signing(now time.Time) *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.CanSign(now) {
+			return key
+		}
+	}
+	return nil
+}
+
+func (k *keyring) verifying(kid string, now time.Time) *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.ID == kid && key.CanVerify(now) {
+			return key
+		}
+	}
+	return nil
+}
+
+// published returns every key a verifier may encounter, including keys
+// that are not active yet so caches pick them up ahead of the switch.
+func (k *keyring) published(now time.Time) []*SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	published := []*SigningKey{}
+	for _, key := range k.keys {
+		if key.CanVerify(now) {
+			published = append(published, key)
+		}
+	}
+	return published
+}
+
+func (k *keyring) empty() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return len(k.keys) == 0
+}
+
+// firstActivation returns when the oldest key of the keyring activates, or
+// false when the keyring is empty.
+func (k *keyring) firstActivation() (time.Time, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.keys) == 0 {
+		return time.Time{}, false
+	}
+	return k.keys[len(k.keys)-1].ActivatesAt, true
+}
+
+// signsHMAC reports whether tokens are signed HS256 with API_SECRET: until
+// the first key of the keyring activates, so rotating in the first key does
+// not leave a window without any key to sign with.
+func (k *keyring) signsHMAC(now time.Time) bool {
+	first, ok := k.firstActivation()
+	return !ok || now.Before(first)
+}
+
+// verifiesHMAC reports whether HS256 tokens are accepted: while they are
+// signed, and afterwards until the last of them has expired.
+func (k *keyring) verifiesHMAC(now time.Time) bool {
+	first, ok := k.firstActivation()
+	return !ok || now.Before(first.Add(MaxTokenLifetime()))
+}
+
+func signToken(claims jwt.MapClaims) (string, error) {
+	if keys.signsHMAC(time.Now()) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(os.Getenv("API_SECRET")))
+	}
+
+	signingKey := keys.signing(time.Now())
+	if signingKey == nil {
+		return "", fmt.Errorf("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(signingKey.Method, claims)
+	token.Header["kid"] = signingKey.ID
+	return token.SignedString(signingKey.PrivateKey)
+}
+
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if !keys.verifiesHMAC(time.Now()) {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(os.Getenv("API_SECRET")), nil
+	}
+	if keys.empty() {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	verifyingKey := keys.verifying(kid, time.Now())
+	if verifyingKey == nil {
+		return nil, fmt.Errorf("Unknown signing key: %v", token.Header["kid"])
+	}
+	if token.Method.Alg() != verifyingKey.Method.Alg() {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+	return verifyingKey.PublicKey, nil
+}
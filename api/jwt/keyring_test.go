@@ -0,0 +1,96 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// tokenAlgorithm returns the alg header of token.
+func tokenAlgorithm(t *testing.T, token string) string {
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Method.Alg()
+}
+
+func TestRotateFromEmptyKeyring(t *testing.T) {
+	useTestConfig(t)
+	defer SetSigningKeys(nil)
+
+	SetSigningKeys(nil)
+	before, err := CreateToken(testGrant(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first rotated key is published but does not sign yet
+	key, err := GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.ID = "first"
+	key.State = KeyStateActive
+	key.ActivatesAt = time.Now().Add(10 * time.Minute)
+	SetSigningKeys([]*SigningKey{key})
+
+	during, err := CreateToken(testGrant(t))
+	if err != nil {
+		t.Fatalf("no token can be issued before the first key activates: %v", err)
+	}
+	if alg := tokenAlgorithm(t, during); alg != "HS256" {
+		t.Errorf("token signed with %s before the first key activates", alg)
+	}
+	for _, token := range []string{before, during} {
+		if _, err := ParseToken(token); err != nil {
+			t.Errorf("HS256 token rejected before the first key activates: %v", err)
+		}
+	}
+
+	// once it activates, it signs and the HS256 tokens keep verifying
+	key.ActivatesAt = time.Now().Add(-time.Second)
+	SetSigningKeys([]*SigningKey{key})
+
+	after, err := CreateToken(testGrant(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alg := tokenAlgorithm(t, after); alg != "ES256" {
+		t.Errorf("token signed with %s after the first key activated", alg)
+	}
+	for _, token := range []string{during, after} {
+		if _, err := ParseToken(token); err != nil {
+			t.Errorf("token rejected after the first key activated: %v", err)
+		}
+	}
+
+	// until the last HS256 token has expired
+	key.ActivatesAt = time.Now().Add(-MaxTokenLifetime())
+	SetSigningKeys([]*SigningKey{key})
+	if _, err := ParseToken(during); err == nil {
+		t.Error("HS256 token accepted after every HS256 token has expired")
+	}
+}
+
+func TestNoSigningKey(t *testing.T) {
+	useTestConfig(t)
+	defer SetSigningKeys(nil)
+
+	// a retired keyring does not fall back to HS256
+	key, err := GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	retiredAt := time.Now().Add(-time.Minute)
+	key.ID = "retired"
+	key.State = KeyStateRetired
+	key.ActivatesAt = time.Now().Add(-time.Hour)
+	key.RetiresAt = &retiredAt
+	SetSigningKeys([]*SigningKey{key})
+
+	if _, err := CreateToken(testGrant(t)); err == nil {
+		t.Error("token issued without an active key")
+	}
+}
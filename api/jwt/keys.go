@@ -0,0 +1,140 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// SigningKey is an asymmetric key used to sign tokens. Only its public half
+// is ever published.
+type SigningKey struct {
+	ID          string
+	Method      jwt.SigningMethod
+	PrivateKey  interface{}
+	PublicKey   interface{}
+	State       KeyState
+	ActivatesAt time.Time
+	RetiresAt   *time.Time
+}
+
+// ReadPrivateKeyFile reads a PEM encoded RSA, ECDSA or Ed25519 private key.
+func ReadPrivateKeyFile(path string) (*SigningKey, error) {
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePrivateKey(pemBytes)
+}
+
+func ParsePrivateKey(pemBytes []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var privateKey interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSigningKey(privateKey)
+}
+
+func NewSigningKey(privateKey interface{}) (*SigningKey, error) {
+	key := &SigningKey{PrivateKey: privateKey}
+
+	switch private := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		key.Method = jwt.SigningMethodRS256
+		key.PublicKey = &private.PublicKey
+	case *ecdsa.PrivateKey:
+		switch private.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		case elliptic.P521():
+			key.Method = jwt.SigningMethodES512
+		default:
+			return nil, errors.New("unsupported elliptic curve")
+		}
+		key.PublicKey = &private.PublicKey
+	case ed25519.PrivateKey:
+		key.Method = SigningMethodEd25519
+		key.PublicKey = private.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+
+	jwk, err := publicJWK(key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	key.ID, err = jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// GenerateSigningKey creates a new private key for the given JWS algorithm.
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var privateKey interface{}
+	var err error
+	switch algorithm {
+	case "RS256":
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		privateKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		privateKey, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSigningKey(privateKey)
+}
+
+// MarshalPrivateKey encodes the private key as a PKCS #8 PEM block.
+func (key *SigningKey) MarshalPrivateKey() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,93 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+// IDToken describes an OpenID Connect ID token. The email and profile
+// claims are only included when their scope was granted.
+type IDToken struct {
+	Subject  string
+	ClientID string
+	Nonce    string
+	AuthTime time.Time
+
+	Email         string
+	EmailVerified bool
+	IncludeEmail  bool
+
+	Name           string
+	IncludeProfile bool
+}
+
+// ErrNoIDTokenKey is returned while no asymmetric key signs: an HS256 ID
+// token could only be checked with API_SECRET.
+var ErrNoIDTokenKey = errors.New("ID tokens need an asymmetric signing key")
+
+// IDTokensEnabled reports whether an asymmetric key signs right now, which
+// ID tokens require.
+func IDTokensEnabled() bool {
+	return keys.signing(time.Now()) != nil
+}
+
+// CreateIDToken issues an ID token for the client. It is addressed to the
+// client, so it is never accepted as an access token.
+func CreateIDToken(idToken IDToken) (string, error) {
+	if !IDTokensEnabled() {
+		return "", ErrNoIDTokenKey
+	}
+
+	jti, err := crypto.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	c := currentConfig()
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	claims["jti"] = jti
+	claims["iss"] = c.Issuer
+	claims["sub"] = idToken.Subject
+	claims["aud"] = idToken.ClientID
+	claims["azp"] = idToken.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(c.DefaultLifetime).Unix()
+	if idToken.Nonce != "" {
+		claims["nonce"] = idToken.Nonce
+	}
+	if !idToken.AuthTime.IsZero() {
+		claims["auth_time"] = idToken.AuthTime.Unix()
+	}
+	if idToken.IncludeEmail {
+		claims["email"] = idToken.Email
+		claims["email_verified"] = idToken.EmailVerified
+	}
+	if idToken.IncludeProfile {
+		claims["name"] = idToken.Name
+	}
+
+	return signToken(claims)
+}
+
+// Issuer is the iss claim of every token. OpenID Connect clients expect it
+// to be the URL of the service.
+func Issuer() string {
+	return currentConfig().Issuer
+}
+
+// SigningAlgorithms lists the asymmetric algorithms tokens may currently be
+// signed with. HS256 is never listed, clients cannot verify it.
+func SigningAlgorithms() []string {
+	algorithms := []string{}
+	for _, key := range keys.published(time.Now()) {
+		if !contains(algorithms, key.Method.Alg()) {
+			algorithms = append(algorithms, key.Method.Alg())
+		}
+	}
+
+	return algorithms
+}
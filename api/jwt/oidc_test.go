@@ -0,0 +1,48 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIDTokenNeedsAsymmetricKey(t *testing.T) {
+	useTestConfig(t)
+	defer SetSigningKeys(nil)
+
+	SetSigningKeys(nil)
+	if IDTokensEnabled() {
+		t.Error("ID tokens enabled with an empty keyring")
+	}
+	if _, err := CreateIDToken(IDToken{Subject: "user-7", ClientID: "client"}); err != ErrNoIDTokenKey {
+		t.Errorf("CreateIDToken = %v, want ErrNoIDTokenKey", err)
+	}
+	if algorithms := SigningAlgorithms(); len(algorithms) != 0 {
+		t.Errorf("SigningAlgorithms() = %v with an empty keyring", algorithms)
+	}
+
+	// a rotated key that is not active yet does not sign ID tokens either
+	key, err := GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.ID = "first"
+	key.State = KeyStateActive
+	key.ActivatesAt = time.Now().Add(10 * time.Minute)
+	SetSigningKeys([]*SigningKey{key})
+	if _, err := CreateIDToken(IDToken{Subject: "user-7", ClientID: "client"}); err != ErrNoIDTokenKey {
+		t.Errorf("CreateIDToken before the key activates = %v, want ErrNoIDTokenKey", err)
+	}
+
+	key.ActivatesAt = time.Now().Add(-time.Second)
+	SetSigningKeys([]*SigningKey{key})
+	idToken, err := CreateIDToken(IDToken{Subject: "user-7", ClientID: "client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alg := tokenAlgorithm(t, idToken); alg != "ES256" {
+		t.Errorf("ID token signed with %s", alg)
+	}
+	if algorithms := SigningAlgorithms(); len(algorithms) != 1 || algorithms[0] != "ES256" {
+		t.Errorf("SigningAlgorithms() = %v", algorithms)
+	}
+}
@@ -0,0 +1,114 @@
+package jwt
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RevocationStore persists revoked tokens so every instance of the service
+// sees a logout, including after a restart.
+type RevocationStore interface {
+	RevokeToken(jti string, userID uint32, expiresAt time.Time) error
+	RevokeAllTokens(userID uint32, revokedAt time.Time) error
+	// IsRevoked also rejects tokens of a revoked session, when sessionID is set.
+	IsRevoked(jti string, userID uint32, sessionID string, issuedAt time.Time) (bool, error)
+}
+
+type denylist struct {
+	mu         sync.Mutex
+	store      RevocationStore
+	tokens     map[string]time.Time
+	lastSweep  time.Time
+	sweepEvery time.Duration
+}
+
+var revocations = &denylist{
+	tokens:     map[string]time.Time{},
+	sweepEvery: time.Minute,
+}
+
+func SetRevocationStore(store RevocationStore) {
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+
+	revocations.store = store
+}
+
+// cache remembers a revoked jti until the token would have expired anyway.
+func (d *denylist) cache(jti string, expiresAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(d.lastSweep) > d.sweepEvery {
+		for key, expiry := range d.tokens {
+			if now.After(expiry) {
+				delete(d.tokens, key)
+			}
+		}
+		d.lastSweep = now
+	}
+
+	if expiresAt.After(now) {
+		d.tokens[jti] = expiresAt
+	}
+}
+
+func (d *denylist) cached(jti string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	expiry, ok := d.tokens[jti]
+	return ok && time.Now().Before(expiry)
+}
+
+func (d *denylist) getStore() RevocationStore {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.store
+}
+
+func (d *denylist) revoke(jti string, userID uint32, expiresAt time.Time) error {
+	if store := d.getStore(); store != nil {
+		if err := store.RevokeToken(jti, userID, expiresAt); err != nil {
+			return err
+		}
+	}
+	d.cache(jti, expiresAt)
+
+	return nil
+}
+
+func (d *denylist) revokeAll(userID uint32) error {
+	store := d.getStore()
+	if store == nil {
+		return errors.New("revocation store is not configured")
+	}
+
+	return store.RevokeAllTokens(userID, time.Now())
+}
+
+func (d *denylist) isRevoked(jti string, userID uint32, sessionID string, issuedAt, expiresAt time.Time) (bool, error) {
+	if jti != "" && d.cached(jti) {
+		return true, nil
+	}
+
+	store := d.getStore()
+	if store == nil {
+		return false, nil
+	}
+
+	revoked, err := store.IsRevoked(jti, userID, sessionID, issuedAt)
+	if err != nil {
+		return false, err
+	}
+	if revoked && jti != "" {
+		d.cache(jti, expiresAt)
+	}
+
+	return revoked, nil
+}
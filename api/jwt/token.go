@@ -2,8 +2,8 @@ package jwt
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"strconv"
@@ -14,16 +14,95 @@ import (
 	"github.com/norfabagas/auth-global/api/utils/crypto"
 )
 
-const TokenExpiryInHour = 24
+// Grant describes who a token is issued to and what it allows.
+type Grant struct {
+	// UserPublicID is the APP_KEY encrypted user ID carried in user_id.
+	UserPublicID  string
+	Subject       string
+	Audience      string
+	Roles         []string
+	Permissions   []string
+	EmailVerified bool
+	// SessionID ties the token to a sign in session, carried in sid.
+	SessionID string
+	// ClientID and Scope are set for tokens issued to OAuth clients. Such
+	// tokens are issued for the ClientAudience and never carry roles or
+	// permissions, the scope is all a client is granted.
+	ClientID string
+	Scope    string
+}
+
+func CreateToken(grant Grant) (string, error) {
+	jti, err := crypto.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
 
-func CreateToken(userPublicID string) (string, error) {
+	audience := ClientAudience()
+	if grant.ClientID == "" {
+		audience, err = Audience(grant.Audience)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	now := time.Now()
 	claims := jwt.MapClaims{}
 	claims["authorized"] = true
-	claims["exp"] = time.Now().Add(time.Hour * TokenExpiryInHour).Unix()
-	claims["user_id"] = userPublicID
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	claims["jti"] = jti
+	claims["iss"] = currentConfig().Issuer
+	claims["sub"] = grant.Subject
+	claims["aud"] = audience
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(TokenLifetime(audience)).Unix()
+	claims["user_id"] = grant.UserPublicID
+	claims["email_verified"] = grant.EmailVerified
+	if grant.SessionID != "" {
+		claims["sid"] = grant.SessionID
+	}
+	if grant.ClientID != "" {
+		claims["client_id"] = grant.ClientID
+		if grant.Scope != "" {
+			claims["scope"] = grant.Scope
+		}
+	} else {
+		claims["roles"] = nonNil(grant.Roles)
+		claims["permissions"] = nonNil(grant.Permissions)
+	}
+
+	return signToken(claims)
+}
 
-	return token.SignedString([]byte(os.Getenv("API_SECRET")))
+// CreateClientToken issues an access token to an OAuth client acting on
+// its own behalf (the client_credentials grant). Its sub is the client_id
+// and it carries no user_id, roles or permissions.
+func CreateClientToken(clientID, audience, scope string) (string, error) {
+	jti, err := crypto.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	audience, err = Audience(audience)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	claims["jti"] = jti
+	claims["iss"] = currentConfig().Issuer
+	claims["sub"] = clientID
+	claims["aud"] = audience
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(TokenLifetime(audience)).Unix()
+	claims["client_id"] = clientID
+	if scope != "" {
+		claims["scope"] = scope
+	}
+
+	return signToken(claims)
 }
 
 func ExtractToken(r *http.Request) string {
@@ -42,57 +121,254 @@ func ExtractToken(r *http.Request) string {
 	return ""
 }
 
-func ExtractTokenID(r *http.Request) (uint32, error) {
-	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("API_SECRET")), nil
-	})
+// ErrClientToken is returned for a token issued to an OAuth client where a
+// first party token is needed.
+var ErrClientToken = errors.New("token is issued to an OAuth client")
+
+// TokenInfo is the verified content of an access token. UserID is zero for
+// tokens issued to a client on its own behalf.
+type TokenInfo struct {
+	ID            string
+	UserID        uint32
+	Issuer        string
+	Subject       string
+	Audience      string
+	IssuedAt      time.Time
+	NotBefore     time.Time
+	ExpiresAt     time.Time
+	Scope         string
+	ClientID      string
+	Roles         []string
+	Permissions   []string
+	EmailVerified bool
+	SessionID     string
+}
+
+// ParseToken verifies tokenString, accepting first party tokens and tokens
+// issued to OAuth clients alike. Endpoints meant for clients check the
+// scope of the latter.
+func ParseToken(tokenString string) (*TokenInfo, error) {
+	claims, userID, err := parseTokenString(tokenString)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	return &TokenInfo{
+		ID:            claimString(claims, "jti"),
+		UserID:        userID,
+		Issuer:        claimString(claims, "iss"),
+		Subject:       claimString(claims, "sub"),
+		Audience:      claimString(claims, "aud"),
+		IssuedAt:      claimTime(claims, "iat"),
+		NotBefore:     claimTime(claims, "nbf"),
+		ExpiresAt:     claimTime(claims, "exp"),
+		Scope:         claimString(claims, "scope"),
+		ClientID:      claimString(claims, "client_id"),
+		Roles:         claimStrings(claims, "roles"),
+		Permissions:   claimStrings(claims, "permissions"),
+		EmailVerified: claimBool(claims, "email_verified"),
+		SessionID:     claimString(claims, "sid"),
+	}, nil
+}
+
+// parseToken verifies the request token as a first party token.
+func parseToken(r *http.Request) (jwt.MapClaims, uint32, error) {
+	claims, userID, err := verifyToken(ExtractToken(r), currentConfig().Audiences)
+	if err != nil {
+		return nil, 0, err
+	}
+	if claimString(claims, "client_id") != "" {
+		return nil, 0, ErrClientToken
+	}
+
+	return claims, userID, nil
+}
+
+// parseTokenString verifies the token and rejects it when it has been
+// revoked, either on its own or by a logout from all devices.
+func parseTokenString(tokenString string) (jwt.MapClaims, uint32, error) {
+	c := currentConfig()
+	audiences := c.Audiences
+	if c.ClientAudience != "" {
+		audiences = append([]string{c.ClientAudience}, audiences...)
+	}
+	return verifyToken(tokenString, audiences)
+}
+
+// verifyToken checks the signature, the registered claims against the
+// accepted audiences, and the denylist.
+func verifyToken(tokenString string, audiences []string) (jwt.MapClaims, uint32, error) {
+	// registered claims are checked by validateClaims, with leeway
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenString, keyFunc)
+	if err != nil {
+		return nil, 0, err
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		encryptedID := fmt.Sprintf("%s", claims["user_id"])
-		decryptedID, err := crypto.Decrypt(encryptedID, os.Getenv("APP_KEY"))
-		if err != nil {
-			return 0, err
-		}
+	if !ok || !token.Valid {
+		return nil, 0, errors.New("invalid token")
+	}
 
-		id, err := strconv.Atoi(decryptedID)
+	err = validateClaims(claims, audiences, time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var userID uint32
+	if !clientToken(claims) {
+		userID, err = userIDFromClaims(claims)
 		if err != nil {
-			return 0, err
+			return nil, 0, err
 		}
+	}
 
-		return uint32(id), nil
+	revoked, err := revocations.isRevoked(claimString(claims, "jti"), userID, claimString(claims, "sid"), claimTime(claims, "iat"), claimTime(claims, "exp"))
+	if err != nil {
+		return nil, 0, err
+	}
+	if revoked {
+		return nil, 0, ErrTokenRevoked
 	}
-	return 0, nil
+
+	return claims, userID, nil
 }
 
-func Pretty(data interface{}) {
-	b, err := json.MarshalIndent(data, "", " ")
+func validateClaims(claims jwt.MapClaims, audiences []string, now time.Time) error {
+	c := currentConfig()
+
+	expiresAt := claimTime(claims, "exp")
+	if expiresAt.IsZero() || now.After(expiresAt.Add(c.Leeway)) {
+		return errors.New("token is expired")
+	}
+	if notBefore := claimTime(claims, "nbf"); now.Add(c.Leeway).Before(notBefore) {
+		return errors.New("token is not valid yet")
+	}
+	if issuedAt := claimTime(claims, "iat"); now.Add(c.Leeway).Before(issuedAt) {
+		return errors.New("token used before issued")
+	}
+	if claimString(claims, "iss") != c.Issuer {
+		return errors.New("invalid token issuer")
+	}
+
+	switch audience := claims["aud"].(type) {
+	case string:
+		if contains(audiences, audience) {
+			return nil
+		}
+	case []interface{}:
+		for _, value := range audience {
+			if value, ok := value.(string); ok && contains(audiences, value) {
+				return nil
+			}
+		}
+	}
+	return errors.New("invalid token audience")
+}
+
+// clientToken reports whether the token was issued to a client on its own
+// behalf rather than to a user.
+func clientToken(claims jwt.MapClaims) bool {
+	_, hasUser := claims["user_id"]
+	clientID := claimString(claims, "client_id")
+	return !hasUser && clientID != "" && claimString(claims, "sub") == clientID
+}
+
+func userIDFromClaims(claims jwt.MapClaims) (uint32, error) {
+	encryptedID := fmt.Sprintf("%s", claims["user_id"])
+	decryptedID, err := crypto.Decrypt(encryptedID, os.Getenv("APP_KEY"))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.Atoi(decryptedID)
 	if err != nil {
-		log.Println(err)
-		return
+		return 0, err
 	}
-	fmt.Println(string(b))
+
+	return uint32(id), nil
+}
+
+func claimString(claims jwt.MapClaims, key string) string {
+	value, _ := claims[key].(string)
+	return value
 }
 
-func TokenValid(r *http.Request) error {
-	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method %v", token.Header["alg"])
+func claimBool(claims jwt.MapClaims, key string) bool {
+	value, _ := claims[key].(bool)
+	return value
+}
+
+func claimStrings(claims jwt.MapClaims, key string) []string {
+	values := []string{}
+	list, _ := claims[key].([]interface{})
+	for _, value := range list {
+		if value, ok := value.(string); ok {
+			values = append(values, value)
 		}
-		return []byte(os.Getenv("API_SECRET")), nil
-	})
+	}
+	return values
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func claimTime(claims jwt.MapClaims, key string) time.Time {
+	switch value := claims[key].(type) {
+	case float64:
+		return time.Unix(int64(value), 0)
+	case int64:
+		return time.Unix(value, 0)
+	case json.Number:
+		seconds, _ := value.Int64()
+		return time.Unix(seconds, 0)
+	}
+	return time.Time{}
+}
+
+// ExtractTokenInfo verifies the request token and returns its content.
+// Like ExtractTokenID and RevokeToken it only accepts first party tokens;
+// a token issued to an OAuth client is rejected with ErrClientToken.
+func ExtractTokenInfo(r *http.Request) (*TokenInfo, error) {
+	info, err := ParseToken(ExtractToken(r))
+	if err != nil {
+		return nil, err
+	}
+	if info.ClientID != "" {
+		return nil, ErrClientToken
+	}
+
+	return info, nil
+}
+
+func ExtractTokenID(r *http.Request) (uint32, error) {
+	_, userID, err := parseToken(r)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// RevokeToken adds the request token to the denylist until it expires.
+func RevokeToken(r *http.Request) error {
+	claims, userID, err := parseToken(r)
 	if err != nil {
 		return err
 	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		Pretty(claims)
+
+	jti := claimString(claims, "jti")
+	if jti == "" {
+		return errors.New("token cannot be revoked individually")
 	}
-	return nil
+
+	return revocations.revoke(jti, userID, claimTime(claims, "exp"))
+}
+
+// RevokeAllTokens rejects every token issued to userID until now.
+func RevokeAllTokens(userID uint32) error {
+	return revocations.revokeAll(userID)
 }
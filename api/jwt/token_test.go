@@ -0,0 +1,179 @@
+package jwt
+
+import (
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+const testAppKey = "0123456789abcdef0123456789abcdef"
+
+// useTestConfig signs with API_SECRET and issues tokens for the web and
+// cli audiences, with OAuth client tokens for auth-global/oauth.
+func useTestConfig(t *testing.T) {
+	previous := currentConfig()
+	SetConfig(Config{
+		Issuer:          "auth-global",
+		Audiences:       []string{"web", "cli"},
+		DefaultAudience: "web",
+		ClientAudience:  "auth-global/oauth",
+		DefaultLifetime: 15 * time.Minute,
+		Lifetimes:       map[string]time.Duration{},
+		Leeway:          30 * time.Second,
+	})
+	for key, value := range map[string]string{"API_SECRET": "secret", "APP_KEY": testAppKey} {
+		previousValue, ok := os.LookupEnv(key)
+		os.Setenv(key, value)
+		key := key
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, previousValue)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+	t.Cleanup(func() { SetConfig(previous) })
+}
+
+func testGrant(t *testing.T) Grant {
+	publicID, err := crypto.Encrypt("7", testAppKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Grant{
+		UserPublicID:  publicID,
+		Subject:       "user-7",
+		Audience:      "cli",
+		Roles:         []string{"admin"},
+		Permissions:   []string{"roles:write"},
+		EmailVerified: true,
+		SessionID:     "session",
+	}
+}
+
+func TestFirstPartyToken(t *testing.T) {
+	useTestConfig(t)
+
+	token, err := CreateToken(testGrant(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	info, err := ExtractTokenInfo(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserID != 7 || info.Audience != "cli" || info.ClientID != "" {
+		t.Errorf("token info %+v", info)
+	}
+	if !reflect.DeepEqual(info.Roles, []string{"admin"}) || !reflect.DeepEqual(info.Permissions, []string{"roles:write"}) {
+		t.Errorf("roles %v, permissions %v", info.Roles, info.Permissions)
+	}
+	if userID, err := ExtractTokenID(r); err != nil || userID != 7 {
+		t.Errorf("ExtractTokenID = %d, %v", userID, err)
+	}
+}
+
+func TestClientTokenForUser(t *testing.T) {
+	useTestConfig(t)
+
+	grant := testGrant(t)
+	grant.ClientID = "client"
+	grant.Scope = "openid email"
+	token, err := CreateToken(grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the requested audience, roles and permissions are ignored
+	info, err := ParseToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Audience != "auth-global/oauth" || info.ClientID != "client" || info.Scope != "openid email" || info.UserID != 7 {
+		t.Errorf("token info %+v", info)
+	}
+	if len(info.Roles) != 0 || len(info.Permissions) != 0 {
+		t.Errorf("client token carries roles %v and permissions %v", info.Roles, info.Permissions)
+	}
+
+	// first party endpoints do not accept it
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if _, err := ExtractTokenInfo(r); err == nil {
+		t.Error("ExtractTokenInfo accepted a client token")
+	}
+	if _, err := ExtractTokenID(r); err == nil {
+		t.Error("ExtractTokenID accepted a client token")
+	}
+	if err := RevokeToken(r); err == nil {
+		t.Error("RevokeToken accepted a client token")
+	}
+
+	// nor do services that only accept the first party audiences
+	if _, _, err := verifyToken(token, []string{"web", "cli"}); err == nil {
+		t.Error("client token verified for a first party audience")
+	}
+}
+
+func TestClientCredentialsToken(t *testing.T) {
+	useTestConfig(t)
+
+	token, err := CreateClientToken("service", "", "reports:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := ParseToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserID != 0 || info.Subject != "service" || info.ClientID != "service" || info.Scope != "reports:read" {
+		t.Errorf("token info %+v", info)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if _, err := ExtractTokenInfo(r); err != ErrClientToken {
+		t.Errorf("ExtractTokenInfo = %v, want ErrClientToken", err)
+	}
+}
+
+func TestLoadConfigClientAudience(t *testing.T) {
+	defer SetConfig(currentConfig())
+	env := map[string]string{"JWT_ISSUER": "https://auth.example.com", "JWT_AUDIENCES": "web", "JWT_CLIENT_AUDIENCE": ""}
+	for key, value := range env {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	if err := LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ClientAudience(); got != "https://auth.example.com/oauth" {
+		t.Errorf("ClientAudience() = %q", got)
+	}
+
+	os.Setenv("JWT_CLIENT_AUDIENCE", "web")
+	if err := LoadConfig(); err == nil {
+		t.Error("client audience shared with first party tokens accepted")
+	}
+
+	os.Setenv("JWT_CLIENT_AUDIENCE", "oauth")
+	os.Setenv("JWT_AUDIENCE_LIFETIMES", "oauth=5m")
+	defer os.Unsetenv("JWT_AUDIENCE_LIFETIMES")
+	if err := LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := TokenLifetime(ClientAudience()); got != 5*time.Minute {
+		t.Errorf("client token lifetime %v, want 5m", got)
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/controllers"
+	"github.com/norfabagas/auth-global/api/models"
+)
+
+const keysUsage = `usage:
+	auth-global keys list
+	auth-global keys rotate [RS256|ES256|ES384|ES512|EdDSA]
+	auth-global keys retire <kid>`
+
+// Keys manages the signing keyring from the command line. Running servers
+// pick up the changes on their next keyring refresh.
+func Keys(args []string) {
+	if len(args) == 0 {
+		log.Fatal(keysUsage)
+	}
+
+	server.Initialize(os.Getenv("DB_DRIVER"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_PORT"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME"))
+
+	if appKey := os.Getenv("APP_KEY"); len([]rune(appKey)) != 32 {
+		log.Fatalf("APP_KEY is not 32 bit long")
+	}
+
+	switch args[0] {
+	case "list":
+		listKeys()
+
+	case "rotate":
+		algorithm := os.Getenv("JWT_SIGNING_ALGORITHM")
+		if len(args) > 1 {
+			algorithm = args[1]
+		}
+		if algorithm == "" {
+			algorithm = controllers.DefaultSigningAlgorithm
+		}
+
+		activationDelay := 10 * time.Minute
+		if delay := os.Getenv("JWT_KEY_ACTIVATION_DELAY"); delay != "" {
+			var err error
+			activationDelay, err = time.ParseDuration(delay)
+			if err != nil {
+				log.Fatalf("Invalid JWT_KEY_ACTIVATION_DELAY: %v", err)
+			}
+		}
+
+		key, err := server.RotateSigningKey(algorithm, activationDelay)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		fmt.Printf("Created %s key %s, signing from %s\n", key.Method.Alg(), key.ID, key.ActivatesAt.Format(time.RFC3339))
+		listKeys()
+
+	case "retire":
+		if len(args) < 2 {
+			log.Fatal(keysUsage)
+		}
+		if err := server.RetireSigningKey(args[1]); err != nil {
+			log.Fatal("Error: ", err)
+		}
+		listKeys()
+
+	default:
+		log.Fatal(keysUsage)
+	}
+}
+
+func listKeys() {
+	signingKey := models.SigningKey{}
+	stored, err := signingKey.FindAllSigningKeys(server.DB)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+
+	for _, key := range *stored {
+		retiresAt := "-"
+		if key.RetiresAt != nil {
+			retiresAt = key.RetiresAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%-45s %-6s %-12s activates %s retires %s\n", key.KID, key.Algorithm, key.State, key.ActivatesAt.Format(time.RFC3339), retiresAt)
+	}
+}
@@ -3,6 +3,7 @@ package middlewares
 import (
 	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/norfabagas/auth-global/api/jwt"
 	"github.com/norfabagas/auth-global/api/responses"
@@ -15,13 +16,85 @@ func SetMiddlewareJSON(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// SetMiddlewareAuth requires a valid first party access token and updates
+// the last seen time of its session. Tokens issued to an OAuth client, on
+// its own behalf or a user's, are not accepted; those are only good at the
+// routes guarded by RequireScope.
 func SetMiddlewareAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := jwt.TokenValid(r)
+		info, err := jwt.ExtractTokenInfo(r)
 		if err != nil {
 			responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
 			return
 		}
+		touchSession(info.SessionID, ClientIP(r))
 		next(w, r)
 	}
 }
+
+// RequirePermission only lets requests through whose first party token
+// carries the given permission.
+func RequirePermission(permission string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			info, err := jwt.ExtractTokenInfo(r)
+			if err != nil {
+				responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+				return
+			}
+			if !contains(info.Permissions, permission) {
+				responses.ERROR(w, http.StatusForbidden, errors.New("missing permission "+permission))
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// RequireRole only lets requests through whose first party token carries
+// the given role.
+func RequireRole(role string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			info, err := jwt.ExtractTokenInfo(r)
+			if err != nil {
+				responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+				return
+			}
+			if !contains(info.Roles, role) {
+				responses.ERROR(w, http.StatusForbidden, errors.New("forbidden"))
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// RequireScope guards the routes meant for OAuth clients: a token issued to
+// a client has to be granted scope. First party tokens are not scoped and
+// pass. Failures are reported as bearer token errors.
+func RequireScope(scope string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			info, err := jwt.ParseToken(jwt.ExtractToken(r))
+			if err != nil {
+				responses.BearerError(w, http.StatusUnauthorized, "invalid_token", "invalid or expired access token")
+				return
+			}
+			if info.ClientID != "" && !contains(strings.Fields(info.Scope), scope) {
+				responses.BearerError(w, http.StatusForbidden, "insufficient_scope", "the "+scope+" scope is required")
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
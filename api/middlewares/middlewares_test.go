@@ -0,0 +1,147 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+const testAppKey = "0123456789abcdef0123456789abcdef"
+
+// testTokens returns a first party token with the admin role and the
+// roles:write permission, and a token issued to an OAuth client for the
+// same user with scope.
+func testTokens(t *testing.T, scope string) (string, string) {
+	jwt.SetConfig(jwt.Config{
+		Issuer:          "auth-global",
+		Audiences:       []string{"web"},
+		DefaultAudience: "web",
+		ClientAudience:  "auth-global/oauth",
+		DefaultLifetime: 15 * time.Minute,
+		Lifetimes:       map[string]time.Duration{},
+	})
+	os.Setenv("API_SECRET", "secret")
+	os.Setenv("APP_KEY", testAppKey)
+	t.Cleanup(func() {
+		os.Unsetenv("API_SECRET")
+		os.Unsetenv("APP_KEY")
+	})
+
+	publicID, err := crypto.Encrypt("7", testAppKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant := jwt.Grant{UserPublicID: publicID, Subject: "user-7", Roles: []string{"admin"}, Permissions: []string{"roles:write"}}
+	firstParty, err := jwt.CreateToken(grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grant.ClientID = "client"
+	grant.Scope = scope
+	client, err := jwt.CreateToken(grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return firstParty, client
+}
+
+func serve(handler http.HandlerFunc, token string) int {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	handler(w, r)
+	return w.Code
+}
+
+func TestFirstPartyMiddlewareRejectsClientTokens(t *testing.T) {
+	firstParty, client := testTokens(t, "openid")
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	handlers := map[string]http.HandlerFunc{
+		"SetMiddlewareAuth": SetMiddlewareAuth(ok),
+		"RequirePermission": RequirePermission("roles:write")(ok),
+		"RequireRole":       RequireRole("admin")(ok),
+	}
+	for name, handler := range handlers {
+		if code := serve(handler, firstParty); code != http.StatusOK {
+			t.Errorf("%s with a first party token: %d", name, code)
+		}
+		if code := serve(handler, client); code != http.StatusUnauthorized {
+			t.Errorf("%s with a client token: %d, want 401", name, code)
+		}
+		if code := serve(handler, ""); code != http.StatusUnauthorized {
+			t.Errorf("%s without a token: %d, want 401", name, code)
+		}
+	}
+
+	if code := serve(RequirePermission("roles:read")(ok), firstParty); code != http.StatusForbidden {
+		t.Errorf("RequirePermission without the permission: %d, want 403", code)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	firstParty, client := testTokens(t, "openid email")
+	if code := serve(RequireScope("openid")(ok), client); code != http.StatusOK {
+		t.Errorf("client token with the scope: %d", code)
+	}
+	if code := serve(RequireScope("openid")(ok), firstParty); code != http.StatusOK {
+		t.Errorf("first party token: %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+client)
+	RequireScope("profile")(ok)(w, r)
+	if w.Code != http.StatusForbidden || w.Header().Get("WWW-Authenticate") != `Bearer error="insufficient_scope", error_description="the profile scope is required"` {
+		t.Errorf("client token without the scope: %d, %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+
+	if code := serve(RequireScope("openid")(ok), "not a token"); code != http.StatusUnauthorized {
+		t.Errorf("invalid token: %d, want 401", code)
+	}
+}
+
+func TestRBACDenial(t *testing.T) {
+	admin, _ := testTokens(t, "")
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	publicID, err := crypto.Encrypt("8", testAppKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// signed in, but granted nothing
+	plain, err := jwt.CreateToken(jwt.Grant{UserPublicID: publicID, Subject: "user-8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	denied := map[string]struct {
+		handler http.HandlerFunc
+		token   string
+	}{
+		"RequireRole with another role":           {RequireRole("auditor")(ok), admin},
+		"RequireRole without roles":               {RequireRole("admin")(ok), plain},
+		"RequirePermission with other permission": {RequirePermission("users:write")(ok), admin},
+		"RequirePermission without permissions":   {RequirePermission("roles:write")(ok), plain},
+	}
+	for name, test := range denied {
+		if code := serve(test.handler, test.token); code != http.StatusForbidden {
+			t.Errorf("%s: %d, want 403", name, code)
+		}
+	}
+
+	if code := serve(RequireRole("admin")(ok), "not a token"); code != http.StatusUnauthorized {
+		t.Errorf("RequireRole with an invalid token: %d, want 401", code)
+	}
+}
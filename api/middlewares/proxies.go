@@ -0,0 +1,105 @@
+package middlewares
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	trustedProxiesMu sync.RWMutex
+	trustedProxies   []*net.IPNet
+)
+
+// LoadTrustedProxies reads TRUSTED_PROXIES, a comma separated list of the
+// addresses or CIDR ranges of the reverse proxies in front of the service,
+// e.g. 10.0.0.0/8 behind the Heroku router.
+func LoadTrustedProxies() error {
+	proxies := []*net.IPNet{}
+	for _, value := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return fmt.Errorf("invalid TRUSTED_PROXIES entry %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("invalid TRUSTED_PROXIES entry %q", value)
+		}
+		proxies = append(proxies, network)
+	}
+
+	SetTrustedProxies(proxies)
+	return nil
+}
+
+func SetTrustedProxies(proxies []*net.IPNet) {
+	trustedProxiesMu.Lock()
+	defer trustedProxiesMu.Unlock()
+
+	trustedProxies = proxies
+}
+
+func trustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	trustedProxiesMu.RLock()
+	defer trustedProxiesMu.RUnlock()
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the caller, without the port. Behind
+// trusted proxies it is the right-most X-Forwarded-For hop that is not one
+// of them; the hops left of it are set by the client and can be forged.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !trustedProxy(host) {
+		return host
+	}
+
+	hops := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// a malformed hop was not written by a trusted proxy
+			return host
+		}
+		host = hop
+		if !trustedProxy(hop) {
+			return hop
+		}
+	}
+
+	return host
+}
@@ -0,0 +1,75 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestLoadTrustedProxies(t *testing.T) {
+	defer SetTrustedProxies(nil)
+
+	os.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1,2001:db8::/32")
+	defer os.Unsetenv("TRUSTED_PROXIES")
+	if err := LoadTrustedProxies(); err != nil {
+		t.Fatal(err)
+	}
+	for address, want := range map[string]bool{
+		"10.1.2.3":    true,
+		"192.0.2.1":   true,
+		"192.0.2.2":   false,
+		"2001:db8::1": true,
+		"203.0.113.7": false,
+		"garbage":     false,
+	} {
+		if got := trustedProxy(address); got != want {
+			t.Errorf("trustedProxy(%q) = %v, want %v", address, got, want)
+		}
+	}
+
+	os.Setenv("TRUSTED_PROXIES", "10.0.0.0/33")
+	if err := LoadTrustedProxies(); err == nil {
+		t.Error("invalid CIDR accepted")
+	}
+	os.Setenv("TRUSTED_PROXIES", "proxy.example.com")
+	if err := LoadTrustedProxies(); err == nil {
+		t.Error("host name accepted")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	defer SetTrustedProxies(nil)
+	os.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	defer os.Unsetenv("TRUSTED_PROXIES")
+	if err := LoadTrustedProxies(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{"direct", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"forged header without a proxy", "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"behind a proxy", "10.0.0.1:4000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"forged hop left of the client", "10.0.0.1:4000", []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"several proxies", "10.0.0.1:4000", []string{"203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"several headers", "10.0.0.1:4000", []string{"198.51.100.1", "203.0.113.7"}, "203.0.113.7"},
+		{"proxy without header", "10.0.0.1:4000", nil, "10.0.0.1"},
+		{"only proxies", "10.0.0.1:4000", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"malformed hop", "10.0.0.1:4000", []string{"203.0.113.7, not-an-ip"}, "10.0.0.1"},
+		{"IPv6 client", "10.0.0.1:4000", []string{"2001:db8::7"}, "2001:db8::7"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		for _, value := range test.forwardedFor {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := ClientIP(r); got != test.want {
+			t.Errorf("%s: ClientIP = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/responses"
+)
+
+// Rate limiting algorithms.
+const (
+	// TokenBucket refills Limit tokens evenly over Window and allows bursts
+	// of up to Limit requests.
+	TokenBucket = "token-bucket"
+	// SlidingWindow allows Limit requests in any Window, estimated from the
+	// counts of the current and previous fixed windows.
+	SlidingWindow = "sliding-window"
+)
+
+// RatePolicy limits the requests of one route and key.
+type RatePolicy struct {
+	Name      string
+	Algorithm string
+	Limit     int
+	Window    time.Duration
+}
+
+// FromEnv overrides the limit and window from RATE_LIMIT_<NAME>, e.g.
+// RATE_LIMIT_LOGIN_IP=20/1m. A limit of 0 turns the policy off.
+func (policy RatePolicy) FromEnv() RatePolicy {
+	key := "RATE_LIMIT_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(policy.Name))
+	value := os.Getenv(key)
+	if value == "" {
+		return policy
+	}
+
+	parts := strings.SplitN(value, "/", 2)
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit < 0 || len(parts) != 2 {
+		log.Printf("ignoring invalid %s %q", key, value)
+		return policy
+	}
+	window, err := time.ParseDuration(parts[1])
+	if err != nil || window <= 0 {
+		log.Printf("ignoring invalid %s %q", key, value)
+		return policy
+	}
+
+	policy.Limit = limit
+	policy.Window = window
+	return policy
+}
+
+// RateLimitResult is the outcome of counting one request.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the counters. The in-memory store is per instance;
+// deployments with several instances plug in a shared backend.
+type RateLimitStore interface {
+	Take(key string, policy RatePolicy, now time.Time) (RateLimitResult, error)
+}
+
+var (
+	rateLimitMu    sync.RWMutex
+	rateLimitStore RateLimitStore = NewMemoryRateLimitStore()
+)
+
+func SetRateLimitStore(store RateLimitStore) {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+
+	rateLimitStore = store
+}
+
+func currentRateLimitStore() RateLimitStore {
+	rateLimitMu.RLock()
+	defer rateLimitMu.RUnlock()
+
+	return rateLimitStore
+}
+
+// KeyFunc picks what requests are counted by. An empty key falls back to
+// the client IP.
+type KeyFunc func(r *http.Request) string
+
+// ByIP counts requests per client IP address.
+func ByIP(r *http.Request) string {
+	return "ip:" + ClientIP(r)
+}
+
+// ByUser counts requests per signed in user.
+func ByUser(r *http.Request) string {
+	userID, err := jwt.ExtractTokenID(r)
+	if err != nil {
+		return ""
+	}
+	return "user:" + strconv.Itoa(int(userID))
+}
+
+// ByEmail counts requests per email address in the JSON body. The body is
+// left in place for the handler.
+func ByEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return ""
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	request := struct {
+		Email string `json:"email"`
+	}{}
+	if json.Unmarshal(body, &request) != nil || request.Email == "" {
+		return ""
+	}
+	return "email:" + strings.ToLower(strings.TrimSpace(request.Email))
+}
+
+// RateLimit rejects requests over policy with 429 and reports the quota in
+// RateLimit-* headers.
+func RateLimit(policy RatePolicy, key KeyFunc) func(http.HandlerFunc) http.HandlerFunc {
+	policy = policy.FromEnv()
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if policy.Limit == 0 {
+			return next
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			value := key(r)
+			if value == "" {
+				value = ByIP(r)
+			}
+
+			result, err := currentRateLimitStore().Take(policy.Name+":"+value, policy, time.Now())
+			if err != nil {
+				// a broken backend must not take the service down with it
+				log.Printf("rate limit %s: %v", policy.Name, err)
+				next(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, seconds(policy.Window)))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+				responses.ERROR(w, http.StatusTooManyRequests, errors.New("too many requests, please try again later"))
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore keeps counters in process memory.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	windows   map[string]*slidingWindow
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	window  time.Duration
+}
+
+type slidingWindow struct {
+	start    time.Time
+	count    int
+	previous int
+	window   time.Duration
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: map[string]*bucket{},
+		windows: map[string]*slidingWindow{},
+	}
+}
+
+func (store *MemoryRateLimitStore) Take(key string, policy RatePolicy, now time.Time) (RateLimitResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.sweep(now)
+
+	switch policy.Algorithm {
+	case TokenBucket:
+		return store.takeToken(key, policy, now), nil
+	case SlidingWindow, "":
+		return store.takeWindow(key, policy, now), nil
+	}
+
+	return RateLimitResult{}, fmt.Errorf("unknown rate limit algorithm %q", policy.Algorithm)
+}
+
+func (store *MemoryRateLimitStore) takeToken(key string, policy RatePolicy, now time.Time) RateLimitResult {
+	limit := float64(policy.Limit)
+	rate := limit / policy.Window.Seconds()
+
+	b, ok := store.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit, updated: now, window: policy.Window}
+		store.buckets[key] = b
+	}
+	b.tokens = math.Min(limit, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	result := RateLimitResult{Limit: policy.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((limit - b.tokens) / rate * float64(time.Second))
+
+	return result
+}
+
+func (store *MemoryRateLimitStore) takeWindow(key string, policy RatePolicy, now time.Time) RateLimitResult {
+	w, ok := store.windows[key]
+	if !ok {
+		w = &slidingWindow{start: now, window: policy.Window}
+		store.windows[key] = w
+	}
+	if elapsed := now.Sub(w.start); elapsed >= policy.Window {
+		w.previous = w.count
+		if elapsed >= 2*policy.Window {
+			w.previous = 0
+		}
+		w.count = 0
+		w.start = w.start.Add(elapsed / policy.Window * policy.Window)
+	}
+
+	elapsed := now.Sub(w.start)
+	weight := 1 - float64(elapsed)/float64(policy.Window)
+	estimate := float64(w.previous)*weight + float64(w.count)
+
+	result := RateLimitResult{Limit: policy.Limit, Reset: w.start.Add(policy.Window).Sub(now)}
+	if estimate+1 <= float64(policy.Limit) {
+		w.count++
+		result.Allowed = true
+		estimate++
+	} else if w.count+1 > policy.Limit || w.previous == 0 {
+		result.RetryAfter = result.Reset
+	} else {
+		// wait until enough of the previous window has slid out
+		fraction := 1 - float64(policy.Limit-w.count-1)/float64(w.previous)
+		result.RetryAfter = time.Duration(fraction*float64(policy.Window)) - elapsed
+	}
+	result.Remaining = int(math.Max(0, float64(policy.Limit)-estimate))
+
+	return result
+}
+
+// sweep drops counters that have been idle for longer than their window.
+func (store *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(store.lastSweep) < time.Minute {
+		return
+	}
+	store.lastSweep = now
+
+	for key, b := range store.buckets {
+		if now.Sub(b.updated) > b.window {
+			delete(store.buckets, key)
+		}
+	}
+	for key, w := range store.windows {
+		if now.Sub(w.start) > 2*w.window {
+			delete(store.windows, key)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package middlewares
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	policy := RatePolicy{Name: "test", Algorithm: TokenBucket, Limit: 3, Window: 3 * time.Second}
+	now := time.Now()
+
+	// a full bucket allows a burst of Limit requests
+	for i := 0; i < 3; i++ {
+		result, err := store.Take("key", policy, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Errorf("request %d: %+v", i, result)
+		}
+	}
+
+	result, _ := store.Take("key", policy, now)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Errorf("request over the burst: %+v", result)
+	}
+
+	// other keys have buckets of their own
+	if result, _ := store.Take("other", policy, now); !result.Allowed {
+		t.Errorf("other key: %+v", result)
+	}
+
+	// one token is refilled per second
+	result, _ = store.Take("key", policy, now.Add(time.Second))
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("after one second: %+v", result)
+	}
+	result, _ = store.Take("key", policy, now.Add(time.Second))
+	if result.Allowed {
+		t.Errorf("second request after one second: %+v", result)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	policy := RatePolicy{Name: "test", Algorithm: SlidingWindow, Limit: 2, Window: 10 * time.Second}
+	now := time.Now()
+
+	tests := []struct {
+		at         time.Duration
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{0, true, 0},
+		{time.Second, true, 0},
+		// the current window is full until it ends
+		{2 * time.Second, false, 8 * time.Second},
+		// the previous window still counts in full at the start of the next
+		// one, until half of it has slid out
+		{10 * time.Second, false, 5 * time.Second},
+		{15 * time.Second, true, 0},
+		{16 * time.Second, false, 4 * time.Second},
+		// two windows later nothing is left
+		{40 * time.Second, true, 0},
+		{40 * time.Second, true, 0},
+	}
+	for _, test := range tests {
+		result, err := store.Take("key", policy, now.Add(test.at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != test.allowed || result.RetryAfter != test.retryAfter {
+			t.Errorf("at %v: got allowed %v, retry after %v, want %v, %v", test.at, result.Allowed, result.RetryAfter, test.allowed, test.retryAfter)
+		}
+	}
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	_, err := store.Take("key", RatePolicy{Name: "test", Algorithm: "leaky-bucket", Limit: 1, Window: time.Minute}, time.Now())
+	if err == nil {
+		t.Error("unknown algorithm accepted")
+	}
+}
+
+func TestRatePolicyFromEnv(t *testing.T) {
+	policy := RatePolicy{Name: "test-ip.v2", Algorithm: TokenBucket, Limit: 10, Window: time.Minute}
+	defer os.Unsetenv("RATE_LIMIT_TEST_IP_V2")
+
+	os.Setenv("RATE_LIMIT_TEST_IP_V2", "5/30s")
+	if got := policy.FromEnv(); got.Limit != 5 || got.Window != 30*time.Second || got.Algorithm != TokenBucket {
+		t.Errorf("got %+v", got)
+	}
+
+	for _, value := range []string{"5", "-1/1m", "five/1m", "5/never", "5/0s"} {
+		os.Setenv("RATE_LIMIT_TEST_IP_V2", value)
+		if got := policy.FromEnv(); got != policy {
+			t.Errorf("invalid %q changed the policy to %+v", value, got)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	SetRateLimitStore(NewMemoryRateLimitStore())
+	defer SetRateLimitStore(NewMemoryRateLimitStore())
+
+	policy := RatePolicy{Name: "test", Algorithm: TokenBucket, Limit: 1, Window: time.Minute}
+	handler := RateLimit(policy, ByIP)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", nil)
+		r.RemoteAddr = remoteAddr
+		handler(w, r)
+		return w
+	}
+
+	w := request("203.0.113.7:4000")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("first request: %d", w.Code)
+	}
+	for header, want := range map[string]string{
+		"RateLimit-Policy":    "1;w=60",
+		"RateLimit-Limit":     "1",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	w = request("203.0.113.7:4001")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("second request: %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	if w = request("198.51.100.1:4000"); w.Code != http.StatusNoContent {
+		t.Errorf("request from another IP: %d", w.Code)
+	}
+}
+
+func TestRateLimitOff(t *testing.T) {
+	policy := RatePolicy{Name: "test", Algorithm: TokenBucket, Limit: 0, Window: time.Minute}
+	handler := RateLimit(policy, ByIP)(func(w http.ResponseWriter, r *http.Request) {})
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", "/", nil))
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("request %d: %d %v", i, w.Code, w.Header())
+		}
+	}
+}
+
+func TestByEmail(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"email":" User@Example.com ","password":"secret"}`))
+	if got := ByEmail(r); got != "email:user@example.com" {
+		t.Errorf("ByEmail = %q", got)
+	}
+
+	// the handler still reads the whole body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil || !strings.Contains(string(body), `"password":"secret"`) {
+		t.Errorf("body after ByEmail: %q, %v", body, err)
+	}
+
+	if got := ByEmail(httptest.NewRequest("POST", "/", strings.NewReader("not json"))); got != "" {
+		t.Errorf("ByEmail without email = %q", got)
+	}
+}
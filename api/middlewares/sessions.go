@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// SessionTracker records when and from where a sign in session was last
+// used.
+type SessionTracker interface {
+	TouchSession(sessionID, ip string, seenAt time.Time) error
+}
+
+var (
+	sessionTrackerMu sync.RWMutex
+	sessionTracker   SessionTracker
+)
+
+func SetSessionTracker(tracker SessionTracker) {
+	sessionTrackerMu.Lock()
+	defer sessionTrackerMu.Unlock()
+
+	sessionTracker = tracker
+}
+
+func currentSessionTracker() SessionTracker {
+	sessionTrackerMu.RLock()
+	defer sessionTrackerMu.RUnlock()
+
+	return sessionTracker
+}
+
+// touchSession never fails the request, the session is only bookkeeping.
+func touchSession(sessionID, ip string) {
+	tracker := currentSessionTracker()
+	if tracker == nil || sessionID == "" {
+		return
+	}
+
+	if err := tracker.TouchSession(sessionID, ip, time.Now()); err != nil {
+		log.Printf("session %s: %v", sessionID, err)
+	}
+}
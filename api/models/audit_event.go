@@ -0,0 +1,141 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Audited actions.
+const (
+	AuditLogin                 = "login"
+	AuditRegister              = "register"
+	AuditPasswordChange        = "password.change"
+	AuditPasswordReset         = "password.reset"
+	AuditProfileUpdate         = "profile.update"
+	AuditSessionRevoke         = "session.revoke"
+	AuditOAuthConsent          = "oauth.consent"
+	AuditAdminUserDisable      = "admin.user.disable"
+	AuditAdminUserEnable       = "admin.user.enable"
+	AuditAdminUserUnlock       = "admin.user.unlock"
+	AuditAdminUserForceReset   = "admin.user.force-password-reset"
+	AuditAdminUserDelete       = "admin.user.delete"
+	AuditAdminRoleAssign       = "admin.role.assign"
+	AuditAdminRoleUnassign     = "admin.role.unassign"
+	AuditAdminRoleCreate       = "admin.role.create"
+	AuditAdminRoleDelete       = "admin.role.delete"
+	AuditAdminPermissionGrant  = "admin.permission.grant"
+	AuditAdminPermissionRevoke = "admin.permission.revoke"
+	AuditAdminPermissionCreate = "admin.permission.create"
+	AuditAdminPermissionDelete = "admin.permission.delete"
+	AuditAdminClientCreate     = "admin.client.create"
+	AuditAdminClientUpdate     = "admin.client.update"
+	AuditAdminClientDelete     = "admin.client.delete"
+	AuditAdminClientRotate     = "admin.client.rotate-secret"
+	AuditAdminClientIssueToken = "admin.client.registration-token"
+	AuditOAuthClientRegister   = "oauth.client.register"
+)
+
+// Audit results.
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+const (
+	auditDetailMaxLength    = 255
+	auditUserAgentMaxLength = 512
+)
+
+// AuditEvent is one entry of the append-only audit log. The actor performed
+// the action on the target; both are the same user for self-service actions
+// and empty when unknown, e.g. a sign in attempt for an unregistered address.
+type AuditEvent struct {
+	ID          uint32    `gorm:"primary_key;not null;unique" json:"id"`
+	Action      string    `gorm:"size:64;not null" json:"action"`
+	Result      string    `gorm:"size:16;not null" json:"result"`
+	Detail      string    `gorm:"size:255;not null" json:"detail"`
+	ActorID     *uint32   `json:"-"`
+	ActorEmail  string    `gorm:"size:255;not null" json:"actor_email"`
+	TargetID    *uint32   `json:"-"`
+	TargetEmail string    `gorm:"size:255;not null" json:"target_email"`
+	IP          string    `gorm:"size:64;not null" json:"ip"`
+	UserAgent   string    `gorm:"not null" json:"user_agent"`
+	CreatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// AuditEventFilter narrows FindAuditEvents. Zero values are ignored.
+type AuditEventFilter struct {
+	Action   string
+	Result   string
+	ActorID  *uint32
+	TargetID *uint32
+	Email    string
+	IP       string
+	From     time.Time
+	To       time.Time
+}
+
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	return value[:length]
+}
+
+func (auditEvent *AuditEvent) SaveAuditEvent(db *gorm.DB) (*AuditEvent, error) {
+	auditEvent.ID = 0
+	auditEvent.Detail = truncate(auditEvent.Detail, auditDetailMaxLength)
+	auditEvent.UserAgent = truncate(auditEvent.UserAgent, auditUserAgentMaxLength)
+	auditEvent.CreatedAt = time.Now()
+
+	err := db.Debug().Create(&auditEvent).Error
+	if err != nil {
+		return &AuditEvent{}, err
+	}
+
+	return auditEvent, nil
+}
+
+func (auditEvent *AuditEvent) FindAuditEvents(db *gorm.DB, filter AuditEventFilter, page, perPage int) (*[]AuditEvent, int, error) {
+	auditEvents := []AuditEvent{}
+	total := 0
+
+	query := db.Debug().Model(&AuditEvent{})
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Result != "" {
+		query = query.Where("result = ?", filter.Result)
+	}
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.TargetID != nil {
+		query = query.Where("target_id = ?", *filter.TargetID)
+	}
+	if filter.Email != "" {
+		query = query.Where("actor_email = ? OR target_email = ?", filter.Email, filter.Email)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	err := query.Count(&total).Error
+	if err != nil {
+		return &[]AuditEvent{}, 0, err
+	}
+
+	err = query.Order("created_at desc").Order("id desc").Offset((page - 1) * perPage).Limit(perPage).Find(&auditEvents).Error
+	if err != nil {
+		return &[]AuditEvent{}, 0, err
+	}
+
+	return &auditEvents, total, nil
+}
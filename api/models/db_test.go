@@ -0,0 +1,27 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// newTestDB opens an in-memory database with the tables of models.
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	db.LogMode(false)
+	err = db.AutoMigrate(models...).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
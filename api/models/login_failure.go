@@ -0,0 +1,164 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("incorrect email or password")
+	ErrAccountLocked      = errors.New("account is temporarily locked after too many failed sign in attempts")
+)
+
+// LockoutPolicy controls how failed sign ins are throttled.
+type LockoutPolicy struct {
+	// Failures before each further attempt on the account is delayed,
+	// doubling from one second up to MaxDelay.
+	DelayAfter int
+	MaxDelay   time.Duration
+	// Failures before the account is locked for Duration.
+	Threshold int
+	Duration  time.Duration
+	// Failures allowed from one IP address within IPWindow.
+	IPLimit  int
+	IPWindow time.Duration
+}
+
+// LoginLockoutPolicy reads the policy from the environment:
+//
+//	LOGIN_DELAY_AFTER        failures before attempts are delayed, defaults to 3
+//	LOGIN_LOCKOUT_THRESHOLD  failures before the account is locked, defaults to 10
+//	LOGIN_LOCKOUT_DURATION   how long the account stays locked, defaults to 15m
+//	LOGIN_IP_FAILURE_LIMIT   failures allowed per IP address, defaults to 50
+//	LOGIN_IP_FAILURE_WINDOW  window of the IP limit, defaults to 15m
+func LoginLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		DelayAfter: envInt("LOGIN_DELAY_AFTER", 3),
+		MaxDelay:   time.Minute,
+		Threshold:  envInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+		Duration:   envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		IPLimit:    envInt("LOGIN_IP_FAILURE_LIMIT", 50),
+		IPWindow:   envDuration("LOGIN_IP_FAILURE_WINDOW", 15*time.Minute),
+	}
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 1 {
+		return fallback
+	}
+	return value
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// LoginFailure records a failed sign in for per IP throttling, including
+// attempts for unknown addresses.
+type LoginFailure struct {
+	ID        uint32    `gorm:"primary_key;not null;unique" json:"id"`
+	Email     string    `gorm:"size:255;not null" json:"email"`
+	IP        string    `gorm:"size:64;not null" json:"ip"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (loginFailure *LoginFailure) SaveLoginFailure(db *gorm.DB, email, ip string) error {
+	// failures older than a day are of no use to any window
+	err := db.Debug().Where("created_at < ?", time.Now().Add(-24*time.Hour)).Delete(&LoginFailure{}).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Debug().Create(&LoginFailure{Email: email, IP: ip, CreatedAt: time.Now()}).Error
+}
+
+// IPRetryAfter reports how long ip has to wait before trying again, or zero.
+func (loginFailure *LoginFailure) IPRetryAfter(db *gorm.DB, ip string, policy LockoutPolicy) (time.Duration, error) {
+	failures := []LoginFailure{}
+	err := db.Debug().Model(&LoginFailure{}).
+		Where("ip = ? AND created_at > ?", ip, time.Now().Add(-policy.IPWindow)).
+		Order("created_at desc").Limit(policy.IPLimit).Find(&failures).Error
+	if err != nil || len(failures) < policy.IPLimit {
+		return 0, err
+	}
+
+	// the oldest failure counted has to leave the window
+	return time.Until(failures[len(failures)-1].CreatedAt.Add(policy.IPWindow)), nil
+}
+
+// LockedFor reports how long the account stays locked, or zero.
+func (user *User) LockedFor() time.Duration {
+	if user.LockedUntil == nil || !user.LockedUntil.After(time.Now()) {
+		return 0
+	}
+	return time.Until(*user.LockedUntil)
+}
+
+// RetryAfter reports how long the next attempt has to wait after the
+// account's consecutive failures, or zero.
+func (user *User) RetryAfter(policy LockoutPolicy) time.Duration {
+	if user.FailedLoginCount < policy.DelayAfter || user.LastFailedLoginAt == nil {
+		return 0
+	}
+
+	delay := policy.MaxDelay
+	if shift := uint(user.FailedLoginCount - policy.DelayAfter); shift < 16 && time.Second<<shift < delay {
+		delay = time.Second << shift
+	}
+
+	if wait := time.Until(user.LastFailedLoginAt.Add(delay)); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// RecordLoginFailure counts a failed attempt on the account and locks it once
+// the threshold is reached. It reports whether this failure locked it. The
+// count starts over once a lock has expired, so the account is not locked
+// again by the next single failure.
+func (user *User) RecordLoginFailure(db *gorm.DB, id uint32, policy LockoutPolicy) (bool, error) {
+	now := time.Now()
+	err := db.Debug().Exec(
+		"UPDATE users SET "+
+			"failed_login_count = CASE WHEN locked_until <= ? THEN 1 ELSE failed_login_count + 1 END, "+
+			"locked_until = CASE WHEN locked_until <= ? THEN NULL ELSE locked_until END, "+
+			"last_failed_login_at = ? WHERE id = ?",
+		now, now, now, id,
+	).Error
+	if err != nil {
+		return false, err
+	}
+
+	locked := db.Debug().Model(&User{}).
+		Where("id = ? AND failed_login_count >= ? AND (locked_until IS NULL OR locked_until < ?)", id, policy.Threshold, now).
+		UpdateColumns(
+			map[string]interface{}{
+				"locked_until": now.Add(policy.Duration),
+			},
+		)
+	if locked.Error != nil {
+		return false, locked.Error
+	}
+
+	return locked.RowsAffected > 0, nil
+}
+
+// UnlockUser lifts a lockout and forgets the failed attempts.
+func (user *User) UnlockUser(db *gorm.DB, id uint32) error {
+	return db.Debug().Model(&User{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"failed_login_count":   0,
+			"last_failed_login_at": nil,
+			"locked_until":         nil,
+		},
+	).Error
+}
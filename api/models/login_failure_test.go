@@ -0,0 +1,95 @@
+package models
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRecordLoginFailure(t *testing.T) {
+	os.Setenv("APP_KEY", testAppKey)
+	db := newTestDB(t, &User{})
+	policy := LockoutPolicy{DelayAfter: 1, MaxDelay: time.Minute, Threshold: 3, Duration: 15 * time.Minute}
+
+	user := User{PublicID: "user", Name: "user", Email: "user@example.com", Password: "password"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	fail := func() bool {
+		locked, err := user.RecordLoginFailure(db, user.ID, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return locked
+	}
+	reload := func() {
+		if err := db.Take(&user, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i <= 3; i++ {
+		if locked := fail(); locked != (i == 3) {
+			t.Errorf("failure %d locked the account: %v", i, locked)
+		}
+	}
+	reload()
+	if user.LockedFor() <= 0 || user.FailedLoginCount != 3 {
+		t.Fatalf("account not locked after the threshold: %+v", user)
+	}
+
+	// failures while locked do not extend the lock
+	lockedUntil := *user.LockedUntil
+	if fail() {
+		t.Error("failure while locked locked the account again")
+	}
+	reload()
+	if !user.LockedUntil.Equal(lockedUntil) {
+		t.Errorf("lock moved from %v to %v", lockedUntil, user.LockedUntil)
+	}
+
+	// once the lock expires the count starts over
+	db.Model(&User{}).Where("id = ?", user.ID).UpdateColumn("locked_until", time.Now().Add(-time.Second))
+	if fail() {
+		t.Error("one failure after the lock expired locked the account again")
+	}
+	reload()
+	if user.FailedLoginCount != 1 || user.LockedUntil != nil || user.LockedFor() != 0 {
+		t.Errorf("count %d, locked until %v after the lock expired", user.FailedLoginCount, user.LockedUntil)
+	}
+	if user.RetryAfter(policy) <= 0 {
+		t.Error("failure after the lock expired is not delayed")
+	}
+
+	if fail() {
+		t.Error("second failure after the lock expired locked the account")
+	}
+	if !fail() {
+		t.Error("reaching the threshold again did not lock the account")
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	os.Setenv("APP_KEY", testAppKey)
+	db := newTestDB(t, &User{})
+	policy := LockoutPolicy{Threshold: 1, Duration: 15 * time.Minute}
+
+	user := User{PublicID: "user", Name: "user", Email: "user@example.com", Password: "password"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if locked, err := user.RecordLoginFailure(db, user.ID, policy); err != nil || !locked {
+		t.Fatalf("RecordLoginFailure = %v, %v", locked, err)
+	}
+
+	if err := user.UnlockUser(db, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Take(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.LockedFor() != 0 || user.FailedLoginCount != 0 || user.RetryAfter(policy) != 0 {
+		t.Errorf("account still throttled after unlocking: %+v", user)
+	}
+}
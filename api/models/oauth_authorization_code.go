@@ -0,0 +1,153 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+const AuthorizationCodeExpiryInMinute = 1
+
+var (
+	ErrInvalidAuthorizationCode = errors.New("invalid or expired authorization code")
+	ErrReusedAuthorizationCode  = errors.New("authorization code reused")
+	ErrInvalidCodeVerifier      = errors.New("invalid code_verifier")
+	ErrInvalidRedirectURI       = errors.New("redirect_uri does not match the authorization request")
+)
+
+// OAuthAuthorizationCode stores the hash of a single-use authorization code
+// with the request it answers. The code is bound to a PKCE S256
+// CodeChallenge and to the sign in session it was issued in. Nonce is
+// passed on to the ID token. RedirectURISent records whether the request
+// named its redirect_uri, which the token request then has to repeat.
+type OAuthAuthorizationCode struct {
+	ID              uint32     `gorm:"primary_key;not null;unique" json:"id"`
+	CodeHash        string     `gorm:"size:255;not null;unique" json:"-"`
+	ClientID        uint32     `gorm:"not null" json:"client_id"`
+	UserID          uint32     `gorm:"not null" json:"user_id"`
+	SessionID       string     `gorm:"size:255;not null" json:"session_id"`
+	RedirectURI     string     `gorm:"type:text;not null" json:"redirect_uri"`
+	RedirectURISent bool       `gorm:"not null" json:"redirect_uri_sent"`
+	Scope           string     `gorm:"type:text;not null" json:"scope"`
+	Nonce           string     `gorm:"type:text;not null" json:"-"`
+	CodeChallenge   string     `gorm:"size:255;not null" json:"-"`
+	ExpiresAt       time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt          *time.Time `json:"used_at"`
+	CreatedAt       time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (OAuthAuthorizationCode) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+// SaveOAuthAuthorizationCode issues a code for the fields set on
+// authorizationCode and returns its plaintext value.
+func (authorizationCode *OAuthAuthorizationCode) SaveOAuthAuthorizationCode(db *gorm.DB) (string, error) {
+	code, err := crypto.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	authorizationCode.ID = 0
+	authorizationCode.CodeHash = crypto.SHA256Hash(code)
+	authorizationCode.ExpiresAt = time.Now().Add(time.Minute * AuthorizationCodeExpiryInMinute)
+	authorizationCode.UsedAt = nil
+	authorizationCode.CreatedAt = time.Now()
+
+	err = db.Debug().Create(&authorizationCode).Error
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+func (authorizationCode *OAuthAuthorizationCode) FindOAuthAuthorizationCode(db *gorm.DB, code string) (*OAuthAuthorizationCode, error) {
+	err := db.Debug().Model(&OAuthAuthorizationCode{}).Where("code_hash = ?", crypto.SHA256Hash(code)).Take(&authorizationCode).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &OAuthAuthorizationCode{}, ErrInvalidAuthorizationCode
+	}
+	if err != nil {
+		return &OAuthAuthorizationCode{}, err
+	}
+
+	return authorizationCode, nil
+}
+
+// VerifyCodeVerifier checks the PKCE code_verifier against the S256
+// challenge of the authorization request.
+// VerifyRedirectURI checks the redirect_uri of the token request: it has to
+// match the authorization request, and be present when that one had it
+// (RFC 6749 section 4.1.3).
+func (authorizationCode *OAuthAuthorizationCode) VerifyRedirectURI(redirectURI string) error {
+	if (redirectURI != "" || authorizationCode.RedirectURISent) && redirectURI != authorizationCode.RedirectURI {
+		return ErrInvalidRedirectURI
+	}
+
+	return nil
+}
+
+func (authorizationCode *OAuthAuthorizationCode) VerifyCodeVerifier(verifier string) error {
+	if !ValidPKCEValue(verifier) {
+		return ErrInvalidCodeVerifier
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(authorizationCode.CodeChallenge)) != 1 {
+		return ErrInvalidCodeVerifier
+	}
+
+	return nil
+}
+
+// ConsumeOAuthAuthorizationCode marks the code as used. A code that has been
+// used before gives ErrReusedAuthorizationCode, so the caller can revoke
+// what was issued for it.
+func (authorizationCode *OAuthAuthorizationCode) ConsumeOAuthAuthorizationCode(db *gorm.DB) error {
+	if authorizationCode.UsedAt != nil {
+		return ErrReusedAuthorizationCode
+	}
+	if time.Now().After(authorizationCode.ExpiresAt) {
+		return ErrInvalidAuthorizationCode
+	}
+
+	// only one concurrent request may exchange the code
+	consumed := db.Debug().Model(&OAuthAuthorizationCode{}).Where("id = ? AND used_at IS NULL", authorizationCode.ID).UpdateColumns(
+		map[string]interface{}{
+			"used_at": time.Now(),
+		},
+	)
+	if consumed.Error != nil {
+		return consumed.Error
+	}
+	if consumed.RowsAffected == 0 {
+		return ErrReusedAuthorizationCode
+	}
+
+	return nil
+}
+
+// ValidPKCEValue reports whether value is a well formed code_verifier or
+// S256 code_challenge: 43 to 128 unreserved characters (RFC 7636).
+func ValidPKCEValue(value string) bool {
+	if len(value) < 43 || len(value) > 128 {
+		return false
+	}
+
+	for _, c := range value {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-' || c == '.' || c == '_' || c == '~':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
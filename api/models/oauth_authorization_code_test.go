@@ -0,0 +1,146 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCodeChallenge is the S256 challenge of testCodeVerifier, computed with
+// printf %s "$verifier" | openssl dgst -sha256 -binary | basenc --base64url
+// and the = padding removed
+const (
+	testCodeVerifier  = "dBjftJeZ4CVP-mJ92IySVMBKRfYQ8ve8kBRBfb0RwB4"
+	testCodeChallenge = "wYOSrLVMFEpG6kQTzGMsrzCcbAERQx0kTQeg6XAf3u8"
+)
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	code := OAuthAuthorizationCode{CodeChallenge: testCodeChallenge}
+
+	tests := []struct {
+		name     string
+		verifier string
+		want     error
+	}{
+		{"matching verifier", testCodeVerifier, nil},
+		{"other verifier", strings.Replace(testCodeVerifier, "d", "e", 1), ErrInvalidCodeVerifier},
+		// the plain method is not supported
+		{"challenge as verifier", testCodeChallenge, ErrInvalidCodeVerifier},
+		{"empty", "", ErrInvalidCodeVerifier},
+		{"too short", testCodeVerifier[:42], ErrInvalidCodeVerifier},
+		{"too long", strings.Repeat("a", 129), ErrInvalidCodeVerifier},
+		{"reserved characters", testCodeVerifier[:42] + "/", ErrInvalidCodeVerifier},
+	}
+	for _, test := range tests {
+		if err := code.VerifyCodeVerifier(test.verifier); err != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestValidPKCEValue(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{testCodeVerifier, true},
+		{testCodeChallenge, true},
+		{strings.Repeat("a", 43), true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("-._~", 11), true},
+		{strings.Repeat("a", 42), false},
+		{strings.Repeat("a", 129), false},
+		{strings.Repeat("a", 42) + "=", false},
+		{strings.Repeat("a", 42) + "+", false},
+		{strings.Repeat("a", 42) + "é", false},
+	}
+	for _, test := range tests {
+		if got := ValidPKCEValue(test.value); got != test.valid {
+			t.Errorf("ValidPKCEValue(%q) = %v, want %v", test.value, got, test.valid)
+		}
+	}
+}
+
+func TestConsumeOAuthAuthorizationCode(t *testing.T) {
+	db := newTestDB(t, &OAuthAuthorizationCode{})
+
+	issued := OAuthAuthorizationCode{ClientID: 1, UserID: 2, SessionID: "session", RedirectURI: "https://app.example.com/callback", CodeChallenge: testCodeChallenge}
+	code, err := issued.SaveOAuthAuthorizationCode(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := (&OAuthAuthorizationCode{}).FindOAuthAuthorizationCode(db, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.CodeHash == code || found.RedirectURI != issued.RedirectURI {
+		t.Errorf("found code %+v", found)
+	}
+	if err := found.VerifyCodeVerifier(testCodeVerifier); err != nil {
+		t.Errorf("stored challenge does not verify: %v", err)
+	}
+
+	if err := found.ConsumeOAuthAuthorizationCode(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second exchange, from a fresh lookup or a concurrent one, is a reuse
+	again, _ := (&OAuthAuthorizationCode{}).FindOAuthAuthorizationCode(db, code)
+	if err := again.ConsumeOAuthAuthorizationCode(db); err != ErrReusedAuthorizationCode {
+		t.Errorf("second exchange: got %v, want %v", err, ErrReusedAuthorizationCode)
+	}
+	stale := *found
+	stale.UsedAt = nil
+	if err := stale.ConsumeOAuthAuthorizationCode(db); err != ErrReusedAuthorizationCode {
+		t.Errorf("concurrent exchange: got %v, want %v", err, ErrReusedAuthorizationCode)
+	}
+
+	if _, err := (&OAuthAuthorizationCode{}).FindOAuthAuthorizationCode(db, "unknown"); err != ErrInvalidAuthorizationCode {
+		t.Errorf("unknown code: got %v, want %v", err, ErrInvalidAuthorizationCode)
+	}
+}
+
+func TestConsumeExpiredOAuthAuthorizationCode(t *testing.T) {
+	db := newTestDB(t, &OAuthAuthorizationCode{})
+
+	issued := OAuthAuthorizationCode{CodeChallenge: testCodeChallenge}
+	code, err := issued.SaveOAuthAuthorizationCode(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&OAuthAuthorizationCode{}).Where("id = ?", issued.ID).UpdateColumn("expires_at", time.Now().Add(-time.Second))
+
+	found, err := (&OAuthAuthorizationCode{}).FindOAuthAuthorizationCode(db, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := found.ConsumeOAuthAuthorizationCode(db); err != ErrInvalidAuthorizationCode {
+		t.Errorf("got %v, want %v", err, ErrInvalidAuthorizationCode)
+	}
+}
+
+func TestVerifyRedirectURI(t *testing.T) {
+	const redirectURI = "https://app.example.com/callback"
+
+	tests := []struct {
+		name  string
+		sent  bool
+		given string
+		want  error
+	}{
+		{"repeated", true, redirectURI, nil},
+		// RFC 6749 section 4.1.3
+		{"missing after it was sent", true, "", ErrInvalidRedirectURI},
+		{"other", true, "https://evil.example.com/callback", ErrInvalidRedirectURI},
+		{"omitted both times", false, "", nil},
+		{"only in the token request", false, redirectURI, nil},
+		{"other than the registered one", false, "https://evil.example.com/callback", ErrInvalidRedirectURI},
+	}
+	for _, test := range tests {
+		code := OAuthAuthorizationCode{RedirectURI: redirectURI, RedirectURISent: test.sent}
+		if err := code.VerifyRedirectURI(test.given); err != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package models
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+// Client types of RFC 6749 section 2.1. Public clients, e.g. mobile apps,
+// cannot keep a secret.
+const (
+	OAuthClientPublic       = "public"
+	OAuthClientConfidential = "confidential"
+)
+
+// Grant types a client can be allowed to use.
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+var (
+	ErrInvalidClient       = errors.New("invalid client credentials")
+	ErrOAuthClientNotFound = errors.New("client not found")
+	ErrPublicClient        = errors.New("public clients have no secret")
+)
+
+// OAuthClient is a registered client. Only the SHA-256 hash of the client
+// secret is stored. After a rotation the previous secret keeps working
+// until PreviousSecretExpiresAt, so the client can be redeployed.
+// RedirectURIs, GrantTypes and Scopes are space separated lists of what
+// the client may use.
+type OAuthClient struct {
+	ID                      uint32     `gorm:"primary_key;not null;unique" json:"id"`
+	ClientID                string     `gorm:"size:255;not null;unique" json:"client_id"`
+	ClientSecretHash        string     `gorm:"size:255;not null" json:"-"`
+	PreviousSecretHash      string     `gorm:"size:255;not null" json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"-"`
+	Type                    string     `gorm:"column:client_type;size:16;not null" json:"type"`
+	Name                    string     `gorm:"size:255;not null" json:"name"`
+	LogoURI                 string     `gorm:"column:logo_uri;type:text;not null" json:"logo_uri"`
+	RedirectURIs            string     `gorm:"type:text;not null" json:"redirect_uris"`
+	GrantTypes              string     `gorm:"type:text;not null" json:"grant_types"`
+	Scopes                  string     `gorm:"type:text;not null" json:"scopes"`
+	CreatedAt               time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt               time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// Prepare normalizes the client metadata. Without grant types a client
+// gets the authorization code flow with refresh tokens.
+func (client *OAuthClient) Prepare() {
+	client.ID = 0
+	client.Type = strings.ToLower(strings.TrimSpace(client.Type))
+	if client.Type == "" {
+		client.Type = OAuthClientConfidential
+	}
+	client.Name = strings.TrimSpace(client.Name)
+	client.LogoURI = strings.TrimSpace(client.LogoURI)
+	client.RedirectURIs = strings.Join(strings.Fields(client.RedirectURIs), " ")
+	client.GrantTypes = JoinScopes(client.GrantTypes)
+	if client.GrantTypes == "" {
+		client.GrantTypes = JoinScopes(GrantAuthorizationCode, GrantRefreshToken)
+	}
+	client.Scopes = JoinScopes(client.Scopes)
+	client.CreatedAt = time.Now()
+	client.UpdatedAt = time.Now()
+}
+
+func (client *OAuthClient) Validate() error {
+	if client.Name == "" {
+		return errors.New("required name")
+	}
+	if len(client.Name) > 255 {
+		return errors.New("name is too long")
+	}
+	if client.Type != OAuthClientPublic && client.Type != OAuthClientConfidential {
+		return errors.New("type must be public or confidential")
+	}
+
+	for _, grant := range strings.Fields(client.GrantTypes) {
+		switch grant {
+		case GrantAuthorizationCode, GrantRefreshToken, GrantDeviceCode:
+		case GrantClientCredentials:
+			if client.Type == OAuthClientPublic {
+				return errors.New("public clients cannot use client_credentials")
+			}
+		default:
+			return errors.New("unsupported grant type " + grant)
+		}
+	}
+
+	// the logo is shown on the consent page, only load it over https
+	if client.LogoURI != "" {
+		parsed, err := url.Parse(client.LogoURI)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return errors.New("logo URI must be an https URL")
+		}
+	}
+
+	return client.ValidateRedirectURIs()
+}
+
+// ValidateRedirectURIs checks that the redirect URIs are absolute, since
+// they are compared as registered (RFC 6749 section 3.1.2), and that
+// authorization_code has one to redirect to.
+func (client *OAuthClient) ValidateRedirectURIs() error {
+	for _, uri := range strings.Fields(client.RedirectURIs) {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return errors.New("invalid redirect URI " + uri)
+		}
+		if (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host == "" {
+			return errors.New("invalid redirect URI " + uri)
+		}
+	}
+	if client.AllowsGrant(GrantAuthorizationCode) && client.RedirectURIs == "" {
+		return errors.New("authorization_code needs a redirect URI")
+	}
+
+	return nil
+}
+
+// SaveOAuthClient registers the client under a new client_id. Unless it is
+// public, a client secret is generated and returned; only its hash is kept.
+func (client *OAuthClient) SaveOAuthClient(db *gorm.DB) (*OAuthClient, string, error) {
+	clientID, err := crypto.RandomToken(16)
+	if err != nil {
+		return &OAuthClient{}, "", err
+	}
+
+	clientSecret := ""
+	if !client.Public() {
+		clientSecret, err = crypto.RandomToken(32)
+		if err != nil {
+			return &OAuthClient{}, "", err
+		}
+		client.ClientSecretHash = crypto.SHA256Hash(clientSecret)
+	}
+	client.ClientID = clientID
+
+	err = db.Debug().Create(&client).Error
+	if err != nil {
+		return &OAuthClient{}, "", err
+	}
+
+	return client, clientSecret, nil
+}
+
+func (client *OAuthClient) FindAllOAuthClients(db *gorm.DB) (*[]OAuthClient, error) {
+	clients := []OAuthClient{}
+	err := db.Debug().Model(&OAuthClient{}).Order("name").Find(&clients).Error
+	if err != nil {
+		return &[]OAuthClient{}, err
+	}
+
+	return &clients, nil
+}
+
+// UpdateOAuthClient replaces the metadata of the client clientID with the
+// one set on client. The type and the secret are kept.
+func (client *OAuthClient) UpdateOAuthClient(db *gorm.DB, clientID string) (*OAuthClient, error) {
+	updated := db.Debug().Model(&OAuthClient{}).Where("client_id = ?", clientID).UpdateColumns(
+		map[string]interface{}{
+			"name":          client.Name,
+			"logo_uri":      client.LogoURI,
+			"redirect_uris": client.RedirectURIs,
+			"grant_types":   client.GrantTypes,
+			"scopes":        client.Scopes,
+			"updated_at":    time.Now(),
+		},
+	)
+	if updated.Error != nil {
+		return &OAuthClient{}, updated.Error
+	}
+	if updated.RowsAffected == 0 {
+		return &OAuthClient{}, ErrOAuthClientNotFound
+	}
+
+	found := OAuthClient{}
+	return found.FindOAuthClientByClientID(db, clientID)
+}
+
+// RotateOAuthClientSecret gives the client clientID a new secret and
+// returns it. The previous secret keeps working for gracePeriod, which may
+// be zero to stop it at once, e.g. after a leak.
+func (client *OAuthClient) RotateOAuthClientSecret(db *gorm.DB, clientID string, gracePeriod time.Duration) (string, error) {
+	found, err := client.FindOAuthClientByClientID(db, clientID)
+	if err == ErrInvalidClient {
+		return "", ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if found.Public() {
+		return "", ErrPublicClient
+	}
+
+	clientSecret, err := crypto.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	columns := map[string]interface{}{
+		"client_secret_hash":         crypto.SHA256Hash(clientSecret),
+		"previous_secret_hash":       "",
+		"previous_secret_expires_at": nil,
+		"updated_at":                 now,
+	}
+	if gracePeriod > 0 {
+		columns["previous_secret_hash"] = found.ClientSecretHash
+		columns["previous_secret_expires_at"] = now.Add(gracePeriod)
+	}
+
+	// a concurrent rotation would silently drop one of the secrets
+	rotated := db.Debug().Model(&OAuthClient{}).Where("id = ? AND client_secret_hash = ?", found.ID, found.ClientSecretHash).UpdateColumns(columns)
+	if rotated.Error != nil {
+		return "", rotated.Error
+	}
+	if rotated.RowsAffected == 0 {
+		return "", errors.New("the secret was rotated concurrently, try again")
+	}
+
+	return clientSecret, nil
+}
+
+// DeleteOAuthClient removes the client with its authorization codes and
+// consents, and revokes the refresh tokens issued to it.
+func (client *OAuthClient) DeleteOAuthClient(db *gorm.DB, clientID string) error {
+	deleted := db.Debug().Where("client_id = ?", clientID).Delete(&OAuthClient{})
+	if deleted.Error != nil {
+		return deleted.Error
+	}
+	if deleted.RowsAffected == 0 {
+		return ErrOAuthClientNotFound
+	}
+
+	return db.Debug().Model(&RefreshToken{}).Where("client_id = ? AND revoked_at IS NULL", clientID).UpdateColumns(
+		map[string]interface{}{
+			"revoked_at": time.Now(),
+		},
+	).Error
+}
+
+func (client *OAuthClient) FindOAuthClientByClientID(db *gorm.DB, clientID string) (*OAuthClient, error) {
+	err := db.Debug().Model(&OAuthClient{}).Where("client_id = ?", clientID).Take(&client).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &OAuthClient{}, ErrInvalidClient
+	}
+	if err != nil {
+		return &OAuthClient{}, err
+	}
+
+	return client, nil
+}
+
+func (client *OAuthClient) FindOAuthClientByID(db *gorm.DB, id uint32) (*OAuthClient, error) {
+	err := db.Debug().Model(&OAuthClient{}).Where("id = ?", id).Take(&client).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &OAuthClient{}, ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return &OAuthClient{}, err
+	}
+
+	return client, nil
+}
+
+// Public reports whether the client cannot keep a secret.
+func (client *OAuthClient) Public() bool {
+	return client.Type == OAuthClientPublic
+}
+
+func (client *OAuthClient) AllowsGrant(grant string) bool {
+	for _, allowed := range strings.Fields(client.GrantTypes) {
+		if allowed == grant {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GrantsScope reports whether the client is currently allowed every scope
+// in scope, a space separated list. Tokens issued before the client lost a
+// scope are no longer reported active.
+func (client *OAuthClient) GrantsScope(scope string) bool {
+	return ScopeCovers(client.Scopes, scope)
+}
+
+// RedirectURI resolves the redirect URI of an authorization request: it has
+// to be registered exactly, and may only be left out by clients with a
+// single registered URI.
+func (client *OAuthClient) RedirectURI(requested string) (string, bool) {
+	registered := strings.Fields(client.RedirectURIs)
+	if requested == "" {
+		if len(registered) == 1 {
+			return registered[0], true
+		}
+		return "", false
+	}
+
+	for _, uri := range registered {
+		if uri == requested {
+			return uri, true
+		}
+	}
+
+	return "", false
+}
+
+func (client *OAuthClient) Authenticate(db *gorm.DB, clientID, clientSecret string) (*OAuthClient, error) {
+	if clientID == "" || clientSecret == "" {
+		return &OAuthClient{}, ErrInvalidClient
+	}
+
+	found, err := client.FindOAuthClientByClientID(db, clientID)
+	if err != nil {
+		return &OAuthClient{}, err
+	}
+
+	if found.Public() || found.ClientSecretHash == "" {
+		return &OAuthClient{}, ErrInvalidClient
+	}
+
+	secretHash := crypto.SHA256Hash(clientSecret)
+	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(found.ClientSecretHash)) == 1 {
+		return found, nil
+	}
+
+	// the secret before the last rotation, during its grace period
+	previousValid := found.PreviousSecretHash != "" && found.PreviousSecretExpiresAt != nil && time.Now().Before(*found.PreviousSecretExpiresAt)
+	if previousValid && subtle.ConstantTimeCompare([]byte(secretHash), []byte(found.PreviousSecretHash)) == 1 {
+		return found, nil
+	}
+
+	return &OAuthClient{}, ErrInvalidClient
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGrantsScopeAfterUpdate(t *testing.T) {
+	db := newTestDB(t, &OAuthClient{})
+
+	client := OAuthClient{Name: "orders", GrantTypes: GrantClientCredentials, Scopes: "orders:read orders:write"}
+	client.Prepare()
+	created, _, err := client.SaveOAuthClient(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created.GrantsScope("orders:read orders:write") {
+		t.Fatalf("client with scopes %q does not grant them", created.Scopes)
+	}
+	if created.GrantsScope("orders:read users:read") {
+		t.Error("client grants a scope it was never registered with")
+	}
+
+	// a token for orders:write issued before the update is no longer covered
+	update := OAuthClient{Name: "orders", GrantTypes: GrantClientCredentials, Scopes: "orders:read"}
+	updated, err := update.UpdateOAuthClient(db, created.ClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.GrantsScope("orders:write") {
+		t.Error("client still grants a scope taken off it")
+	}
+	if !updated.GrantsScope("orders:read") {
+		t.Error("client lost a scope it kept")
+	}
+}
+
+func TestSaveOAuthClient(t *testing.T) {
+	db := newTestDB(t, &OAuthClient{})
+
+	confidential := OAuthClient{Name: " Orders ", RedirectURIs: "https://orders.example.com/callback"}
+	confidential.Prepare()
+	if err := confidential.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	created, secret, err := confidential.SaveOAuthClient(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ClientID == "" || secret == "" || created.ClientSecretHash == secret {
+		t.Fatalf("confidential client %+v with secret %q", created, secret)
+	}
+	if created.Type != OAuthClientConfidential || created.Name != "Orders" || !created.AllowsGrant(GrantRefreshToken) {
+		t.Errorf("defaults not applied: %+v", created)
+	}
+	if _, err := (&OAuthClient{}).Authenticate(db, created.ClientID, secret); err != nil {
+		t.Errorf("authenticating with the secret: %v", err)
+	}
+	if _, err := (&OAuthClient{}).Authenticate(db, created.ClientID, "wrong"); err != ErrInvalidClient {
+		t.Errorf("authenticating with a wrong secret: %v, want %v", err, ErrInvalidClient)
+	}
+
+	public := OAuthClient{Name: "app", Type: "Public", RedirectURIs: "com.example.app:/callback"}
+	public.Prepare()
+	if err := public.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	created, secret, err = public.SaveOAuthClient(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != "" || created.ClientSecretHash != "" {
+		t.Errorf("public client got a secret %q", secret)
+	}
+	if _, err := (&OAuthClient{}).Authenticate(db, created.ClientID, ""); err != ErrInvalidClient {
+		t.Errorf("authenticating a public client: %v, want %v", err, ErrInvalidClient)
+	}
+}
+
+func TestValidateOAuthClient(t *testing.T) {
+	invalid := map[string]OAuthClient{
+		"no name":                          {RedirectURIs: "https://example.com/callback"},
+		"unknown type":                     {Name: "app", Type: "trusted", RedirectURIs: "https://example.com/callback"},
+		"unsupported grant":                {Name: "app", GrantTypes: "password"},
+		"public client_credentials":        {Name: "app", Type: OAuthClientPublic, GrantTypes: GrantClientCredentials},
+		"relative redirect URI":            {Name: "app", RedirectURIs: "/callback"},
+		"redirect URI with a fragment":     {Name: "app", RedirectURIs: "https://example.com/callback#top"},
+		"authorization_code without a URI": {Name: "app", GrantTypes: GrantAuthorizationCode},
+		"logo over http":                   {Name: "app", GrantTypes: GrantClientCredentials, LogoURI: "http://example.com/logo.png"},
+	}
+	for name, client := range invalid {
+		client.Prepare()
+		if err := client.Validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestRotateOAuthClientSecret(t *testing.T) {
+	db := newTestDB(t, &OAuthClient{})
+
+	client := OAuthClient{Name: "orders", GrantTypes: GrantClientCredentials}
+	client.Prepare()
+	created, first, err := client.SaveOAuthClient(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := (&OAuthClient{}).RotateOAuthClientSecret(db, created.ClientID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both secrets work during the grace period
+	for _, secret := range []string{first, second} {
+		if _, err := (&OAuthClient{}).Authenticate(db, created.ClientID, secret); err != nil {
+			t.Errorf("authenticating during the grace period: %v", err)
+		}
+	}
+
+	// and only the new one after it
+	db.Model(&OAuthClient{}).Where("id = ?", created.ID).UpdateColumn("previous_secret_expires_at", time.Now().Add(-time.Second))
+	if _, err := (&OAuthClient{}).Authenticate(db, created.ClientID, first); err != ErrInvalidClient {
+		t.Errorf("previous secret after the grace period: %v, want %v", err, ErrInvalidClient)
+	}
+	if _, err := (&OAuthClient{}).Authenticate(db, created.ClientID, second); err != nil {
+		t.Errorf("new secret after the grace period: %v", err)
+	}
+
+	// without a grace period the previous secret stops at once
+	third, err := (&OAuthClient{}).RotateOAuthClientSecret(db, created.ClientID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&OAuthClient{}).Authenticate(db, created.ClientID, second); err != ErrInvalidClient {
+		t.Errorf("previous secret without a grace period: %v, want %v", err, ErrInvalidClient)
+	}
+	if _, err := (&OAuthClient{}).Authenticate(db, created.ClientID, third); err != nil {
+		t.Errorf("new secret: %v", err)
+	}
+
+	public := OAuthClient{Name: "app", Type: OAuthClientPublic, GrantTypes: GrantDeviceCode}
+	public.Prepare()
+	publicClient, _, err := public.SaveOAuthClient(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&OAuthClient{}).RotateOAuthClientSecret(db, publicClient.ClientID, time.Hour); err != ErrPublicClient {
+		t.Errorf("rotating a public client: %v, want %v", err, ErrPublicClient)
+	}
+	if _, err := (&OAuthClient{}).RotateOAuthClientSecret(db, "unknown", time.Hour); err != ErrOAuthClientNotFound {
+		t.Errorf("rotating an unknown client: %v, want %v", err, ErrOAuthClientNotFound)
+	}
+}
+
+func TestDeleteOAuthClient(t *testing.T) {
+	db := newTestDB(t, &OAuthClient{}, &RefreshToken{})
+
+	client := OAuthClient{Name: "orders", RedirectURIs: "https://orders.example.com/callback"}
+	client.Prepare()
+	created, _, err := client.SaveOAuthClient(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := (&RefreshToken{}).SaveRefreshToken(db, 1, "auth-global/oauth", "", created.ClientID, "openid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&OAuthClient{}).DeleteOAuthClient(db, created.ClientID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&OAuthClient{}).FindOAuthClientByClientID(db, created.ClientID); err != ErrInvalidClient {
+		t.Errorf("deleted client: %v, want %v", err, ErrInvalidClient)
+	}
+	if _, err := (&RefreshToken{}).RotateRefreshToken(db, token, created.ClientID); err != ErrInvalidRefreshToken {
+		t.Errorf("refresh token of a deleted client: %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if err := (&OAuthClient{}).DeleteOAuthClient(db, created.ClientID); err != ErrOAuthClientNotFound {
+		t.Errorf("deleting twice: %v, want %v", err, ErrOAuthClientNotFound)
+	}
+}
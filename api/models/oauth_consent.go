@@ -0,0 +1,95 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// OAuthConsent remembers the scopes a user allowed a client, so the consent
+// page is only shown again for new scopes.
+type OAuthConsent struct {
+	ID        uint32    `gorm:"primary_key;not null;unique" json:"id"`
+	UserID    uint32    `gorm:"not null" json:"user_id"`
+	ClientID  uint32    `gorm:"not null" json:"client_id"`
+	Scope     string    `gorm:"type:text;not null" json:"scope"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (OAuthConsent) TableName() string {
+	return "oauth_consents"
+}
+
+// HasOAuthConsent reports whether userID has already allowed clientID every
+// scope in scope.
+func (consent *OAuthConsent) HasOAuthConsent(db *gorm.DB, userID, clientID uint32, scope string) (bool, error) {
+	err := db.Debug().Model(&OAuthConsent{}).Where("user_id = ? AND client_id = ?", userID, clientID).Take(&consent).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return ScopeCovers(consent.Scope, scope), nil
+}
+
+// SaveOAuthConsent adds scope to what userID allowed clientID.
+func (consent *OAuthConsent) SaveOAuthConsent(db *gorm.DB, userID, clientID uint32, scope string) error {
+	found := OAuthConsent{}
+	err := db.Debug().Model(&OAuthConsent{}).Where("user_id = ? AND client_id = ?", userID, clientID).Take(&found).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return db.Debug().Create(&OAuthConsent{
+			UserID:    userID,
+			ClientID:  clientID,
+			Scope:     JoinScopes(scope),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	return db.Debug().Model(&OAuthConsent{}).Where("id = ?", found.ID).UpdateColumns(
+		map[string]interface{}{
+			"scope":      JoinScopes(found.Scope, scope),
+			"updated_at": time.Now(),
+		},
+	).Error
+}
+
+// ScopeCovers reports whether every scope in requested is in granted. Both
+// are space separated lists.
+func ScopeCovers(granted, requested string) bool {
+	allowed := map[string]bool{}
+	for _, scope := range strings.Fields(granted) {
+		allowed[scope] = true
+	}
+
+	for _, scope := range strings.Fields(requested) {
+		if !allowed[scope] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// JoinScopes merges space separated scope lists, dropping duplicates.
+func JoinScopes(scopes ...string) string {
+	seen := map[string]bool{}
+	joined := []string{}
+	for _, list := range scopes {
+		for _, scope := range strings.Fields(list) {
+			if !seen[scope] {
+				seen[scope] = true
+				joined = append(joined, scope)
+			}
+		}
+	}
+
+	return strings.Join(joined, " ")
+}
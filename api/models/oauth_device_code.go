@@ -0,0 +1,243 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+const DeviceCodeExpiryInMinute = 10
+
+// DeviceCodePollIntervalInSecond is how long a device waits between two
+// polls of the token endpoint. Polling faster adds five seconds to it
+// (RFC 8628 section 3.5).
+const DeviceCodePollIntervalInSecond = 5
+
+// user codes avoid vowels, so they do not spell words, and characters that
+// look alike (RFC 8628 section 6.1)
+const (
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+var (
+	ErrInvalidDeviceCode    = errors.New("invalid device code")
+	ErrExpiredDeviceCode    = errors.New("device code expired")
+	ErrInvalidUserCode      = errors.New("invalid or expired code")
+	ErrAuthorizationPending = errors.New("the user has not approved the request yet")
+	ErrSlowDown             = errors.New("polling too often")
+	ErrDeviceAccessDenied   = errors.New("the user denied the request")
+)
+
+// OAuthDeviceCode is a device authorization request (RFC 8628). The device
+// polls with the device code while the user enters the user code in a
+// browser; only the hashes of both are stored. UserID and SessionID are
+// set once the user approves it.
+type OAuthDeviceCode struct {
+	ID             uint32     `gorm:"primary_key;not null;unique" json:"id"`
+	DeviceCodeHash string     `gorm:"size:255;not null;unique" json:"-"`
+	UserCodeHash   string     `gorm:"size:255;not null;unique" json:"-"`
+	ClientID       uint32     `gorm:"not null" json:"client_id"`
+	Scope          string     `gorm:"type:text;not null" json:"scope"`
+	UserID         *uint32    `json:"user_id"`
+	SessionID      string     `gorm:"size:255;not null" json:"session_id"`
+	Interval       int        `gorm:"column:poll_interval;not null" json:"interval"`
+	LastPolledAt   *time.Time `json:"last_polled_at"`
+	ApprovedAt     *time.Time `json:"approved_at"`
+	DeniedAt       *time.Time `json:"denied_at"`
+	UsedAt         *time.Time `json:"used_at"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (OAuthDeviceCode) TableName() string {
+	return "oauth_device_codes"
+}
+
+// SaveOAuthDeviceCode starts a device authorization request for the client
+// and scope set on deviceCode, and returns the plaintext device code and
+// the user code formatted for display.
+func (deviceCode *OAuthDeviceCode) SaveOAuthDeviceCode(db *gorm.DB) (string, string, error) {
+	// expired requests are refused by expires_at, no need to keep them
+	err := db.Debug().Where("expires_at < ?", time.Now()).Delete(&OAuthDeviceCode{}).Error
+	if err != nil {
+		return "", "", err
+	}
+
+	code, err := crypto.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	userCode, err := randomUserCode()
+	if err != nil {
+		return "", "", err
+	}
+
+	deviceCode.ID = 0
+	deviceCode.DeviceCodeHash = crypto.SHA256Hash(code)
+	deviceCode.UserCodeHash = crypto.SHA256Hash(userCode)
+	deviceCode.UserID = nil
+	deviceCode.SessionID = ""
+	deviceCode.Interval = DeviceCodePollIntervalInSecond
+	deviceCode.LastPolledAt = nil
+	deviceCode.ApprovedAt = nil
+	deviceCode.DeniedAt = nil
+	deviceCode.UsedAt = nil
+	deviceCode.ExpiresAt = time.Now().Add(time.Minute * DeviceCodeExpiryInMinute)
+	deviceCode.CreatedAt = time.Now()
+
+	err = db.Debug().Create(&deviceCode).Error
+	if err != nil {
+		return "", "", err
+	}
+
+	return code, FormatUserCode(userCode), nil
+}
+
+// FindPendingOAuthDeviceCode returns the request of userCode while it is
+// waiting for the user.
+func (deviceCode *OAuthDeviceCode) FindPendingOAuthDeviceCode(db *gorm.DB, userCode string) (*OAuthDeviceCode, error) {
+	err := db.Debug().Model(&OAuthDeviceCode{}).
+		Where("user_code_hash = ? AND approved_at IS NULL AND denied_at IS NULL AND expires_at > ?", crypto.SHA256Hash(NormalizeUserCode(userCode)), time.Now()).
+		Take(&deviceCode).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &OAuthDeviceCode{}, ErrInvalidUserCode
+	}
+	if err != nil {
+		return &OAuthDeviceCode{}, err
+	}
+
+	return deviceCode, nil
+}
+
+// ApproveOAuthDeviceCode lets the device sign in as userID, who approved it
+// in the browser session sessionID.
+func (deviceCode *OAuthDeviceCode) ApproveOAuthDeviceCode(db *gorm.DB, userID uint32, sessionID string) error {
+	return deviceCode.decide(db, map[string]interface{}{
+		"approved_at": time.Now(),
+		"user_id":     userID,
+		"session_id":  sessionID,
+	})
+}
+
+func (deviceCode *OAuthDeviceCode) DenyOAuthDeviceCode(db *gorm.DB) error {
+	return deviceCode.decide(db, map[string]interface{}{
+		"denied_at": time.Now(),
+	})
+}
+
+// decide records the user's answer, unless the request was answered or
+// expired in the meantime.
+func (deviceCode *OAuthDeviceCode) decide(db *gorm.DB, columns map[string]interface{}) error {
+	decided := db.Debug().Model(&OAuthDeviceCode{}).
+		Where("id = ? AND approved_at IS NULL AND denied_at IS NULL AND expires_at > ?", deviceCode.ID, time.Now()).
+		UpdateColumns(columns)
+	if decided.Error != nil {
+		return decided.Error
+	}
+	if decided.RowsAffected == 0 {
+		return ErrInvalidUserCode
+	}
+
+	return nil
+}
+
+// PollOAuthDeviceCode answers a poll of the device code by clientID. It
+// returns the approved request once, and otherwise tells the device to
+// keep waiting, slow down or give up.
+func (deviceCode *OAuthDeviceCode) PollOAuthDeviceCode(db *gorm.DB, code string, clientID uint32) (*OAuthDeviceCode, error) {
+	err := db.Debug().Model(&OAuthDeviceCode{}).Where("device_code_hash = ?", crypto.SHA256Hash(code)).Take(&deviceCode).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &OAuthDeviceCode{}, ErrInvalidDeviceCode
+	}
+	if err != nil {
+		return &OAuthDeviceCode{}, err
+	}
+	if deviceCode.ClientID != clientID || deviceCode.UsedAt != nil {
+		return &OAuthDeviceCode{}, ErrInvalidDeviceCode
+	}
+
+	now := time.Now()
+	if now.After(deviceCode.ExpiresAt) {
+		return &OAuthDeviceCode{}, ErrExpiredDeviceCode
+	}
+
+	columns := map[string]interface{}{
+		"last_polled_at": now,
+	}
+	tooSoon := deviceCode.LastPolledAt != nil && now.Before(deviceCode.LastPolledAt.Add(time.Duration(deviceCode.Interval)*time.Second))
+	if tooSoon {
+		columns["poll_interval"] = deviceCode.Interval + DeviceCodePollIntervalInSecond
+	}
+	err = db.Debug().Model(&OAuthDeviceCode{}).Where("id = ?", deviceCode.ID).UpdateColumns(columns).Error
+	if err != nil {
+		return &OAuthDeviceCode{}, err
+	}
+	if tooSoon {
+		return &OAuthDeviceCode{}, ErrSlowDown
+	}
+
+	if deviceCode.DeniedAt != nil {
+		return &OAuthDeviceCode{}, ErrDeviceAccessDenied
+	}
+	if deviceCode.ApprovedAt == nil || deviceCode.UserID == nil {
+		return &OAuthDeviceCode{}, ErrAuthorizationPending
+	}
+
+	// only one concurrent poll may get the tokens
+	consumed := db.Debug().Model(&OAuthDeviceCode{}).Where("id = ? AND used_at IS NULL", deviceCode.ID).UpdateColumns(
+		map[string]interface{}{
+			"used_at": now,
+		},
+	)
+	if consumed.Error != nil {
+		return &OAuthDeviceCode{}, consumed.Error
+	}
+	if consumed.RowsAffected == 0 {
+		return &OAuthDeviceCode{}, ErrInvalidDeviceCode
+	}
+
+	return deviceCode, nil
+}
+
+// NormalizeUserCode undoes the formatting of a user code as typed by the
+// user: case, spaces and dashes do not matter.
+func NormalizeUserCode(userCode string) string {
+	return strings.Map(func(c rune) rune {
+		if c == '-' || unicode.IsSpace(c) {
+			return -1
+		}
+		return unicode.ToUpper(c)
+	}, userCode)
+}
+
+// FormatUserCode splits a user code in two halves for display, e.g.
+// BDFG-HJKL.
+func FormatUserCode(userCode string) string {
+	userCode = NormalizeUserCode(userCode)
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+func randomUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
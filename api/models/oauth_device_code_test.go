@@ -0,0 +1,123 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollOAuthDeviceCode(t *testing.T) {
+	db := newTestDB(t, &OAuthDeviceCode{})
+	waited := func(deviceCode *OAuthDeviceCode) {
+		t.Helper()
+		err := db.Model(&OAuthDeviceCode{}).Where("id = ?", deviceCode.ID).UpdateColumn("last_polled_at", time.Now().Add(-time.Minute)).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request := OAuthDeviceCode{ClientID: 1, Scope: "openid"}
+	code, userCode, err := request.SaveOAuthDeviceCode(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&OAuthDeviceCode{}).PollOAuthDeviceCode(db, code, 1); err != ErrAuthorizationPending {
+		t.Fatalf("first poll: %v, want %v", err, ErrAuthorizationPending)
+	}
+
+	// polling again at once slows the device down by five seconds
+	if _, err := (&OAuthDeviceCode{}).PollOAuthDeviceCode(db, code, 1); err != ErrSlowDown {
+		t.Fatalf("polling too soon: %v, want %v", err, ErrSlowDown)
+	}
+	found := OAuthDeviceCode{}
+	db.Where("id = ?", request.ID).Take(&found)
+	if found.Interval != 2*DeviceCodePollIntervalInSecond {
+		t.Errorf("interval after slow_down: %d, want %d", found.Interval, 2*DeviceCodePollIntervalInSecond)
+	}
+
+	waited(&request)
+	if _, err := (&OAuthDeviceCode{}).PollOAuthDeviceCode(db, code, 1); err != ErrAuthorizationPending {
+		t.Fatalf("poll after waiting: %v, want %v", err, ErrAuthorizationPending)
+	}
+
+	// the code belongs to the client it was issued to
+	waited(&request)
+	if _, err := (&OAuthDeviceCode{}).PollOAuthDeviceCode(db, code, 2); err != ErrInvalidDeviceCode {
+		t.Fatalf("poll by another client: %v, want %v", err, ErrInvalidDeviceCode)
+	}
+	if _, err := (&OAuthDeviceCode{}).PollOAuthDeviceCode(db, "unknown", 1); err != ErrInvalidDeviceCode {
+		t.Fatalf("poll with an unknown code: %v, want %v", err, ErrInvalidDeviceCode)
+	}
+
+	// the user may type the code in lower case and without the dash
+	pending, err := (&OAuthDeviceCode{}).FindPendingOAuthDeviceCode(db, strings.ToLower(strings.Replace(userCode, "-", " ", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pending.ApproveOAuthDeviceCode(db, 7, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&OAuthDeviceCode{}).FindPendingOAuthDeviceCode(db, userCode); err != ErrInvalidUserCode {
+		t.Errorf("user code after approval: %v, want %v", err, ErrInvalidUserCode)
+	}
+
+	waited(&request)
+	approved, err := (&OAuthDeviceCode{}).PollOAuthDeviceCode(db, code, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.UserID == nil || *approved.UserID != 7 || approved.SessionID != "session" || approved.Scope != "openid" {
+		t.Errorf("approved request: %+v", approved)
+	}
+
+	// the tokens are handed out once
+	waited(&request)
+	if _, err := (&OAuthDeviceCode{}).PollOAuthDeviceCode(db, code, 1); err != ErrInvalidDeviceCode {
+		t.Errorf("poll after the exchange: %v, want %v", err, ErrInvalidDeviceCode)
+	}
+}
+
+func TestPollOAuthDeviceCodeDenied(t *testing.T) {
+	db := newTestDB(t, &OAuthDeviceCode{})
+
+	request := OAuthDeviceCode{ClientID: 1}
+	code, userCode, err := request.SaveOAuthDeviceCode(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := (&OAuthDeviceCode{}).FindPendingOAuthDeviceCode(db, userCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pending.DenyOAuthDeviceCode(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pending.ApproveOAuthDeviceCode(db, 7, "session"); err != ErrInvalidUserCode {
+		t.Errorf("approving a denied request: %v, want %v", err, ErrInvalidUserCode)
+	}
+
+	if _, err := (&OAuthDeviceCode{}).PollOAuthDeviceCode(db, code, 1); err != ErrDeviceAccessDenied {
+		t.Errorf("poll of a denied request: %v, want %v", err, ErrDeviceAccessDenied)
+	}
+}
+
+func TestPollOAuthDeviceCodeExpired(t *testing.T) {
+	db := newTestDB(t, &OAuthDeviceCode{})
+
+	request := OAuthDeviceCode{ClientID: 1}
+	code, userCode, err := request.SaveOAuthDeviceCode(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&OAuthDeviceCode{}).Where("id = ?", request.ID).UpdateColumn("expires_at", time.Now().Add(-time.Second))
+
+	if _, err := (&OAuthDeviceCode{}).FindPendingOAuthDeviceCode(db, userCode); err != ErrInvalidUserCode {
+		t.Errorf("user code of an expired request: %v, want %v", err, ErrInvalidUserCode)
+	}
+	if _, err := (&OAuthDeviceCode{}).PollOAuthDeviceCode(db, code, 1); err != ErrExpiredDeviceCode {
+		t.Errorf("poll of an expired request: %v, want %v", err, ErrExpiredDeviceCode)
+	}
+}
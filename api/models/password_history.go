@@ -0,0 +1,85 @@
+package models
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/norfabagas/auth-global/api/utils/passwordpolicy"
+)
+
+// ErrPasswordReused is returned for a password among the user's recent ones.
+// It is a policy error, so it is reported with the other failed rules.
+var ErrPasswordReused = &passwordpolicy.Error{
+	Violations: []passwordpolicy.Violation{
+		{Rule: passwordpolicy.RuleReused, Message: "password was used recently, please choose another"},
+	},
+}
+
+// PasswordHistory keeps the hashes of the passwords a user had, newest
+// included.
+type PasswordHistory struct {
+	ID           uint32    `gorm:"primary_key;not null;unique" json:"id"`
+	UserID       uint32    `gorm:"not null" json:"user_id"`
+	PasswordHash string    `gorm:"size:255;not null" json:"-"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (PasswordHistory) TableName() string {
+	return "password_history"
+}
+
+// PasswordHistorySize is how many recent passwords may not be reused, set
+// with PASSWORD_HISTORY_SIZE. It defaults to 5; 0 turns the check off.
+func PasswordHistorySize() int {
+	size, err := strconv.Atoi(os.Getenv("PASSWORD_HISTORY_SIZE"))
+	if err != nil || size < 0 {
+		return 5
+	}
+	return size
+}
+
+// CheckPasswordHistory returns ErrPasswordReused when password matches one
+// of the last PasswordHistorySize passwords of userID.
+func (passwordHistory *PasswordHistory) CheckPasswordHistory(db *gorm.DB, userID uint32, password string) error {
+	size := PasswordHistorySize()
+	if size == 0 {
+		return nil
+	}
+
+	history := []PasswordHistory{}
+	err := db.Debug().Model(&PasswordHistory{}).Where("user_id = ?", userID).
+		Order("created_at desc").Order("id desc").Limit(size).Find(&history).Error
+	if err != nil {
+		return err
+	}
+
+	for _, previous := range history {
+		if VerifyPassword(previous.PasswordHash, password) == nil {
+			return ErrPasswordReused
+		}
+	}
+
+	return nil
+}
+
+// SavePasswordHistory records hashedPassword as the current password of
+// userID and forgets the ones beyond PasswordHistorySize.
+func (passwordHistory *PasswordHistory) SavePasswordHistory(db *gorm.DB, userID uint32, hashedPassword string) error {
+	err := db.Debug().Create(&PasswordHistory{UserID: userID, PasswordHash: hashedPassword, CreatedAt: time.Now()}).Error
+	if err != nil {
+		return err
+	}
+
+	// the current password is always kept
+	keep := PasswordHistorySize()
+	if keep < 1 {
+		keep = 1
+	}
+
+	return db.Debug().Exec(
+		"DELETE FROM password_history WHERE user_id = ? AND id NOT IN (SELECT id FROM password_history WHERE user_id = ? ORDER BY created_at DESC, id DESC LIMIT ?)",
+		userID, userID, keep,
+	).Error
+}
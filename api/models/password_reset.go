@@ -0,0 +1,97 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+const PasswordResetExpiryInMinute = 60
+
+var ErrInvalidPasswordReset = errors.New("invalid or expired password reset token")
+
+// PasswordReset stores the hash of a single-use password reset token.
+type PasswordReset struct {
+	ID        uint32     `gorm:"primary_key;not null;unique" json:"id"`
+	UserID    uint32     `gorm:"not null" json:"user_id"`
+	TokenHash string     `gorm:"size:255;not null;unique" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// SavePasswordReset issues a reset token for userID and returns its
+// plaintext value.
+func (passwordReset *PasswordReset) SavePasswordReset(db *gorm.DB, userID uint32) (string, error) {
+	token, err := crypto.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	passwordReset.ID = 0
+	passwordReset.UserID = userID
+	passwordReset.TokenHash = crypto.SHA256Hash(token)
+	passwordReset.ExpiresAt = time.Now().Add(time.Minute * PasswordResetExpiryInMinute)
+	passwordReset.UsedAt = nil
+	passwordReset.CreatedAt = time.Now()
+
+	err = db.Debug().Create(&passwordReset).Error
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// FindPasswordReset returns the reset for token while it can still be used,
+// without consuming it.
+func (passwordReset *PasswordReset) FindPasswordReset(db *gorm.DB, token string) (*PasswordReset, error) {
+	err := db.Debug().Model(&PasswordReset{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", crypto.SHA256Hash(token), time.Now()).
+		Take(&passwordReset).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &PasswordReset{}, ErrInvalidPasswordReset
+	}
+	if err != nil {
+		return &PasswordReset{}, err
+	}
+
+	return passwordReset, nil
+}
+
+// ConsumePasswordReset marks the token as used and returns it. Every other
+// outstanding token of the same user is invalidated as well.
+func (passwordReset *PasswordReset) ConsumePasswordReset(db *gorm.DB, token string) (*PasswordReset, error) {
+	err := db.Debug().Model(&PasswordReset{}).Where("token_hash = ?", crypto.SHA256Hash(token)).Take(&passwordReset).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &PasswordReset{}, ErrInvalidPasswordReset
+	}
+	if err != nil {
+		return &PasswordReset{}, err
+	}
+
+	consumed := db.Debug().Model(&PasswordReset{}).Where("id = ? AND used_at IS NULL AND expires_at > ?", passwordReset.ID, time.Now()).UpdateColumns(
+		map[string]interface{}{
+			"used_at": time.Now(),
+		},
+	)
+	if consumed.Error != nil {
+		return &PasswordReset{}, consumed.Error
+	}
+	if consumed.RowsAffected == 0 {
+		return &PasswordReset{}, ErrInvalidPasswordReset
+	}
+
+	err = db.Debug().Model(&PasswordReset{}).Where("user_id = ? AND used_at IS NULL", passwordReset.UserID).UpdateColumns(
+		map[string]interface{}{
+			"used_at": time.Now(),
+		},
+	).Error
+	if err != nil {
+		return &PasswordReset{}, err
+	}
+
+	return passwordReset, nil
+}
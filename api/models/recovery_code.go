@@ -0,0 +1,107 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const RecoveryCodeCount = 10
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the
+// authenticator is lost. Codes are hashed like passwords.
+type RecoveryCode struct {
+	ID        uint32     `gorm:"primary_key;not null;unique" json:"id"`
+	UserID    uint32     `gorm:"not null" json:"user_id"`
+	CodeHash  string     `gorm:"size:255;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+}
+
+// GenerateRecoveryCodes replaces the user's recovery codes and returns the
+// new plaintext codes, formatted as xxxxx-xxxxx.
+func (recoveryCode *RecoveryCode) GenerateRecoveryCodes(db *gorm.DB, userID uint32) ([]string, error) {
+	codes := []string{}
+	hashes := []string{}
+	for i := 0; i < RecoveryCodeCount; i++ {
+		random := make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(random))[:10]
+
+		hashedCode, err := Hash(code)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, string(hashedCode))
+	}
+
+	err := recoveryCode.DeleteRecoveryCodes(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hash := range hashes {
+		err = db.Debug().Create(&RecoveryCode{
+			UserID:    userID,
+			CodeHash:  hash,
+			CreatedAt: time.Now(),
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+// UseRecoveryCode reports whether code is one of the user's unused codes,
+// and marks it used if so.
+func (recoveryCode *RecoveryCode) UseRecoveryCode(db *gorm.DB, userID uint32, code string) (bool, error) {
+	code = normalizeRecoveryCode(code)
+
+	recoveryCodes := []RecoveryCode{}
+	err := db.Debug().Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Find(&recoveryCodes).Error
+	if err != nil {
+		return false, err
+	}
+
+	for _, candidate := range recoveryCodes {
+		if VerifyPassword(candidate.CodeHash, code) != nil {
+			continue
+		}
+
+		used := db.Debug().Model(&RecoveryCode{}).Where("id = ? AND used_at IS NULL", candidate.ID).UpdateColumns(
+			map[string]interface{}{
+				"used_at": time.Now(),
+			},
+		)
+		if used.Error != nil {
+			return false, used.Error
+		}
+		return used.RowsAffected > 0, nil
+	}
+
+	return false, nil
+}
+
+func (recoveryCode *RecoveryCode) CountUnusedRecoveryCodes(db *gorm.DB, userID uint32) (int, error) {
+	count := 0
+	err := db.Debug().Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+
+	return count, err
+}
+
+func (recoveryCode *RecoveryCode) DeleteRecoveryCodes(db *gorm.DB, userID uint32) error {
+	return db.Debug().Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+}
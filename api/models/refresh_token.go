@@ -0,0 +1,146 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+const RefreshTokenExpiryInHour = 24 * 30
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrExpiredRefreshToken = errors.New("refresh token expired")
+	ErrReusedRefreshToken  = errors.New("refresh token reused, please login again")
+)
+
+// RefreshToken stores the hash of an opaque refresh token. Every refresh
+// rotates the token; all tokens descending from the same login share a
+// FamilyID so a replayed token can revoke the whole chain. Tokens issued to
+// an OAuth client carry its ClientID and the granted Scope, and can only be
+// used by that client.
+type RefreshToken struct {
+	ID        uint32     `gorm:"primary_key;not null;unique" json:"id"`
+	UserID    uint32     `gorm:"not null" json:"user_id"`
+	FamilyID  string     `gorm:"size:255;not null" json:"family_id"`
+	Audience  string     `gorm:"size:255;not null" json:"audience"`
+	ClientID  string     `gorm:"size:255;not null" json:"client_id"`
+	Scope     string     `gorm:"type:text;not null" json:"scope"`
+	TokenHash string     `gorm:"size:255;not null;unique" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// SaveRefreshToken issues a new refresh token for userID and returns its
+// plaintext value. An empty familyID starts a new token family. Access
+// tokens minted from it are issued for audience, and to clientID with scope
+// when the token belongs to an OAuth client.
+func (refreshToken *RefreshToken) SaveRefreshToken(db *gorm.DB, userID uint32, audience, familyID, clientID, scope string) (string, error) {
+	token, err := crypto.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if familyID == "" {
+		familyID, err = crypto.RandomToken(16)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	refreshToken.ID = 0
+	refreshToken.UserID = userID
+	refreshToken.FamilyID = familyID
+	refreshToken.Audience = audience
+	refreshToken.ClientID = clientID
+	refreshToken.Scope = scope
+	refreshToken.TokenHash = crypto.SHA256Hash(token)
+	refreshToken.ExpiresAt = time.Now().Add(time.Hour * RefreshTokenExpiryInHour)
+	refreshToken.RotatedAt = nil
+	refreshToken.RevokedAt = nil
+	refreshToken.CreatedAt = time.Now()
+
+	err = db.Debug().Create(&refreshToken).Error
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (refreshToken *RefreshToken) FindRefreshToken(db *gorm.DB, token string) (*RefreshToken, error) {
+	err := db.Debug().Model(&RefreshToken{}).Where("token_hash = ?", crypto.SHA256Hash(token)).Take(&refreshToken).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &RefreshToken{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return &RefreshToken{}, err
+	}
+
+	return refreshToken, nil
+}
+
+// RotateRefreshToken exchanges token for a new one in the same family.
+// Presenting a token that has already been rotated revokes the family. Only
+// the OAuth client the token was issued to may rotate it; clientID is empty
+// for first party sign ins.
+func (refreshToken *RefreshToken) RotateRefreshToken(db *gorm.DB, token, clientID string) (string, error) {
+	current, err := refreshToken.FindRefreshToken(db, token)
+	if err != nil {
+		return "", err
+	}
+	if current.ClientID != clientID {
+		return "", ErrInvalidRefreshToken
+	}
+
+	if current.RevokedAt != nil {
+		return "", ErrInvalidRefreshToken
+	}
+	if current.RotatedAt != nil {
+		if err := current.RevokeRefreshTokenFamily(db, current.FamilyID); err != nil {
+			return "", err
+		}
+		return "", ErrReusedRefreshToken
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return "", ErrExpiredRefreshToken
+	}
+
+	// only one concurrent request may win the rotation
+	rotated := db.Debug().Model(&RefreshToken{}).Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", current.ID).UpdateColumns(
+		map[string]interface{}{
+			"rotated_at": time.Now(),
+		},
+	)
+	if rotated.Error != nil {
+		return "", rotated.Error
+	}
+	if rotated.RowsAffected == 0 {
+		if err := current.RevokeRefreshTokenFamily(db, current.FamilyID); err != nil {
+			return "", err
+		}
+		return "", ErrReusedRefreshToken
+	}
+
+	return refreshToken.SaveRefreshToken(db, current.UserID, current.Audience, current.FamilyID, current.ClientID, current.Scope)
+}
+
+func (refreshToken *RefreshToken) RevokeRefreshTokenFamily(db *gorm.DB, familyID string) error {
+	return db.Debug().Model(&RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).UpdateColumns(
+		map[string]interface{}{
+			"revoked_at": time.Now(),
+		},
+	).Error
+}
+
+func (refreshToken *RefreshToken) RevokeUserRefreshTokens(db *gorm.DB, userID uint32) error {
+	return db.Debug().Model(&RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).UpdateColumns(
+		map[string]interface{}{
+			"revoked_at": time.Now(),
+		},
+	).Error
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	db := newTestDB(t, &RefreshToken{})
+
+	first := RefreshToken{}
+	token, err := first.SaveRefreshToken(db, 1, "auth-global", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := RefreshToken{}
+	next, err := rotated.RotateRefreshToken(db, token, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == "" || next == token {
+		t.Fatalf("rotation returned %q", next)
+	}
+	if rotated.FamilyID != first.FamilyID || rotated.UserID != 1 || rotated.Audience != "auth-global" {
+		t.Errorf("rotated token %+v does not continue family %s", rotated, first.FamilyID)
+	}
+
+	// the new token rotates in turn
+	_, err = (&RefreshToken{}).RotateRefreshToken(db, next, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateRefreshTokenReuse(t *testing.T) {
+	db := newTestDB(t, &RefreshToken{})
+
+	token, err := (&RefreshToken{}).SaveRefreshToken(db, 1, "auth-global", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := (&RefreshToken{}).RotateRefreshToken(db, token, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = (&RefreshToken{}).RotateRefreshToken(db, token, "")
+	if err != ErrReusedRefreshToken {
+		t.Fatalf("replaying a rotated token: got %v, want %v", err, ErrReusedRefreshToken)
+	}
+
+	// the whole family is revoked, including the token issued last
+	_, err = (&RefreshToken{}).RotateRefreshToken(db, next, "")
+	if err != ErrInvalidRefreshToken {
+		t.Fatalf("rotating after reuse: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestRotateRefreshTokenOtherFamilies(t *testing.T) {
+	db := newTestDB(t, &RefreshToken{})
+
+	reused, err := (&RefreshToken{}).SaveRefreshToken(db, 1, "auth-global", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := (&RefreshToken{}).SaveRefreshToken(db, 1, "auth-global", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = (&RefreshToken{}).RotateRefreshToken(db, reused, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&RefreshToken{}).RotateRefreshToken(db, reused, "")
+	if err != ErrReusedRefreshToken {
+		t.Fatalf("got %v, want %v", err, ErrReusedRefreshToken)
+	}
+
+	_, err = (&RefreshToken{}).RotateRefreshToken(db, other, "")
+	if err != nil {
+		t.Errorf("a reuse in another family revoked this one: %v", err)
+	}
+}
+
+func TestRotateRefreshTokenInvalid(t *testing.T) {
+	db := newTestDB(t, &RefreshToken{})
+
+	_, err := (&RefreshToken{}).RotateRefreshToken(db, "unknown", "")
+	if err != ErrInvalidRefreshToken {
+		t.Errorf("unknown token: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	clientToken, err := (&RefreshToken{}).SaveRefreshToken(db, 1, "auth-global", "", "client-a", "openid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&RefreshToken{}).RotateRefreshToken(db, clientToken, "client-b")
+	if err != ErrInvalidRefreshToken {
+		t.Errorf("token of another client: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	_, err = (&RefreshToken{}).RotateRefreshToken(db, clientToken, "")
+	if err != ErrInvalidRefreshToken {
+		t.Errorf("client token without client: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	expired := RefreshToken{}
+	expiredToken, err := expired.SaveRefreshToken(db, 1, "auth-global", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&RefreshToken{}).Where("id = ?", expired.ID).UpdateColumn("expires_at", time.Now().Add(-time.Minute)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&RefreshToken{}).RotateRefreshToken(db, expiredToken, "")
+	if err != ErrExpiredRefreshToken {
+		t.Errorf("expired token: got %v, want %v", err, ErrExpiredRefreshToken)
+	}
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/norfabagas/auth-global/api/jwt"
+)
+
+type RevokedToken struct {
+	ID        uint32    `gorm:"primary_key;not null;unique" json:"id"`
+	JTI       string    `gorm:"column:jti;size:255;not null;unique" json:"jti"`
+	UserID    uint32    `gorm:"not null" json:"user_id"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// TokenRevocations implements jwt.RevocationStore on top of the
+// revoked_tokens table, sessions.revoked_at and users.tokens_revoked_at.
+type TokenRevocations struct {
+	DB *gorm.DB
+}
+
+func (revocations *TokenRevocations) RevokeToken(jti string, userID uint32, expiresAt time.Time) error {
+	// expired tokens are rejected by their exp claim, no need to keep them
+	err := revocations.DB.Debug().Where("expires_at < ?", time.Now()).Delete(&RevokedToken{}).Error
+	if err != nil {
+		return err
+	}
+
+	// the unique jti makes single-use tokens safe against concurrent use
+	count := 0
+	err = revocations.DB.Debug().Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return jwt.ErrTokenRevoked
+	}
+
+	return revocations.DB.Debug().Create(&RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}).Error
+}
+
+func (revocations *TokenRevocations) RevokeAllTokens(userID uint32, revokedAt time.Time) error {
+	return revocations.DB.Debug().Model(&User{}).Where("id = ?", userID).UpdateColumns(
+		map[string]interface{}{
+			"tokens_revoked_at": revokedAt,
+		},
+	).Error
+}
+
+func (revocations *TokenRevocations) IsRevoked(jti string, userID uint32, sessionID string, issuedAt time.Time) (bool, error) {
+	if jti != "" {
+		count := 0
+		err := revocations.DB.Debug().Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+		if err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+
+	if sessionID != "" {
+		count := 0
+		err := revocations.DB.Debug().Model(&Session{}).Where("public_id = ? AND revoked_at IS NOT NULL", sessionID).Count(&count).Error
+		if err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+
+	// client tokens belong to no user
+	if userID == 0 {
+		return false, nil
+	}
+
+	user := User{}
+	err := revocations.DB.Debug().Model(&User{}).Select("tokens_revoked_at").Where("id = ?", userID).Take(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// iat only has second precision, so a token from the same second as the
+	// logout is treated as revoked
+	return user.TokensRevokedAt != nil && issuedAt.Unix() <= user.TokensRevokedAt.Unix(), nil
+}
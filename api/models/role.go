@@ -0,0 +1,255 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrPermissionNotFound = errors.New("permission not found")
+
+	roleNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9:_.-]*$`)
+)
+
+type Role struct {
+	ID          uint32    `gorm:"primary_key;not null;unique" json:"id"`
+	Name        string    `gorm:"size:255;not null;unique" json:"name"`
+	Description string    `gorm:"size:255;not null" json:"description"`
+	CreatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	Permissions []string  `gorm:"-" json:"permissions"`
+}
+
+type Permission struct {
+	ID          uint32    `gorm:"primary_key;not null;unique" json:"id"`
+	Name        string    `gorm:"size:255;not null;unique" json:"name"`
+	Description string    `gorm:"size:255;not null" json:"description"`
+	CreatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+type RolePermission struct {
+	RoleID       uint32 `gorm:"primary_key"`
+	PermissionID uint32 `gorm:"primary_key"`
+}
+
+type UserRole struct {
+	UserID    uint32    `gorm:"primary_key"`
+	RoleID    uint32    `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (role *Role) Prepare() {
+	role.ID = 0
+	role.Name = strings.ToLower(strings.TrimSpace(role.Name))
+	role.Description = EscapeAndTrimString(role.Description)
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = time.Now()
+}
+
+func (role *Role) Validate() error {
+	if role.Name == "" {
+		return errors.New("required name")
+	}
+	if !roleNamePattern.MatchString(role.Name) {
+		return errors.New("name may only contain lowercase letters, digits and : _ . -")
+	}
+
+	return nil
+}
+
+func (role *Role) SaveRole(db *gorm.DB) (*Role, error) {
+	count := 0
+	db.Debug().Model(&Role{}).Where("name = ?", role.Name).Count(&count)
+	if count > 0 {
+		return &Role{}, errors.New("role already exists")
+	}
+
+	err := db.Debug().Create(&role).Error
+	if err != nil {
+		return &Role{}, err
+	}
+
+	return role, nil
+}
+
+func (role *Role) FindRoleByName(db *gorm.DB, name string) (*Role, error) {
+	err := db.Debug().Model(&Role{}).Where("name = ?", name).Take(&role).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Role{}, ErrRoleNotFound
+	}
+	if err != nil {
+		return &Role{}, err
+	}
+
+	role.Permissions, err = findPermissionNames(db, "role_permissions.role_id = ?", role.ID)
+	if err != nil {
+		return &Role{}, err
+	}
+
+	return role, nil
+}
+
+func (role *Role) FindAllRoles(db *gorm.DB) (*[]Role, error) {
+	roles := []Role{}
+	err := db.Debug().Model(&Role{}).Order("name").Find(&roles).Error
+	if err != nil {
+		return &[]Role{}, err
+	}
+
+	for i := range roles {
+		roles[i].Permissions, err = findPermissionNames(db, "role_permissions.role_id = ?", roles[i].ID)
+		if err != nil {
+			return &[]Role{}, err
+		}
+	}
+
+	return &roles, nil
+}
+
+func (role *Role) DeleteRole(db *gorm.DB, name string) error {
+	db = db.Debug().Where("name = ?", name).Delete(&Role{})
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrRoleNotFound
+	}
+
+	return nil
+}
+
+func (role *Role) GrantPermission(db *gorm.DB, roleName, permissionName string) error {
+	found, err := role.FindRoleByName(db, roleName)
+	if err != nil {
+		return err
+	}
+
+	permission := Permission{}
+	err = db.Debug().Model(&Permission{}).Where("name = ?", permissionName).Take(&permission).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrPermissionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return db.Debug().Where(RolePermission{RoleID: found.ID, PermissionID: permission.ID}).FirstOrCreate(&RolePermission{}).Error
+}
+
+func (role *Role) RevokePermission(db *gorm.DB, roleName, permissionName string) error {
+	found, err := role.FindRoleByName(db, roleName)
+	if err != nil {
+		return err
+	}
+
+	return db.Debug().Exec(
+		"DELETE FROM role_permissions WHERE role_id = ? AND permission_id IN (SELECT id FROM permissions WHERE name = ?)",
+		found.ID, permissionName,
+	).Error
+}
+
+func (permission *Permission) Prepare() {
+	permission.ID = 0
+	permission.Name = strings.ToLower(strings.TrimSpace(permission.Name))
+	permission.Description = EscapeAndTrimString(permission.Description)
+	permission.CreatedAt = time.Now()
+	permission.UpdatedAt = time.Now()
+}
+
+func (permission *Permission) Validate() error {
+	if permission.Name == "" {
+		return errors.New("required name")
+	}
+	if !roleNamePattern.MatchString(permission.Name) {
+		return errors.New("name may only contain lowercase letters, digits and : _ . -")
+	}
+
+	return nil
+}
+
+func (permission *Permission) SavePermission(db *gorm.DB) (*Permission, error) {
+	count := 0
+	db.Debug().Model(&Permission{}).Where("name = ?", permission.Name).Count(&count)
+	if count > 0 {
+		return &Permission{}, errors.New("permission already exists")
+	}
+
+	err := db.Debug().Create(&permission).Error
+	if err != nil {
+		return &Permission{}, err
+	}
+
+	return permission, nil
+}
+
+func (permission *Permission) FindAllPermissions(db *gorm.DB) (*[]Permission, error) {
+	permissions := []Permission{}
+	err := db.Debug().Model(&Permission{}).Order("name").Find(&permissions).Error
+	if err != nil {
+		return &[]Permission{}, err
+	}
+
+	return &permissions, nil
+}
+
+func (permission *Permission) DeletePermission(db *gorm.DB, name string) error {
+	db = db.Debug().Where("name = ?", name).Delete(&Permission{})
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrPermissionNotFound
+	}
+
+	return nil
+}
+
+func (user *User) FindUserRoles(db *gorm.DB, userID uint32) ([]string, error) {
+	names := []string{}
+	err := db.Debug().Table("roles").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &names).Error
+
+	return names, err
+}
+
+func (user *User) FindUserPermissions(db *gorm.DB, userID uint32) ([]string, error) {
+	return findPermissionNames(db, "role_permissions.role_id IN (SELECT role_id FROM user_roles WHERE user_id = ?)", userID)
+}
+
+func (user *User) AssignRole(db *gorm.DB, userID uint32, roleName string) error {
+	role := Role{}
+	found, err := role.FindRoleByName(db, roleName)
+	if err != nil {
+		return err
+	}
+
+	return db.Debug().Where(UserRole{UserID: userID, RoleID: found.ID}).FirstOrCreate(&UserRole{CreatedAt: time.Now()}).Error
+}
+
+func (user *User) UnassignRole(db *gorm.DB, userID uint32, roleName string) error {
+	return db.Debug().Exec(
+		"DELETE FROM user_roles WHERE user_id = ? AND role_id IN (SELECT id FROM roles WHERE name = ?)",
+		userID, roleName,
+	).Error
+}
+
+func findPermissionNames(db *gorm.DB, where string, args ...interface{}) ([]string, error) {
+	names := []string{}
+	err := db.Debug().Table("permissions").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Where(where, args...).
+		Group("permissions.name").
+		Order("permissions.name").
+		Pluck("permissions.name", &names).Error
+
+	return names, err
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// newRBACTestDB creates the join tables by hand, sqlite cannot migrate
+// their composite keys of auto incremented columns.
+func newRBACTestDB(t *testing.T) *gorm.DB {
+	db := newTestDB(t, &Role{}, &Permission{})
+	for _, table := range []string{
+		"CREATE TABLE role_permissions (role_id integer, permission_id integer, PRIMARY KEY (role_id, permission_id))",
+		"CREATE TABLE user_roles (user_id integer, role_id integer, created_at datetime, PRIMARY KEY (user_id, role_id))",
+	} {
+		err := db.Exec(table).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+func TestUserPermissionsFollowRoles(t *testing.T) {
+	db := newRBACTestDB(t)
+
+	for _, name := range []string{"users:read", "users:write", "audit:read"} {
+		permission := Permission{Name: name}
+		permission.Prepare()
+		_, err := permission.SavePermission(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"admin", "auditor"} {
+		role := Role{Name: name}
+		role.Prepare()
+		_, err := role.SaveRole(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	grants := map[string][]string{
+		"admin":   {"users:read", "users:write"},
+		"auditor": {"audit:read", "users:read"},
+	}
+	for role, permissions := range grants {
+		for _, permission := range permissions {
+			err := (&Role{}).GrantPermission(db, role, permission)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	user := User{}
+	err := user.AssignRole(db, 1, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = user.AssignRole(db, 1, "auditor")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles, err := user.FindUserRoles(db, 1)
+	if err != nil || !reflect.DeepEqual(roles, []string{"admin", "auditor"}) {
+		t.Fatalf("roles: %v %v", roles, err)
+	}
+	// permissions shared by two roles are listed once
+	permissions, err := user.FindUserPermissions(db, 1)
+	if err != nil || !reflect.DeepEqual(permissions, []string{"audit:read", "users:read", "users:write"}) {
+		t.Fatalf("permissions: %v %v", permissions, err)
+	}
+
+	err = (&Role{}).RevokePermission(db, "admin", "users:write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = user.UnassignRole(db, 1, "auditor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	permissions, err = user.FindUserPermissions(db, 1)
+	if err != nil || !reflect.DeepEqual(permissions, []string{"users:read"}) {
+		t.Fatalf("permissions after revoking: %v %v", permissions, err)
+	}
+
+	// other users are not affected
+	permissions, err = user.FindUserPermissions(db, 2)
+	if err != nil || len(permissions) != 0 {
+		t.Fatalf("permissions of a user without roles: %v %v", permissions, err)
+	}
+}
+
+func TestRoleNotFound(t *testing.T) {
+	db := newRBACTestDB(t)
+
+	role := Role{Name: "admin"}
+	role.Prepare()
+	_, err := role.SaveRole(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&User{}).AssignRole(db, 1, "unknown"); err != ErrRoleNotFound {
+		t.Errorf("assigning an unknown role: %v, want %v", err, ErrRoleNotFound)
+	}
+	if err := (&Role{}).GrantPermission(db, "admin", "unknown"); err != ErrPermissionNotFound {
+		t.Errorf("granting an unknown permission: %v, want %v", err, ErrPermissionNotFound)
+	}
+	if err := (&Role{}).DeleteRole(db, "unknown"); err != ErrRoleNotFound {
+		t.Errorf("deleting an unknown role: %v, want %v", err, ErrRoleNotFound)
+	}
+	duplicate := Role{Name: "admin"}
+	duplicate.Prepare()
+	if _, err := duplicate.SaveRole(db); err == nil {
+		t.Error("saving a role twice succeeded")
+	}
+}
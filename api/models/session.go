@@ -0,0 +1,144 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+	"github.com/norfabagas/auth-global/api/utils/useragent"
+)
+
+// SessionSeenInterval limits how often a session's last seen time is
+// written, so busy clients do not update it on every request.
+const SessionSeenInterval = time.Minute
+
+// SessionIdleExpiry is how long an unused session stays listed, as long as
+// the refresh tokens issued for it last.
+const SessionIdleExpiry = time.Hour * RefreshTokenExpiryInHour
+
+const sessionUserAgentMaxLength = 512
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a sign in on one device. Its PublicID is the sid claim of the
+// access tokens and the family of the refresh tokens issued for it.
+type Session struct {
+	ID         uint32     `gorm:"primary_key;not null;unique" json:"-"`
+	PublicID   string     `gorm:"size:255;not null;unique" json:"id"`
+	UserID     uint32     `gorm:"not null" json:"-"`
+	Device     string     `gorm:"size:255;not null" json:"device"`
+	UserAgent  string     `gorm:"size:512;not null" json:"user_agent"`
+	IP         string     `gorm:"column:ip;size:64;not null" json:"ip"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	LastSeenAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+func (session *Session) SaveSession(db *gorm.DB, userID uint32, ip, userAgent string) (*Session, error) {
+	publicID, err := crypto.RandomToken(16)
+	if err != nil {
+		return &Session{}, err
+	}
+
+	now := time.Now()
+	session.ID = 0
+	session.PublicID = publicID
+	session.UserID = userID
+	session.Device = truncate(useragent.DeviceName(userAgent), 255)
+	session.UserAgent = truncate(userAgent, sessionUserAgentMaxLength)
+	session.IP = ip
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	session.RevokedAt = nil
+
+	err = db.Debug().Create(&session).Error
+	if err != nil {
+		return &Session{}, err
+	}
+
+	return session, nil
+}
+
+// FindUserSessions lists the sessions of userID that can still be used: not
+// revoked, used within SessionIdleExpiry and with no revoked refresh tokens,
+// since revoking the family ends the session. A session does not need a
+// refresh token to be listed, a browser sign in on /oauth/authorize has
+// none until a client exchanges a code.
+func (session *Session) FindUserSessions(db *gorm.DB, userID uint32) (*[]Session, error) {
+	sessions := []Session{}
+	err := db.Debug().Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND last_seen_at > ?", userID, time.Now().Add(-SessionIdleExpiry)).
+		Where("NOT EXISTS (SELECT 1 FROM refresh_tokens WHERE refresh_tokens.family_id = sessions.public_id AND revoked_at IS NOT NULL)").
+		Order("last_seen_at desc").Find(&sessions).Error
+	if err != nil {
+		return &[]Session{}, err
+	}
+
+	return &sessions, nil
+}
+
+// RevokeSession signs userID out of the session publicID: its access tokens
+// are rejected and its refresh tokens revoked.
+func (session *Session) RevokeSession(db *gorm.DB, userID uint32, publicID string) error {
+	revoked := db.Debug().Model(&Session{}).Where("user_id = ? AND public_id = ? AND revoked_at IS NULL", userID, publicID).UpdateColumns(
+		map[string]interface{}{
+			"revoked_at": time.Now(),
+		},
+	)
+	if revoked.Error != nil {
+		return revoked.Error
+	}
+	if revoked.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	refreshToken := RefreshToken{}
+	return refreshToken.RevokeRefreshTokenFamily(db, publicID)
+}
+
+// FindActiveSession returns the session publicID of userID unless it has
+// been revoked.
+func (session *Session) FindActiveSession(db *gorm.DB, userID uint32, publicID string) (*Session, error) {
+	err := db.Debug().Model(&Session{}).Where("user_id = ? AND public_id = ? AND revoked_at IS NULL", userID, publicID).Take(&session).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Session{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return &Session{}, err
+	}
+
+	return session, nil
+}
+
+func (session *Session) RevokeUserSessions(db *gorm.DB, userID uint32) error {
+	return db.Debug().Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).UpdateColumns(
+		map[string]interface{}{
+			"revoked_at": time.Now(),
+		},
+	).Error
+}
+
+// TouchSession records that the session publicID was used from ip at
+// seenAt, at most once per SessionSeenInterval.
+func (session *Session) TouchSession(db *gorm.DB, publicID, ip string, seenAt time.Time) error {
+	return db.Debug().Model(&Session{}).
+		Where("public_id = ? AND revoked_at IS NULL AND last_seen_at < ?", publicID, seenAt.Add(-SessionSeenInterval)).
+		UpdateColumns(
+			map[string]interface{}{
+				"last_seen_at": seenAt,
+				"ip":           ip,
+			},
+		).Error
+}
+
+// SessionActivity implements middlewares.SessionTracker on top of the
+// sessions table.
+type SessionActivity struct {
+	DB *gorm.DB
+}
+
+func (activity *SessionActivity) TouchSession(sessionID, ip string, seenAt time.Time) error {
+	session := Session{}
+	return session.TouchSession(activity.DB, sessionID, ip, seenAt)
+}
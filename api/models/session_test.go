@@ -0,0 +1,171 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// sessionIDs returns the public IDs of sessions in order.
+func sessionIDs(sessions *[]Session) []string {
+	ids := []string{}
+	for _, session := range *sessions {
+		ids = append(ids, session.PublicID)
+	}
+	return ids
+}
+
+func TestFindUserSessions(t *testing.T) {
+	db := newTestDB(t, &Session{}, &RefreshToken{})
+
+	// a browser sign in has no refresh token until a client exchanges a code
+	browser := Session{}
+	if _, err := browser.SaveSession(db, 1, "203.0.113.7", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) Firefox/118.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	app := Session{}
+	if _, err := app.SaveSession(db, 1, "203.0.113.7", "okhttp/4.9.0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&RefreshToken{}).SaveRefreshToken(db, 1, "auth-global", app.PublicID, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&Session{}).Where("id = ?", app.ID).UpdateColumn("last_seen_at", time.Now().Add(time.Minute))
+
+	idle := Session{}
+	if _, err := idle.SaveSession(db, 1, "203.0.113.7", "curl/7.68.0"); err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&Session{}).Where("id = ?", idle.ID).UpdateColumn("last_seen_at", time.Now().Add(-SessionIdleExpiry-time.Minute))
+
+	// reuse detection revoked the refresh tokens of this one
+	reused := Session{}
+	if _, err := reused.SaveSession(db, 1, "203.0.113.7", "curl/7.68.0"); err != nil {
+		t.Fatal(err)
+	}
+	refreshToken := RefreshToken{}
+	if _, err := refreshToken.SaveRefreshToken(db, 1, "auth-global", reused.PublicID, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := refreshToken.RevokeRefreshTokenFamily(db, reused.PublicID); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked := Session{}
+	if _, err := revoked.SaveSession(db, 1, "203.0.113.7", "curl/7.68.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := revoked.RevokeSession(db, 1, revoked.PublicID); err != nil {
+		t.Fatal(err)
+	}
+
+	other := Session{}
+	if _, err := other.SaveSession(db, 2, "203.0.113.7", "curl/7.68.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := (&Session{}).FindUserSessions(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sessionIDs(sessions)
+	want := []string{app.PublicID, browser.PublicID}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("sessions %v, want the app and the browser session %v", got, want)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	db := newTestDB(t, &Session{}, &RefreshToken{})
+
+	session := Session{}
+	if _, err := session.SaveSession(db, 1, "203.0.113.7", "okhttp/4.9.0"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := (&RefreshToken{}).SaveRefreshToken(db, 1, "auth-global", session.PublicID, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one user cannot end another's session
+	if err := (&Session{}).RevokeSession(db, 2, session.PublicID); err != ErrSessionNotFound {
+		t.Fatalf("revoking another user's session: %v, want %v", err, ErrSessionNotFound)
+	}
+	if _, err := (&Session{}).FindActiveSession(db, 1, session.PublicID); err != nil {
+		t.Fatalf("session after a refused revocation: %v", err)
+	}
+
+	if err := (&Session{}).RevokeSession(db, 1, session.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Session{}).FindActiveSession(db, 1, session.PublicID); err != ErrSessionNotFound {
+		t.Errorf("revoked session: %v, want %v", err, ErrSessionNotFound)
+	}
+	if _, err := (&RefreshToken{}).RotateRefreshToken(db, token, ""); err != ErrInvalidRefreshToken {
+		t.Errorf("refresh token of a revoked session: %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if err := (&Session{}).RevokeSession(db, 1, session.PublicID); err != ErrSessionNotFound {
+		t.Errorf("revoking twice: %v, want %v", err, ErrSessionNotFound)
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	db := newTestDB(t, &Session{}, &RefreshToken{})
+
+	for _, userID := range []uint32{1, 1, 2} {
+		if _, err := (&Session{}).SaveSession(db, userID, "203.0.113.7", "curl/7.68.0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := (&Session{}).RevokeUserSessions(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	for userID, want := range map[uint32]int{1: 0, 2: 1} {
+		sessions, err := (&Session{}).FindUserSessions(db, userID)
+		if err != nil || len(*sessions) != want {
+			t.Errorf("sessions of user %d: %v %v, want %d", userID, sessions, err, want)
+		}
+	}
+}
+
+func TestTouchSession(t *testing.T) {
+	db := newTestDB(t, &Session{}, &RefreshToken{})
+
+	session := Session{}
+	if _, err := session.SaveSession(db, 1, "203.0.113.7", "curl/7.68.0"); err != nil {
+		t.Fatal(err)
+	}
+	lastSeen := func() Session {
+		found := Session{}
+		db.Where("id = ?", session.ID).Take(&found)
+		return found
+	}
+
+	// within SessionSeenInterval nothing is written
+	if err := session.TouchSession(db, session.PublicID, "198.51.100.1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if found := lastSeen(); found.IP != "203.0.113.7" {
+		t.Errorf("touched within the interval: ip %s", found.IP)
+	}
+
+	later := time.Now().Add(2 * SessionSeenInterval)
+	if err := session.TouchSession(db, session.PublicID, "198.51.100.1", later); err != nil {
+		t.Fatal(err)
+	}
+	if found := lastSeen(); found.IP != "198.51.100.1" || !found.LastSeenAt.Equal(later) {
+		t.Errorf("touched after the interval: %s at %v, want %v", found.IP, found.LastSeenAt, later)
+	}
+
+	// a revoked session stays as it was
+	if err := session.RevokeSession(db, 1, session.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.TouchSession(db, session.PublicID, "192.0.2.1", later.Add(2*SessionSeenInterval)); err != nil {
+		t.Fatal(err)
+	}
+	if found := lastSeen(); found.IP != "198.51.100.1" {
+		t.Errorf("touched a revoked session: ip %s", found.IP)
+	}
+}
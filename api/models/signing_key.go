@@ -0,0 +1,92 @@
+package models
+
+import (
+	"os"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/norfabagas/auth-global/api/jwt"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+)
+
+// SigningKey is a keyring entry. The private key is stored as a PKCS #8 PEM
+// block encrypted with APP_KEY.
+type SigningKey struct {
+	ID          uint32     `gorm:"primary_key;not null;unique" json:"id"`
+	KID         string     `gorm:"column:kid;size:255;not null;unique" json:"kid"`
+	Algorithm   string     `gorm:"size:32;not null" json:"algorithm"`
+	PrivateKey  string     `gorm:"type:text;not null" json:"-"`
+	State       string     `gorm:"size:32;not null" json:"state"`
+	ActivatesAt time.Time  `gorm:"not null" json:"activates_at"`
+	RetiresAt   *time.Time `json:"retires_at"`
+	CreatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (signingKey *SigningKey) SaveSigningKey(db *gorm.DB, key *jwt.SigningKey) (*SigningKey, error) {
+	pemBytes, err := key.MarshalPrivateKey()
+	if err != nil {
+		return &SigningKey{}, err
+	}
+
+	encryptedKey, err := crypto.Encrypt(string(pemBytes), os.Getenv("APP_KEY"))
+	if err != nil {
+		return &SigningKey{}, err
+	}
+
+	signingKey.ID = 0
+	signingKey.KID = key.ID
+	signingKey.Algorithm = key.Method.Alg()
+	signingKey.PrivateKey = encryptedKey
+	signingKey.State = string(key.State)
+	signingKey.ActivatesAt = key.ActivatesAt
+	signingKey.RetiresAt = key.RetiresAt
+	signingKey.CreatedAt = time.Now()
+	signingKey.UpdatedAt = time.Now()
+
+	err = db.Debug().Create(&signingKey).Error
+	if err != nil {
+		return &SigningKey{}, err
+	}
+
+	return signingKey, nil
+}
+
+func (signingKey *SigningKey) FindAllSigningKeys(db *gorm.DB) (*[]SigningKey, error) {
+	signingKeys := []SigningKey{}
+	err := db.Debug().Model(&SigningKey{}).Order("activates_at desc").Find(&signingKeys).Error
+	if err != nil {
+		return &[]SigningKey{}, err
+	}
+
+	return &signingKeys, nil
+}
+
+func (signingKey *SigningKey) UpdateSigningKeyState(db *gorm.DB, kid, state string, retiresAt *time.Time) error {
+	return db.Debug().Model(&SigningKey{}).Where("kid = ?", kid).UpdateColumns(
+		map[string]interface{}{
+			"state":      state,
+			"retires_at": retiresAt,
+			"updated_at": time.Now(),
+		},
+	).Error
+}
+
+// Decode decrypts the stored private key into a keyring entry.
+func (signingKey *SigningKey) Decode() (*jwt.SigningKey, error) {
+	pemString, err := crypto.Decrypt(signingKey.PrivateKey, os.Getenv("APP_KEY"))
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := jwt.ParsePrivateKey([]byte(pemString))
+	if err != nil {
+		return nil, err
+	}
+
+	key.State = jwt.KeyState(signingKey.State)
+	key.ActivatesAt = signingKey.ActivatesAt
+	key.RetiresAt = signingKey.RetiresAt
+
+	return key, nil
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/norfabagas/auth-global/api/utils/crypto"
+	"github.com/norfabagas/auth-global/api/utils/totp"
+)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled    = errors.New("two-factor authentication enrollment has not been started")
+	ErrInvalidTOTPCode    = errors.New("invalid code")
+)
+
+func (user *User) TOTPEnabled() bool {
+	return user.TOTPEnabledAt != nil
+}
+
+// EnrollTOTP stores a new pending secret. It takes effect once a code from it
+// has been confirmed with EnableTOTP.
+func (user *User) EnrollTOTP(db *gorm.DB, id uint32, secret string) error {
+	encryptedSecret, err := crypto.Encrypt(secret, os.Getenv("APP_KEY"))
+	if err != nil {
+		return err
+	}
+
+	db = db.Debug().Model(&User{}).Where("id = ? AND totp_enabled_at IS NULL", id).UpdateColumns(
+		map[string]interface{}{
+			"totp_secret":    encryptedSecret,
+			"totp_last_step": 0,
+			"updated_at":     time.Now(),
+		},
+	)
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	return nil
+}
+
+// VerifyTOTP checks code against the user's secret. A code is accepted only
+// once, so an observed code cannot be replayed within its time window.
+func (user *User) VerifyTOTP(db *gorm.DB, code string) error {
+	if user.TOTPSecret == "" {
+		return ErrTOTPNotEnrolled
+	}
+
+	secret, err := crypto.Decrypt(user.TOTPSecret, os.Getenv("APP_KEY"))
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+
+	db = db.Debug().Model(&User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).UpdateColumns(
+		map[string]interface{}{
+			"totp_last_step": step,
+		},
+	)
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrInvalidTOTPCode
+	}
+	user.TOTPLastStep = step
+
+	return nil
+}
+
+func (user *User) EnableTOTP(db *gorm.DB, id uint32) error {
+	db = db.Debug().Model(&User{}).Where("id = ? AND totp_secret <> '' AND totp_enabled_at IS NULL", id).UpdateColumns(
+		map[string]interface{}{
+			"totp_enabled_at": time.Now(),
+			"updated_at":      time.Now(),
+		},
+	)
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	return nil
+}
+
+// DisableTOTP removes the secret and the recovery codes.
+func (user *User) DisableTOTP(db *gorm.DB, id uint32) error {
+	err := db.Debug().Model(&User{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+			"updated_at":      time.Now(),
+		},
+	).Error
+	if err != nil {
+		return err
+	}
+
+	recoveryCode := RecoveryCode{}
+	return recoveryCode.DeleteRecoveryCodes(db, id)
+}
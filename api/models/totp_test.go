@@ -0,0 +1,113 @@
+package models
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/norfabagas/auth-global/api/utils/totp"
+)
+
+const testAppKey = "0123456789abcdef0123456789abcdef"
+
+func TestVerifyTOTP(t *testing.T) {
+	os.Setenv("APP_KEY", testAppKey)
+	db := newTestDB(t, &User{})
+
+	user := User{PublicID: "user", Name: "user", Email: "user@example.com", Password: "password"}
+	err := db.Create(&user).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = user.EnrollTOTP(db, user.ID, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Take(&user, user.ID).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := "000000"
+	if wrong == code {
+		wrong = "111111"
+	}
+
+	if err = user.VerifyTOTP(db, wrong); err != ErrInvalidTOTPCode {
+		t.Errorf("wrong code: got %v, want %v", err, ErrInvalidTOTPCode)
+	}
+	if err = user.VerifyTOTP(db, code); err != nil {
+		t.Fatalf("current code: %v", err)
+	}
+	if err = user.VerifyTOTP(db, code); err != ErrInvalidTOTPCode {
+		t.Errorf("replayed code: got %v, want %v", err, ErrInvalidTOTPCode)
+	}
+
+	// an older code in the window is refused once a newer one was used
+	previous, err := totp.Code(secret, totp.Step(time.Now())-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = user.VerifyTOTP(db, previous); err != ErrInvalidTOTPCode {
+		t.Errorf("previous code after current: got %v, want %v", err, ErrInvalidTOTPCode)
+	}
+}
+
+func TestVerifyTOTPNotEnrolled(t *testing.T) {
+	user := User{}
+	if err := user.VerifyTOTP(nil, "123456"); err != ErrTOTPNotEnrolled {
+		t.Errorf("got %v, want %v", err, ErrTOTPNotEnrolled)
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	db := newTestDB(t, &RecoveryCode{})
+
+	recoveryCode := RecoveryCode{}
+	codes, err := recoveryCode.GenerateRecoveryCodes(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+
+	used, err := recoveryCode.UseRecoveryCode(db, 2, codes[0])
+	if err != nil || used {
+		t.Errorf("code of another user: got %v, %v", used, err)
+	}
+
+	// codes are accepted without the dash and in upper case
+	used, err = recoveryCode.UseRecoveryCode(db, 1, " "+strings.ToUpper(strings.Replace(codes[0], "-", "", 1))+" ")
+	if err != nil || !used {
+		t.Fatalf("first use: got %v, %v", used, err)
+	}
+	used, err = recoveryCode.UseRecoveryCode(db, 1, codes[0])
+	if err != nil || used {
+		t.Errorf("second use: got %v, %v", used, err)
+	}
+
+	count, err := recoveryCode.CountUnusedRecoveryCodes(db, 1)
+	if err != nil || count != RecoveryCodeCount-1 {
+		t.Errorf("unused codes: got %d, %v", count, err)
+	}
+
+	// regenerating invalidates the previous codes
+	_, err = recoveryCode.GenerateRecoveryCodes(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used, err = recoveryCode.UseRecoveryCode(db, 1, codes[1])
+	if err != nil || used {
+		t.Errorf("code from before regeneration: got %v, %v", used, err)
+	}
+}
@@ -10,25 +10,76 @@ import (
 	"github.com/badoux/checkmail"
 	"github.com/jinzhu/gorm"
 	"github.com/norfabagas/auth-global/api/utils/crypto"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/norfabagas/auth-global/api/utils/hashing"
+	"github.com/norfabagas/auth-global/api/utils/passwordpolicy"
 )
 
 type User struct {
-	ID        uint32    `gorm:"primary_key;not null;unique" json:"id"`
-	PublicID  string    `gorm:"size:255;not null;unique" json:"public_id"`
-	Name      string    `gorm:"size:255;not null" json:"name"`
-	Email     string    `gorm:"size:255;not null;unique" json:"email"`
-	Password  string    `gorm:"size:255;not null"`
-	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID                      uint32     `gorm:"primary_key;not null;unique" json:"id"`
+	PublicID                string     `gorm:"size:255;not null;unique" json:"public_id"`
+	Name                    string     `gorm:"size:255;not null" json:"name"`
+	Email                   string     `gorm:"size:255;not null;unique" json:"email"`
+	Password                string     `gorm:"size:255;not null"`
+	CreatedAt               time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt               time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	TokensRevokedAt         *time.Time `json:"-"`
+	DisabledAt              *time.Time `json:"disabled_at"`
+	PasswordResetRequiredAt *time.Time `json:"password_reset_required_at"`
+	EmailVerifiedAt         *time.Time `json:"email_verified_at"`
+	TOTPSecret              string     `json:"-"`
+	TOTPEnabledAt           *time.Time `json:"totp_enabled_at"`
+	TOTPLastStep            int64      `json:"-"`
+	FailedLoginCount        int        `json:"-"`
+	LastFailedLoginAt       *time.Time `json:"-"`
+	LockedUntil             *time.Time `json:"locked_until"`
 }
 
+var (
+	ErrUserDisabled          = errors.New("account is disabled")
+	ErrPasswordResetRequired = errors.New("password reset required, please use forget password")
+	ErrEmailNotVerified      = errors.New("email address is not verified")
+)
+
+// Email verification policies, set with EMAIL_VERIFICATION_POLICY.
+const (
+	// EmailVerificationAllow lets unverified users sign in normally.
+	EmailVerificationAllow = "allow"
+	// EmailVerificationRestrict signs unverified users in without roles.
+	EmailVerificationRestrict = "restrict"
+	// EmailVerificationBlock refuses sign in until the address is verified.
+	EmailVerificationBlock = "block"
+)
+
+func EmailVerificationPolicy() string {
+	switch policy := os.Getenv("EMAIL_VERIFICATION_POLICY"); policy {
+	case EmailVerificationRestrict, EmailVerificationBlock:
+		return policy
+	default:
+		return EmailVerificationAllow
+	}
+}
+
+// UserFilter narrows FindAllUsers. Zero values are ignored.
+type UserFilter struct {
+	Email       string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Disabled    *bool
+}
+
+// Hash encodes password with the configured hasher, see PASSWORD_HASHER.
 func Hash(password string) ([]byte, error) {
-	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hashing.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(hashedPassword), nil
 }
 
+// VerifyPassword checks password against a bcrypt or argon2id hash.
 func VerifyPassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	return hashing.Verify(hashedPassword, password)
 }
 
 func EscapeAndTrimString(input string) string {
@@ -95,11 +146,8 @@ func (user *User) Validate(action string) error {
 		if user.Password == "" {
 			return errors.New("required password")
 		}
-		if passwordLength := len([]rune(user.Password)); passwordLength < 8 {
-			return errors.New("password minimum is 8 characters")
-		}
 
-		return nil
+		return passwordpolicy.Load().Check(user.Password, user.Email, user.Name)
 
 	case "update":
 		if user.Name == "" {
@@ -112,9 +160,6 @@ func (user *User) Validate(action string) error {
 		if user.Password == "" {
 			return errors.New("required password")
 		}
-		if passwordLength := len([]rune(user.Password)); passwordLength < 8 {
-			return errors.New("new password minimum is 8 characters")
-		}
 
 		return nil
 
@@ -148,6 +193,12 @@ func (user *User) SaveUser(db *gorm.DB) (*User, error) {
 		return &User{}, err
 	}
 
+	passwordHistory := PasswordHistory{}
+	err = passwordHistory.SavePasswordHistory(db, user.ID, user.Password)
+	if err != nil {
+		return &User{}, err
+	}
+
 	// decrypt name
 	user.Name, _ = crypto.Decrypt(user.Name, os.Getenv("APP_KEY"))
 
@@ -178,6 +229,18 @@ func (user *User) FindUserByEmail(db *gorm.DB, email string) (*User, error) {
 	return user, nil
 }
 
+func (user *User) FindUserByPublicID(db *gorm.DB, publicID string) (*User, error) {
+	err := db.Debug().Model(&User{}).Where("public_id = ?", publicID).Take(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &User{}, errors.New("user not found")
+	}
+	if err != nil {
+		return &User{}, err
+	}
+
+	return user, nil
+}
+
 func (user *User) UpdateUser(db *gorm.DB, id uint32) (*User, error) {
 	encryptedName, err := crypto.Encrypt(user.Name, os.Getenv("APP_KEY"))
 	if err != nil {
@@ -207,20 +270,34 @@ func (user *User) UpdateUser(db *gorm.DB, id uint32) (*User, error) {
 	return user, nil
 }
 
+// ChangePassword sets a new password, refusing the user's recent ones with
+// ErrPasswordReused.
 func (user *User) ChangePassword(db *gorm.DB, id uint32, password string) (*User, error) {
+	passwordHistory := PasswordHistory{}
+	err := passwordHistory.CheckPasswordHistory(db, id, password)
+	if err != nil {
+		return &User{}, err
+	}
+
 	hashedPassword, err := Hash(password)
 	if err != nil {
 		return &User{}, err
 	}
 
-	db = db.Debug().Model(&User{}).Where("id = ?", id).UpdateColumns(
+	updated := db.Debug().Model(&User{}).Where("id = ?", id).UpdateColumns(
 		map[string]interface{}{
-			"password":   string(hashedPassword),
-			"updated_at": user.UpdatedAt,
+			"password":                   string(hashedPassword),
+			"password_reset_required_at": nil,
+			"updated_at":                 user.UpdatedAt,
 		},
 	)
-	if db.Error != nil {
-		return &User{}, db.Error
+	if updated.Error != nil {
+		return &User{}, updated.Error
+	}
+
+	err = passwordHistory.SavePasswordHistory(db, id, string(hashedPassword))
+	if err != nil {
+		return &User{}, err
 	}
 
 	err = db.Debug().Model(&User{}).Where("id = ?", id).Take(&user).Error
@@ -231,6 +308,139 @@ func (user *User) ChangePassword(db *gorm.DB, id uint32, password string) (*User
 	return user, nil
 }
 
+// ValidatePassword applies the password policy to password as the new
+// password of this account, which it may not mention.
+func (user *User) ValidatePassword(password string) error {
+	name, err := crypto.Decrypt(user.Name, os.Getenv("APP_KEY"))
+	if err != nil {
+		return err
+	}
+
+	return passwordpolicy.Load().Check(password, user.Email, name)
+}
+
+// RehashPassword replaces a hash made with an outdated algorithm or cost
+// once the password is known to be correct. It reports whether it did.
+func (user *User) RehashPassword(db *gorm.DB, id uint32, password string) (bool, error) {
+	if !hashing.NeedsRehash(user.Password) {
+		return false, nil
+	}
+
+	hashedPassword, err := Hash(password)
+	if err != nil {
+		return false, err
+	}
+
+	// the hash it replaces must still be in place, a concurrent password
+	// change wins
+	db = db.Debug().Model(&User{}).Where("id = ? AND password = ?", id, user.Password).UpdateColumns(
+		map[string]interface{}{
+			"password": string(hashedPassword),
+		},
+	)
+	if db.Error != nil {
+		return false, db.Error
+	}
+	if db.RowsAffected > 0 {
+		user.Password = string(hashedPassword)
+	}
+
+	return db.RowsAffected > 0, nil
+}
+
+// CanSignIn reports why the account may not be used, if anything.
+func (user *User) CanSignIn() error {
+	if user.DisabledAt != nil {
+		return ErrUserDisabled
+	}
+	if user.PasswordResetRequiredAt != nil {
+		return ErrPasswordResetRequired
+	}
+	if user.EmailVerifiedAt == nil && EmailVerificationPolicy() == EmailVerificationBlock {
+		return ErrEmailNotVerified
+	}
+
+	return nil
+}
+
+// VerifyEmail marks the address as verified. It reports false when the
+// address was already verified.
+func (user *User) VerifyEmail(db *gorm.DB, id uint32) (bool, error) {
+	db = db.Debug().Model(&User{}).Where("id = ? AND email_verified_at IS NULL", id).UpdateColumns(
+		map[string]interface{}{
+			"email_verified_at": time.Now(),
+			"updated_at":        time.Now(),
+		},
+	)
+	if db.Error != nil {
+		return false, db.Error
+	}
+
+	return db.RowsAffected > 0, nil
+}
+
+func (user *User) FindAllUsers(db *gorm.DB, filter UserFilter, page, perPage int) (*[]User, int, error) {
+	users := []User{}
+	total := 0
+
+	query := db.Debug().Model(&User{})
+	if filter.Email != "" {
+		query = query.Where("email ILIKE ?", "%"+strings.NewReplacer("%", `\%`, "_", `\_`).Replace(filter.Email)+"%")
+	}
+	if !filter.CreatedFrom.IsZero() {
+		query = query.Where("created_at >= ?", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		query = query.Where("created_at < ?", filter.CreatedTo)
+	}
+	if filter.Disabled != nil && *filter.Disabled {
+		query = query.Where("disabled_at IS NOT NULL")
+	}
+	if filter.Disabled != nil && !*filter.Disabled {
+		query = query.Where("disabled_at IS NULL")
+	}
+
+	err := query.Count(&total).Error
+	if err != nil {
+		return &[]User{}, 0, err
+	}
+
+	err = query.Order("created_at desc").Order("id desc").Offset((page - 1) * perPage).Limit(perPage).Find(&users).Error
+	if err != nil {
+		return &[]User{}, 0, err
+	}
+
+	return &users, total, nil
+}
+
+func (user *User) DisableUser(db *gorm.DB, id uint32) error {
+	return db.Debug().Model(&User{}).Where("id = ? AND disabled_at IS NULL", id).UpdateColumns(
+		map[string]interface{}{
+			"disabled_at": time.Now(),
+			"updated_at":  time.Now(),
+		},
+	).Error
+}
+
+func (user *User) EnableUser(db *gorm.DB, id uint32) error {
+	return db.Debug().Model(&User{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"disabled_at": nil,
+			"updated_at":  time.Now(),
+		},
+	).Error
+}
+
+// RequirePasswordReset blocks sign in until the password has been changed.
+func (user *User) RequirePasswordReset(db *gorm.DB, id uint32) error {
+	return db.Debug().Model(&User{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"password_reset_required_at": time.Now(),
+			"updated_at":                 time.Now(),
+		},
+	).Error
+}
+
 func (user *User) DeleteUser(db *gorm.DB, id uint32) (string, error) {
 	db = db.Debug().Model(&User{}).Where("id = ?", id).Take(&user).Delete(&user)
 	if db.Error != nil {
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAdminUserActions(t *testing.T) {
+	os.Setenv("APP_KEY", testAppKey)
+	db := newTestDB(t, &User{}, &PasswordHistory{})
+
+	users := []User{}
+	for _, email := range []string{"jane@example.com", "john@example.com"} {
+		user := User{Name: "Test", Email: email, Password: "correct horse battery"}
+		err := db.Create(&user).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	jane, john := users[0], users[1]
+
+	admin := User{}
+	err := admin.DisableUser(db, jane.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := (&User{}).FindUserByPublicID(db, jane.PublicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := found.CanSignIn(); err != ErrUserDisabled {
+		t.Errorf("disabled user signs in: %v, want %v", err, ErrUserDisabled)
+	}
+
+	disabled := true
+	listed, total, err := admin.FindAllUsers(db, UserFilter{Disabled: &disabled}, 1, 10)
+	if err != nil || total != 1 || len(*listed) != 1 || (*listed)[0].ID != jane.ID {
+		t.Fatalf("disabled users: %v %d %v", listed, total, err)
+	}
+	disabled = false
+	listed, total, err = admin.FindAllUsers(db, UserFilter{Disabled: &disabled}, 1, 10)
+	if err != nil || total != 1 || (*listed)[0].ID != john.ID {
+		t.Fatalf("enabled users: %v %d %v", listed, total, err)
+	}
+
+	err = admin.EnableUser(db, jane.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = (&User{}).FindUserByPublicID(db, jane.PublicID)
+	if err != nil || found.CanSignIn() != nil {
+		t.Fatalf("enabled user cannot sign in: %v %v", err, found.CanSignIn())
+	}
+
+	// a forced reset holds until the password is changed
+	err = admin.RequirePasswordReset(db, john.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = (&User{}).FindUserByPublicID(db, john.PublicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := found.CanSignIn(); err != ErrPasswordResetRequired {
+		t.Errorf("user with a forced reset signs in: %v, want %v", err, ErrPasswordResetRequired)
+	}
+	changed, err := (&User{}).ChangePassword(db, john.ID, "another correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := changed.CanSignIn(); err != nil {
+		t.Errorf("user cannot sign in after the reset: %v", err)
+	}
+
+	email, err := admin.DeleteUser(db, john.ID)
+	if err != nil || email != john.Email {
+		t.Fatalf("deleting: %q %v", email, err)
+	}
+	_, err = (&User{}).FindUserByPublicID(db, john.PublicID)
+	if err == nil {
+		t.Error("deleted user is still found")
+	}
+	listed, total, err = admin.FindAllUsers(db, UserFilter{}, 1, 10)
+	if err != nil || total != 1 || (*listed)[0].ID != jane.ID {
+		t.Fatalf("users after deleting: %v %d %v", listed, total, err)
+	}
+}
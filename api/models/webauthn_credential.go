@@ -0,0 +1,227 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/norfabagas/auth-global/api/webauthn"
+)
+
+const WebAuthnChallengeExpiryInMinute = 5
+
+// WebAuthn ceremonies a challenge can be used for.
+const (
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+)
+
+var (
+	ErrWebAuthnCredentialNotFound = errors.New("credential not found")
+	ErrInvalidWebAuthnChallenge   = errors.New("invalid or expired challenge")
+)
+
+// WebAuthnCredential is a passkey registered by a user. CredentialID is
+// base64url encoded.
+type WebAuthnCredential struct {
+	ID           uint32     `gorm:"primary_key;not null;unique" json:"id"`
+	UserID       uint32     `gorm:"not null" json:"-"`
+	CredentialID string     `gorm:"size:1400;not null;unique" json:"credential_id"`
+	PublicKey    []byte     `gorm:"not null" json:"-"`
+	Algorithm    int64      `gorm:"not null" json:"algorithm"`
+	SignCount    int64      `gorm:"not null" json:"-"`
+	AAGUID       string     `gorm:"column:aaguid;size:32;not null" json:"aaguid"`
+	Transports   string     `gorm:"size:255;not null" json:"-"`
+	Name         string     `gorm:"size:255;not null" json:"name"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// WebAuthnChallenge is a pending ceremony. Login challenges have no user
+// when the authenticator picks a discoverable credential.
+type WebAuthnChallenge struct {
+	ID        uint32    `gorm:"primary_key;not null;unique" json:"id"`
+	UserID    *uint32   `json:"user_id"`
+	Ceremony  string    `gorm:"size:32;not null" json:"ceremony"`
+	Challenge string    `gorm:"size:255;not null;unique" json:"challenge"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (WebAuthnChallenge) TableName() string {
+	return "webauthn_challenges"
+}
+
+func EncodeCredentialID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+func NewWebAuthnCredential(userID uint32, name string, credential *webauthn.Credential) *WebAuthnCredential {
+	name = EscapeAndTrimString(name)
+	if name == "" {
+		name = "Passkey"
+	}
+
+	return &WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: EncodeCredentialID(credential.ID),
+		PublicKey:    credential.PublicKey,
+		Algorithm:    credential.Algorithm,
+		SignCount:    int64(credential.SignCount),
+		AAGUID:       hex.EncodeToString(credential.AAGUID),
+		Transports:   strings.Join(credential.Transports, ","),
+		Name:         name,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// Credential converts the stored record for webauthn.RelyingParty.
+func (credential *WebAuthnCredential) Credential() (*webauthn.Credential, error) {
+	id, err := base64.RawURLEncoding.DecodeString(credential.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webauthn.Credential{
+		ID:         id,
+		PublicKey:  credential.PublicKey,
+		Algorithm:  credential.Algorithm,
+		SignCount:  uint32(credential.SignCount),
+		Transports: credential.TransportList(),
+	}, nil
+}
+
+func (credential *WebAuthnCredential) TransportList() []string {
+	if credential.Transports == "" {
+		return nil
+	}
+
+	return strings.Split(credential.Transports, ",")
+}
+
+func (credential *WebAuthnCredential) SaveWebAuthnCredential(db *gorm.DB) (*WebAuthnCredential, error) {
+	count := 0
+	db.Debug().Model(&WebAuthnCredential{}).Where("credential_id = ?", credential.CredentialID).Count(&count)
+	if count > 0 {
+		return &WebAuthnCredential{}, errors.New("credential already registered")
+	}
+
+	err := db.Debug().Create(&credential).Error
+	if err != nil {
+		return &WebAuthnCredential{}, err
+	}
+
+	return credential, nil
+}
+
+func (credential *WebAuthnCredential) FindWebAuthnCredential(db *gorm.DB, credentialID string) (*WebAuthnCredential, error) {
+	err := db.Debug().Model(&WebAuthnCredential{}).Where("credential_id = ?", credentialID).Take(&credential).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &WebAuthnCredential{}, ErrWebAuthnCredentialNotFound
+	}
+	if err != nil {
+		return &WebAuthnCredential{}, err
+	}
+
+	return credential, nil
+}
+
+func (credential *WebAuthnCredential) FindUserWebAuthnCredentials(db *gorm.DB, userID uint32) (*[]WebAuthnCredential, error) {
+	credentials := []WebAuthnCredential{}
+	err := db.Debug().Model(&WebAuthnCredential{}).Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	if err != nil {
+		return &[]WebAuthnCredential{}, err
+	}
+
+	return &credentials, nil
+}
+
+// UseWebAuthnCredential stores the signature counter of a successful
+// assertion. It fails when a concurrent assertion already moved the counter
+// past signCount.
+func (credential *WebAuthnCredential) UseWebAuthnCredential(db *gorm.DB, id uint32, signCount uint32) error {
+	db = db.Debug().Model(&WebAuthnCredential{}).Where("id = ? AND (sign_count < ? OR sign_count = 0)", id, signCount).UpdateColumns(
+		map[string]interface{}{
+			"sign_count":   signCount,
+			"last_used_at": time.Now(),
+		},
+	)
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return webauthn.ErrSignCountRegression
+	}
+
+	return nil
+}
+
+func (credential *WebAuthnCredential) DeleteWebAuthnCredential(db *gorm.DB, userID, id uint32) error {
+	db = db.Debug().Where("id = ? AND user_id = ?", id, userID).Delete(&WebAuthnCredential{})
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	return nil
+}
+
+// SaveWebAuthnChallenge starts a ceremony and returns its challenge.
+func (challenge *WebAuthnChallenge) SaveWebAuthnChallenge(db *gorm.DB, ceremony string, userID *uint32) ([]byte, error) {
+	value, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	// abandoned ceremonies are cleaned up as new ones start
+	err = db.Debug().Where("expires_at < ?", time.Now()).Delete(&WebAuthnChallenge{}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	challenge.ID = 0
+	challenge.UserID = userID
+	challenge.Ceremony = ceremony
+	challenge.Challenge = base64.RawURLEncoding.EncodeToString(value)
+	challenge.ExpiresAt = time.Now().Add(time.Minute * WebAuthnChallengeExpiryInMinute)
+	challenge.CreatedAt = time.Now()
+
+	err = db.Debug().Create(&challenge).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// ConsumeWebAuthnChallenge removes the challenge, so each ceremony can only
+// be finished once.
+func (challenge *WebAuthnChallenge) ConsumeWebAuthnChallenge(db *gorm.DB, ceremony string, value []byte) (*WebAuthnChallenge, error) {
+	encoded := base64.RawURLEncoding.EncodeToString(value)
+	err := db.Debug().Model(&WebAuthnChallenge{}).Where("challenge = ? AND ceremony = ?", encoded, ceremony).Take(&challenge).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &WebAuthnChallenge{}, ErrInvalidWebAuthnChallenge
+	}
+	if err != nil {
+		return &WebAuthnChallenge{}, err
+	}
+
+	consumed := db.Debug().Where("id = ? AND expires_at > ?", challenge.ID, time.Now()).Delete(&WebAuthnChallenge{})
+	if consumed.Error != nil {
+		return &WebAuthnChallenge{}, consumed.Error
+	}
+	if consumed.RowsAffected == 0 {
+		return &WebAuthnChallenge{}, ErrInvalidWebAuthnChallenge
+	}
+
+	return challenge, nil
+}
@@ -36,3 +36,20 @@ func ERROR(w http.ResponseWriter, statusCode int, err error) {
 	}
 	JSON(w, http.StatusBadRequest, false, http.StatusText(http.StatusBadRequest), nil)
 }
+
+// RAW writes data without the response envelope, for endpoints whose body
+// is defined by a standard (JWKS, OAuth).
+func RAW(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.WriteHeader(statusCode)
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		fmt.Fprintf(w, "%s", err.Error())
+	}
+}
+
+// BearerError reports a bearer token error of RFC 6750 section 3 in the
+// WWW-Authenticate header and the body.
+func BearerError(w http.ResponseWriter, statusCode int, code, description string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="`+code+`", error_description="`+description+`"`)
+	RAW(w, statusCode, map[string]string{"error": code, "error_description": description})
+}
@@ -2,7 +2,9 @@ package api
 
 import (
 	"log"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/norfabagas/auth-global/api/controllers"
 )
@@ -16,5 +18,15 @@ func Run() {
 		log.Fatalf("APP_KEY is not 32 bit long")
 	}
 
+	// links sent by email are built from APP_URL, never from the request
+	if appURL, err := url.Parse(os.Getenv("APP_URL")); err != nil || (appURL.Scheme != "https" && appURL.Scheme != "http") || appURL.Host == "" {
+		log.Fatalf("APP_URL must be the public URL of the service, e.g. https://auth.example.com")
+	}
+
+	if err := server.InitializeKeyring(os.Getenv("JWT_PRIVATE_KEY_PATH")); err != nil {
+		log.Fatalf("Cannot load JWT signing keys: %v", err)
+	}
+	go server.WatchKeyring(time.Minute)
+
 	server.Run(":" + os.Getenv("PORT"))
 }
@@ -2,13 +2,10 @@ package formatting
 
 import (
 	"errors"
-	"log"
 	"strings"
 )
 
 func FormatError(err string) error {
-	defer log.Println(err)
-
 	if strings.Contains(err, "name") {
 		return errors.New("name already taken")
 	}
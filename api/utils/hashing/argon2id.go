@@ -0,0 +1,118 @@
+package hashing
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Argon2id hashes with argon2id and stores the parameters alongside the
+// salt in the PHC string format:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+type Argon2id struct {
+	// Memory in KiB.
+	Memory     uint32
+	Time       uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// NewArgon2id reads the parameters from ARGON2_MEMORY (KiB), ARGON2_TIME
+// and ARGON2_THREADS. The defaults follow the OWASP recommendation of
+// 19 MiB, two iterations and one thread.
+func NewArgon2id() *Argon2id {
+	return &Argon2id{
+		Memory:     uint32(envUint("ARGON2_MEMORY", 19*1024, 32)),
+		Time:       uint32(envUint("ARGON2_TIME", 2, 32)),
+		Threads:    uint8(envUint("ARGON2_THREADS", 1, 8)),
+		SaltLength: 16,
+		KeyLength:  32,
+	}
+}
+
+func (hasher *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, hasher.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, hasher.Time, hasher.Memory, hasher.Threads, hasher.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, hasher.Memory, hasher.Time, hasher.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (hasher *Argon2id) Verify(encoded, password string) error {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+func (hasher *Argon2id) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (hasher *Argon2id) Outdated(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+
+	return err != nil ||
+		params.Memory != hasher.Memory || params.Time != hasher.Time || params.Threads != hasher.Threads ||
+		uint32(len(salt)) != hasher.SaltLength || uint32(len(key)) != hasher.KeyLength
+}
+
+// decodeArgon2id parses a PHC string into its parameters, salt and key.
+func decodeArgon2id(encoded string) (*Argon2id, []byte, []byte, error) {
+	invalid := errors.New("invalid argon2id hash")
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, invalid
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, invalid
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	params := &Argon2id{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return nil, nil, nil, invalid
+	}
+	if params.Memory == 0 || params.Time == 0 || params.Threads == 0 {
+		return nil, nil, nil, invalid
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, invalid
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, invalid
+	}
+
+	return params, salt, key, nil
+}
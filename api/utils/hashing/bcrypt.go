@@ -0,0 +1,45 @@
+package hashing
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt hashes with bcrypt at Cost.
+type Bcrypt struct {
+	Cost int
+}
+
+// NewBcrypt reads the cost from BCRYPT_COST, defaulting to bcrypt.DefaultCost.
+func NewBcrypt() *Bcrypt {
+	cost := int(envUint("BCRYPT_COST", uint64(bcrypt.DefaultCost), 8))
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+
+	return &Bcrypt{Cost: cost}
+}
+
+func (hasher *Bcrypt) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), hasher.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashed), nil
+}
+
+func (hasher *Bcrypt) Verify(encoded, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+}
+
+func (hasher *Bcrypt) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (hasher *Bcrypt) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	return err != nil || cost != hasher.Cost
+}
@@ -0,0 +1,77 @@
+package hashing
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrMismatch is returned when the password does not match the hash. It is
+	// bcrypt's error, so callers matching it keep working for every algorithm.
+	ErrMismatch = bcrypt.ErrMismatchedHashAndPassword
+	// ErrUnknownHash is returned for hashes no hasher recognizes.
+	ErrUnknownHash = errors.New("unknown password hash format")
+)
+
+// Hasher hashes passwords with one algorithm and parameter set.
+type Hasher interface {
+	// Hash encodes password with a fresh salt.
+	Hash(password string) (string, error)
+	// Verify compares password against a hash this hasher recognizes.
+	Verify(encoded, password string) error
+	// Recognizes reports whether encoded was made with this algorithm.
+	Recognizes(encoded string) bool
+	// Outdated reports whether a recognized hash uses other parameters.
+	Outdated(encoded string) bool
+}
+
+// hashers lists every supported algorithm, so existing hashes verify after
+// the configured one changes.
+func hashers() []Hasher {
+	return []Hasher{NewArgon2id(), NewBcrypt()}
+}
+
+// Configured returns the hasher for new hashes, set with PASSWORD_HASHER
+// (argon2id by default, or bcrypt).
+func Configured() Hasher {
+	if os.Getenv("PASSWORD_HASHER") == "bcrypt" {
+		return NewBcrypt()
+	}
+
+	return NewArgon2id()
+}
+
+// Hash encodes password with the configured hasher.
+func Hash(password string) (string, error) {
+	return Configured().Hash(password)
+}
+
+// Verify detects the algorithm of encoded and compares password against it.
+func Verify(encoded, password string) error {
+	for _, hasher := range hashers() {
+		if hasher.Recognizes(encoded) {
+			return hasher.Verify(encoded, password)
+		}
+	}
+
+	return ErrUnknownHash
+}
+
+// NeedsRehash reports whether encoded should be replaced by a hash from the
+// configured hasher, because the algorithm or its parameters changed.
+func NeedsRehash(encoded string) bool {
+	hasher := Configured()
+
+	return !hasher.Recognizes(encoded) || hasher.Outdated(encoded)
+}
+
+func envUint(key string, fallback uint64, bitSize int) uint64 {
+	value, err := strconv.ParseUint(os.Getenv(key), 10, bitSize)
+	if err != nil || value == 0 {
+		return fallback
+	}
+	return value
+}
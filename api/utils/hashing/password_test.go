@@ -0,0 +1,200 @@
+package hashing
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setenv sets environment variables for the duration of a test.
+func setenv(t *testing.T, values map[string]string) {
+	for key, value := range values {
+		previous, ok := os.LookupEnv(key)
+		os.Setenv(key, value)
+		key := key
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, previous)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+}
+
+// cheap keeps the argon2id and bcrypt parameters low so tests run fast.
+func cheap(t *testing.T, hasher string) {
+	setenv(t, map[string]string{
+		"PASSWORD_HASHER": hasher,
+		"ARGON2_MEMORY":   "64",
+		"ARGON2_TIME":     "1",
+		"ARGON2_THREADS":  "1",
+		"BCRYPT_COST":     "4",
+	})
+}
+
+func TestArgon2id(t *testing.T) {
+	hasher := &Argon2id{Memory: 64, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}
+
+	encoded, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("hash %q is not in the PHC format", encoded)
+	}
+	if !hasher.Recognizes(encoded) || hasher.Outdated(encoded) {
+		t.Errorf("hash %q not recognized as current", encoded)
+	}
+
+	if err := hasher.Verify(encoded, "correct horse"); err != nil {
+		t.Errorf("Verify with the password: %v", err)
+	}
+	if err := hasher.Verify(encoded, "correct horse "); err != ErrMismatch {
+		t.Errorf("Verify with another password = %v, want ErrMismatch", err)
+	}
+
+	// every hash gets its own salt
+	again, _ := hasher.Hash("correct horse")
+	if again == encoded {
+		t.Error("two hashes of the same password are equal")
+	}
+}
+
+func TestArgon2idParameters(t *testing.T) {
+	hasher := &Argon2id{Memory: 64, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}
+	encoded, _ := hasher.Hash("correct horse")
+
+	// hashes verify with the parameters they were made with
+	stronger := &Argon2id{Memory: 128, Time: 2, Threads: 2, SaltLength: 16, KeyLength: 32}
+	if err := stronger.Verify(encoded, "correct horse"); err != nil {
+		t.Errorf("Verify with other parameters: %v", err)
+	}
+
+	for _, other := range []*Argon2id{
+		stronger,
+		{Memory: 64, Time: 2, Threads: 1, SaltLength: 16, KeyLength: 32},
+		{Memory: 64, Time: 1, Threads: 1, SaltLength: 32, KeyLength: 32},
+		{Memory: 64, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 64},
+	} {
+		if !other.Outdated(encoded) {
+			t.Errorf("%+v: hash not outdated", other)
+		}
+	}
+}
+
+func TestArgon2idMalformed(t *testing.T) {
+	hasher := &Argon2id{Memory: 64, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}
+	encoded, _ := hasher.Hash("correct horse")
+	parts := strings.Split(encoded, "$")
+
+	for name, malformed := range map[string]string{
+		"empty":         "",
+		"truncated":     strings.Join(parts[:5], "$"),
+		"other variant": strings.Replace(encoded, "argon2id", "argon2i", 1),
+		"version":       strings.Replace(encoded, "v=19", "v=16", 1),
+		"zero memory":   strings.Replace(encoded, "m=64", "m=0", 1),
+		"parameters":    strings.Replace(encoded, "m=64,t=1,p=1", "m=64", 1),
+		"salt":          strings.Join([]string{"", parts[1], parts[2], parts[3], "!", parts[5]}, "$"),
+		"key":           strings.Join([]string{"", parts[1], parts[2], parts[3], parts[4], ""}, "$"),
+	} {
+		if err := hasher.Verify(malformed, "correct horse"); err == nil || err == ErrMismatch {
+			t.Errorf("%s: Verify = %v, want a format error", name, err)
+		}
+		if !hasher.Outdated(malformed) {
+			t.Errorf("%s: malformed hash not outdated", name)
+		}
+	}
+}
+
+func TestBcrypt(t *testing.T) {
+	hasher := &Bcrypt{Cost: bcrypt.MinCost}
+
+	encoded, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasher.Recognizes(encoded) || hasher.Outdated(encoded) {
+		t.Errorf("hash %q not recognized as current", encoded)
+	}
+	if err := hasher.Verify(encoded, "correct horse"); err != nil {
+		t.Errorf("Verify with the password: %v", err)
+	}
+	if err := hasher.Verify(encoded, "wrong"); err != ErrMismatch {
+		t.Errorf("Verify with another password = %v, want ErrMismatch", err)
+	}
+
+	if !(&Bcrypt{Cost: bcrypt.MinCost + 1}).Outdated(encoded) {
+		t.Error("hash with another cost not outdated")
+	}
+}
+
+func TestConfigured(t *testing.T) {
+	cheap(t, "")
+	if _, ok := Configured().(*Argon2id); !ok {
+		t.Errorf("default hasher is %T, want argon2id", Configured())
+	}
+
+	setenv(t, map[string]string{"PASSWORD_HASHER": "bcrypt"})
+	if hasher, ok := Configured().(*Bcrypt); !ok || hasher.Cost != 4 {
+		t.Errorf("bcrypt hasher is %#v", Configured())
+	}
+
+	// out of range values fall back to the defaults
+	setenv(t, map[string]string{"BCRYPT_COST": "99", "ARGON2_THREADS": "0", "ARGON2_TIME": "many"})
+	if hasher := NewBcrypt(); hasher.Cost != bcrypt.DefaultCost {
+		t.Errorf("bcrypt cost %d, want %d", hasher.Cost, bcrypt.DefaultCost)
+	}
+	if hasher := NewArgon2id(); hasher.Threads != 1 || hasher.Time != 2 {
+		t.Errorf("argon2id %+v", hasher)
+	}
+}
+
+func TestVerifyAndRehash(t *testing.T) {
+	cheap(t, "bcrypt")
+	bcryptHash, err := Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRehash(bcryptHash) {
+		t.Error("hash from the configured hasher needs a rehash")
+	}
+
+	// switching algorithm keeps old hashes verifying but asks for a rehash
+	setenv(t, map[string]string{"PASSWORD_HASHER": "argon2id"})
+	if err := Verify(bcryptHash, "correct horse"); err != nil {
+		t.Errorf("Verify bcrypt hash: %v", err)
+	}
+	if !NeedsRehash(bcryptHash) {
+		t.Error("bcrypt hash does not need a rehash under argon2id")
+	}
+
+	argon2idHash, err := Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(argon2idHash, argon2idPrefix) || NeedsRehash(argon2idHash) {
+		t.Errorf("argon2id hash %q", argon2idHash)
+	}
+	if err := Verify(argon2idHash, "wrong"); err != ErrMismatch {
+		t.Errorf("Verify with another password = %v, want ErrMismatch", err)
+	}
+
+	// raising a parameter asks for a rehash too
+	setenv(t, map[string]string{"ARGON2_TIME": "2"})
+	if !NeedsRehash(argon2idHash) {
+		t.Error("argon2id hash with an old time cost does not need a rehash")
+	}
+	if err := Verify(argon2idHash, "correct horse"); err != nil {
+		t.Errorf("Verify with old parameters: %v", err)
+	}
+
+	if err := Verify("plaintext", "plaintext"); err != ErrUnknownHash {
+		t.Errorf("Verify unknown hash = %v, want ErrUnknownHash", err)
+	}
+	if !NeedsRehash("plaintext") {
+		t.Error("unknown hash does not need a rehash")
+	}
+}
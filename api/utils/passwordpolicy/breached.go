@@ -0,0 +1,59 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const breachedPrefixLength = 5
+
+// Breached looks password up in a local copy of a breached password list
+// split by hash prefix, as served by the Pwned Passwords range API: dir
+// holds one file per five character upper case SHA-1 prefix, e.g. 5BAA6 or
+// 5BAA6.txt, with one SUFFIX:COUNT line per hash. Only the file of the
+// password's prefix is read. A missing file means no hash with that prefix
+// is known; a file that cannot be read is logged and treated the same.
+func Breached(dir, password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+
+	file, err := os.Open(filepath.Join(dir, prefix))
+	if os.IsNotExist(err) {
+		file, err = os.Open(filepath.Join(dir, prefix+".txt"))
+	}
+	if os.IsNotExist(err) {
+		return false
+	}
+	if err != nil {
+		log.Printf("breached password list: %v", err)
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if colon := strings.IndexByte(line, ':'); colon >= 0 {
+			line = line[:colon]
+		}
+		line = strings.ToUpper(line)
+		// files of full hashes work as well
+		if len(line) == len(hash) {
+			line = strings.TrimPrefix(line, prefix)
+		}
+		if line == suffix {
+			return true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("breached password list: %v", err)
+	}
+
+	return false
+}
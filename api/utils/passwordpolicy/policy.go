@@ -0,0 +1,199 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Rules reported in violations.
+const (
+	RuleMinLength    = "min_length"
+	RuleMaxLength    = "max_length"
+	RuleLowercase    = "lowercase"
+	RuleUppercase    = "uppercase"
+	RuleDigit        = "digit"
+	RuleSymbol       = "symbol"
+	RuleStrength     = "strength"
+	RulePersonalInfo = "personal_info"
+	RuleBreached     = "breached"
+	// RuleReused is reported by callers that keep a password history.
+	RuleReused = "reused"
+)
+
+// Violation is one rule a password failed.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error lists every rule a password failed.
+type Error struct {
+	Violations []Violation
+}
+
+func (err *Error) Error() string {
+	messages := []string{}
+	for _, violation := range err.Violations {
+		messages = append(messages, violation.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Policy decides which passwords are accepted.
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// MinScore is the lowest accepted strength score, 0 to 4.
+	MinScore int
+	// BreachedDir holds the breached password hash list, see Breached.
+	BreachedDir string
+}
+
+// Load reads the policy from the environment:
+//
+//	PASSWORD_MIN_LENGTH         minimum length in characters, defaults to 8
+//	PASSWORD_MAX_LENGTH         maximum length in characters, defaults to 128
+//	PASSWORD_REQUIRE            comma separated character classes: lower, upper, digit, symbol
+//	PASSWORD_MIN_SCORE          lowest strength score from 0 to 4, defaults to 2
+//	PASSWORD_BREACHED_HASH_DIR  directory of SHA-1 prefix files, unset disables the check
+func Load() Policy {
+	policy := Policy{
+		MinLength:   envInt("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:   envInt("PASSWORD_MAX_LENGTH", 128),
+		MinScore:    envInt("PASSWORD_MIN_SCORE", 2),
+		BreachedDir: os.Getenv("PASSWORD_BREACHED_HASH_DIR"),
+	}
+	if policy.MaxLength < policy.MinLength {
+		policy.MaxLength = policy.MinLength
+	}
+	if policy.MinScore > 4 {
+		policy.MinScore = 4
+	}
+
+	for _, class := range strings.Split(os.Getenv("PASSWORD_REQUIRE"), ",") {
+		switch strings.TrimSpace(strings.ToLower(class)) {
+		case "lower":
+			policy.RequireLower = true
+		case "upper":
+			policy.RequireUpper = true
+		case "digit":
+			policy.RequireDigit = true
+		case "symbol":
+			policy.RequireSymbol = true
+		}
+	}
+
+	return policy
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+// Check applies every rule to password. userInputs are the account's email
+// address, name and the like, which the password may not contain. The
+// returned error is an *Error listing all failed rules.
+func (policy Policy) Check(password string, userInputs ...string) error {
+	violations := []Violation{}
+	fail := func(rule, message string) {
+		violations = append(violations, Violation{Rule: rule, Message: message})
+	}
+
+	length := len([]rune(password))
+	if length < policy.MinLength {
+		fail(RuleMinLength, fmt.Sprintf("password minimum is %d characters", policy.MinLength))
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		fail(RuleMaxLength, fmt.Sprintf("password maximum is %d characters", policy.MaxLength))
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if policy.RequireLower && !lower {
+		fail(RuleLowercase, "password must contain a lowercase letter")
+	}
+	if policy.RequireUpper && !upper {
+		fail(RuleUppercase, "password must contain an uppercase letter")
+	}
+	if policy.RequireDigit && !digit {
+		fail(RuleDigit, "password must contain a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		fail(RuleSymbol, "password must contain a symbol")
+	}
+
+	if part := personalInfo(password, userInputs); part != "" {
+		fail(RulePersonalInfo, "password must not contain your "+part)
+	}
+
+	// the estimate looks at every substring, longer passwords are not scored
+	if policy.MinScore > 0 && length <= maxScoredLength {
+		if score := Score(password, userInputs...); score < policy.MinScore {
+			fail(RuleStrength, fmt.Sprintf("password is too easy to guess (strength %d of 4, at least %d required)", score, policy.MinScore))
+		}
+	}
+
+	if policy.BreachedDir != "" && Breached(policy.BreachedDir, password) {
+		fail(RuleBreached, "password has appeared in a data breach, please choose another")
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+
+	return nil
+}
+
+// personalInfo names the user input found in password, if any. Email
+// addresses are checked whole and by their local part, names word by word.
+func personalInfo(password string, userInputs []string) string {
+	password = strings.ToLower(password)
+
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input == "" {
+			continue
+		}
+
+		if at := strings.LastIndex(input, "@"); at > 0 {
+			if strings.Contains(password, input) {
+				return "email address"
+			}
+			if local := input[:at]; len([]rune(local)) >= 3 && strings.Contains(password, local) {
+				return "email address"
+			}
+			continue
+		}
+
+		for _, word := range strings.FieldsFunc(input, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			if len([]rune(word)) >= 3 && strings.Contains(password, word) {
+				return "name"
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,172 @@
+package passwordpolicy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// rules lists the rules err reports, nil when err is nil.
+func rules(t *testing.T, err error) []string {
+	if err == nil {
+		return nil
+	}
+	policyErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("error %T is not an *Error", err)
+	}
+
+	rules := []string{}
+	for _, violation := range policyErr.Violations {
+		rules = append(rules, violation.Rule)
+	}
+	return rules
+}
+
+func TestCheck(t *testing.T) {
+	policy := Policy{MinLength: 8, MaxLength: 16, RequireLower: true, RequireUpper: true, RequireDigit: true, RequireSymbol: true, MinScore: 2}
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{"x7#Kq!9vLz", nil},
+		{"x7#Kq!9", []string{RuleMinLength}},
+		{"x7#Kq!9vLzx7#Kq!9vLz", []string{RuleMaxLength}},
+		{"X7#KQ!9VLZ", []string{RuleLowercase}},
+		{"x7#kq!9vlz", []string{RuleUppercase}},
+		{"xr#Kq!avLz", []string{RuleDigit}},
+		{"x7iKqo9vLz", []string{RuleSymbol}},
+		{"password", []string{RuleUppercase, RuleDigit, RuleSymbol, RuleStrength}},
+		{"", []string{RuleMinLength, RuleLowercase, RuleUppercase, RuleDigit, RuleSymbol, RuleStrength}},
+	}
+	for _, test := range tests {
+		if got := rules(t, policy.Check(test.password)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Check(%q) = %v, want %v", test.password, got, test.want)
+		}
+	}
+
+	// length counts characters, not bytes
+	if got := rules(t, (Policy{MinLength: 4}).Check("ääää")); got != nil {
+		t.Errorf("Check of four two-byte characters = %v", got)
+	}
+}
+
+func TestCheckMessages(t *testing.T) {
+	err := (Policy{MinLength: 8, RequireDigit: true}).Check("short")
+	if err == nil || err.Error() != "password minimum is 8 characters; password must contain a digit" {
+		t.Errorf("Check = %v", err)
+	}
+}
+
+func TestCheckPersonalInfo(t *testing.T) {
+	policy := Policy{}
+	inputs := []string{"jane.doe@example.com", "Jane Doe"}
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{"x7#Kq!9vLz", nil},
+		{"x7#jane.doe@example.com", []string{RulePersonalInfo}},
+		{"x7#JANE.DOEq!9", []string{RulePersonalInfo}},
+		{"x7#Janeq!9vLz", []string{RulePersonalInfo}},
+		// words shorter than three characters are allowed
+		{"x7#Kq!9vLzjd", nil},
+	}
+	for _, test := range tests {
+		if got := rules(t, policy.Check(test.password, inputs...)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Check(%q) = %v, want %v", test.password, got, test.want)
+		}
+	}
+
+	if part := personalInfo("x7#doe@example.com", []string{"doe@example.com"}); part != "email address" {
+		t.Errorf("personalInfo = %q, want email address", part)
+	}
+	if part := personalInfo("x7#doeq!9", []string{"Jane Doe"}); part != "name" {
+		t.Errorf("personalInfo = %q, want name", part)
+	}
+}
+
+func TestCheckScoresShortPasswordsOnly(t *testing.T) {
+	policy := Policy{MaxLength: 0, MinScore: 4}
+	long := ""
+	for len(long) <= maxScoredLength {
+		long += "a"
+	}
+	if got := rules(t, policy.Check(long)); got != nil {
+		t.Errorf("Check of a %d character password = %v", len(long), got)
+	}
+	if got := rules(t, policy.Check(long[:maxScoredLength])); !reflect.DeepEqual(got, []string{RuleStrength}) {
+		t.Errorf("Check of a %d character password = %v", maxScoredLength, got)
+	}
+}
+
+func TestBreached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "breached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	files := map[string]string{
+		"5BAA6":     "0018A45C4D1DEF81644B54AB7F969B88D65:1\n1e4c9b93f3f0682250b6cf8331b7ee68fd8:3730471\n",
+		"7C4A8.txt": "7C4A8D09CA3762AF61E59520943DC26494F8941B\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		password string
+		breached bool
+	}{
+		{"password", true},
+		// a .txt file of full hashes
+		{"123456", true},
+		{"x7#Kq!9vLz", false},
+		{"Password", false},
+	}
+	for _, test := range tests {
+		if got := Breached(dir, test.password); got != test.breached {
+			t.Errorf("Breached(%q) = %v, want %v", test.password, got, test.breached)
+		}
+	}
+
+	policy := Policy{BreachedDir: dir}
+	if got := rules(t, policy.Check("password")); !reflect.DeepEqual(got, []string{RuleBreached}) {
+		t.Errorf("Check = %v", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	env := map[string]string{
+		"PASSWORD_MIN_LENGTH":        "12",
+		"PASSWORD_MAX_LENGTH":        "10",
+		"PASSWORD_REQUIRE":           " Upper ,digit,emoji",
+		"PASSWORD_MIN_SCORE":         "9",
+		"PASSWORD_BREACHED_HASH_DIR": "",
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	want := Policy{MinLength: 12, MaxLength: 12, RequireUpper: true, RequireDigit: true, MinScore: 4}
+	if got := Load(); got != want {
+		t.Errorf("Load = %+v, want %+v", got, want)
+	}
+
+	for key := range env {
+		os.Unsetenv(key)
+	}
+	want = Policy{MinLength: 8, MaxLength: 128, MinScore: 2}
+	if got := Load(); got != want {
+		t.Errorf("Load with defaults = %+v, want %+v", got, want)
+	}
+}
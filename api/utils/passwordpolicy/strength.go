@@ -0,0 +1,311 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxScoredLength bounds the estimate, which looks at every substring.
+const maxScoredLength = 128
+
+// Guesses below these thresholds give scores 0 to 3, as in zxcvbn.
+var scoreThresholds = []float64{3, 6, 8, 10}
+
+const (
+	// bruteforceCardinality is the guesses per character not covered by a
+	// pattern.
+	bruteforceCardinality = 10
+	minSubstringGuesses   = 50
+	minCharGuesses        = 10
+	keyboardStartingKeys  = 94
+)
+
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+	"~!@#$%^&*()_+", "qwertyuiop{}|", "asdfghjkl:\"", "zxcvbnm<>?",
+	"7894561230",
+}
+
+type match struct {
+	start, end int
+	// log10 of the guesses needed for the matched characters
+	guesses float64
+}
+
+// Score estimates how hard password is to guess, zxcvbn style: the password
+// is covered with the cheapest sequence of known patterns (common passwords
+// and words, userInputs, repeats, sequences, keyboard runs and years) and
+// brute force, and the guesses that takes map to a score from 0 (too
+// guessable) to 4 (very unguessable).
+func Score(password string, userInputs ...string) int {
+	log10Guesses := Guesses(password, userInputs...)
+	for score, threshold := range scoreThresholds {
+		if log10Guesses < threshold {
+			return score
+		}
+	}
+
+	return 4
+}
+
+// Guesses returns the base 10 logarithm of the estimated guesses needed to
+// find password.
+func Guesses(password string, userInputs ...string) float64 {
+	runes := []rune(password)
+	n := len(runes)
+	if n == 0 {
+		return 0
+	}
+
+	ranked := userDictionary(userInputs)
+	matches := make([][]match, n+1)
+	for end := 1; end <= n; end++ {
+		for start := 0; start < end; start++ {
+			matches[end] = append(matches[end], match{start: start, end: end, guesses: float64(end-start) * math.Log10(bruteforceCardinality)})
+			if guesses, ok := patternGuesses(runes[start:end], ranked); ok {
+				minimum := float64(minSubstringGuesses)
+				if end-start == 1 {
+					minimum = minCharGuesses
+				}
+				matches[end] = append(matches[end], match{start: start, end: end, guesses: math.Log10(math.Max(guesses, minimum))})
+			}
+		}
+	}
+
+	// best[i][l] covers the first i characters with l matches
+	best := make([][]float64, n+1)
+	for i := range best {
+		best[i] = make([]float64, n+1)
+		for l := range best[i] {
+			best[i][l] = math.Inf(1)
+		}
+	}
+	best[0][0] = 0
+	for end := 1; end <= n; end++ {
+		for _, m := range matches[end] {
+			for l := 1; l <= m.end; l++ {
+				if candidate := best[m.start][l-1] + m.guesses; candidate < best[end][l] {
+					best[end][l] = candidate
+				}
+			}
+		}
+	}
+
+	// the attacker also has to guess the number of patterns and their order
+	result := math.Inf(1)
+	for l := 1; l <= n; l++ {
+		if math.IsInf(best[n][l], 1) {
+			continue
+		}
+		if total := best[n][l] + log10Factorial(l); total < result {
+			result = total
+		}
+	}
+
+	return result
+}
+
+func log10Factorial(n int) float64 {
+	lgamma, _ := math.Lgamma(float64(n + 1))
+	return lgamma / math.Ln10
+}
+
+// userDictionary ranks the words of userInputs first, ahead of the common
+// password list.
+func userDictionary(userInputs []string) map[string]int {
+	ranked := map[string]int{}
+	rank := 1
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		words := strings.FieldsFunc(input, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		for _, word := range append([]string{input}, words...) {
+			if word == "" {
+				continue
+			}
+			if _, ok := ranked[word]; !ok {
+				ranked[word] = rank
+				rank++
+			}
+		}
+	}
+
+	return ranked
+}
+
+// patternGuesses returns the guesses for token when it matches a pattern.
+func patternGuesses(token []rune, ranked map[string]int) (float64, bool) {
+	guesses := math.Inf(1)
+	found := false
+	consider := func(value float64) {
+		if value < guesses {
+			guesses = value
+			found = true
+		}
+	}
+
+	if value, ok := dictionaryGuesses(token, ranked); ok {
+		consider(value)
+	}
+	if value, ok := repeatGuesses(token); ok {
+		consider(value)
+	}
+	if value, ok := sequenceGuesses(token); ok {
+		consider(value)
+	}
+	if value, ok := keyboardGuesses(token); ok {
+		consider(value)
+	}
+	if value, ok := yearGuesses(token); ok {
+		consider(value)
+	}
+
+	return guesses, found
+}
+
+func dictionaryGuesses(token []rune, ranked map[string]int) (float64, bool) {
+	if len(token) < 3 {
+		return 0, false
+	}
+
+	word := strings.ToLower(string(token))
+	unleeted := []rune(word)
+	substituted := false
+	for i, r := range unleeted {
+		if plain, ok := leetSubstitutions[r]; ok {
+			unleeted[i] = plain
+			substituted = true
+		}
+	}
+
+	lookup := func(candidate string) (int, bool) {
+		if rank, ok := ranked[candidate]; ok {
+			return rank, true
+		}
+		if rank, ok := commonPasswordRanks[candidate]; ok {
+			return rank + len(ranked), true
+		}
+		return 0, false
+	}
+
+	best := math.Inf(1)
+	for _, candidate := range []string{word, string(unleeted)} {
+		if rank, ok := lookup(candidate); ok {
+			best = math.Min(best, float64(rank))
+		}
+		if rank, ok := lookup(reverse(candidate)); ok {
+			best = math.Min(best, float64(rank)*2)
+		}
+	}
+	if math.IsInf(best, 1) {
+		return 0, false
+	}
+
+	// each variation doubles the guesses
+	if word != string(token) {
+		best *= 2
+	}
+	if substituted && string(unleeted) != word {
+		best *= 2
+	}
+
+	return best, true
+}
+
+func repeatGuesses(token []rune) (float64, bool) {
+	if len(token) < 3 {
+		return 0, false
+	}
+
+	// the shortest unit that repeats over the whole token
+	for size := 1; size <= len(token)/2; size++ {
+		if len(token)%size != 0 {
+			continue
+		}
+		repeats := true
+		for i := size; i < len(token); i++ {
+			if token[i] != token[i-size] {
+				repeats = false
+				break
+			}
+		}
+		if repeats {
+			unit := math.Pow(bruteforceCardinality, float64(size))
+			return unit * float64(len(token)/size), true
+		}
+	}
+
+	return 0, false
+}
+
+func sequenceGuesses(token []rune) (float64, bool) {
+	if len(token) < 3 {
+		return 0, false
+	}
+
+	delta := token[1] - token[0]
+	if delta != 1 && delta != -1 {
+		return 0, false
+	}
+	for i := 2; i < len(token); i++ {
+		if token[i]-token[i-1] != delta {
+			return 0, false
+		}
+	}
+
+	base := 26.0
+	switch first := token[0]; {
+	case strings.ContainsRune("aAzZ019", first):
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	}
+	guesses := base * float64(len(token))
+	if delta < 0 {
+		guesses *= 2
+	}
+
+	return guesses, true
+}
+
+func keyboardGuesses(token []rune) (float64, bool) {
+	if len(token) < 4 {
+		return 0, false
+	}
+
+	word := strings.ToLower(string(token))
+	for _, row := range keyboardRows {
+		if strings.Contains(row, word) || strings.Contains(reverse(row), word) {
+			return keyboardStartingKeys * float64(len(token)), true
+		}
+	}
+
+	return 0, false
+}
+
+func yearGuesses(token []rune) (float64, bool) {
+	if len(token) != 4 {
+		return 0, false
+	}
+
+	year, err := strconv.Atoi(string(token))
+	if err != nil || year < 1900 || year > 2039 {
+		return 0, false
+	}
+
+	return 140, true
+}
+
+func reverse(value string) string {
+	runes := []rune(value)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
@@ -0,0 +1,109 @@
+package passwordpolicy
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		password string
+		score    int
+	}{
+		{"", 0},
+		{"password", 0},
+		// variations of common passwords are barely harder to guess
+		{"Password", 0},
+		{"P@ssw0rd", 0},
+		{"drowssap", 0},
+		{"aaaaaaaaaa", 0},
+		{"abcdefgh", 0},
+		{"qwertyuiop", 0},
+		{"mustang1", 1},
+		{"19871987", 1},
+		{"x7#Kq!9vLz", 4},
+		{"correct horse battery staple", 4},
+	}
+	for _, test := range tests {
+		if score := Score(test.password); score != test.score {
+			t.Errorf("Score(%q) = %d (%.2f), want %d", test.password, score, Guesses(test.password), test.score)
+		}
+	}
+}
+
+func TestScoreUserInputs(t *testing.T) {
+	without := Guesses("janedoe42")
+	with := Guesses("janedoe42", "jane@example.com", "Jane Doe")
+	if with >= without {
+		t.Errorf("user inputs did not lower the guesses: %.2f with, %.2f without", with, without)
+	}
+	if score := Score("janedoe42", "jane@example.com", "Jane Doe"); score > 2 {
+		t.Errorf("Score with user inputs = %d", score)
+	}
+}
+
+func TestPatternGuesses(t *testing.T) {
+	tests := []struct {
+		name    string
+		guesses func([]rune) (float64, bool)
+		token   string
+		want    float64
+		ok      bool
+	}{
+		{"repeat", repeatGuesses, "aaaa", 10 * 4, true},
+		{"repeat", repeatGuesses, "abcabc", 1000 * 2, true},
+		{"repeat", repeatGuesses, "abcab", 0, false},
+		{"sequence", sequenceGuesses, "abcd", 4 * 4, true},
+		{"sequence", sequenceGuesses, "mnop", 26 * 4, true},
+		{"sequence", sequenceGuesses, "4567", 10 * 4, true},
+		{"sequence", sequenceGuesses, "dcba", 26 * 4 * 2, true},
+		{"sequence", sequenceGuesses, "abce", 0, false},
+		{"keyboard", keyboardGuesses, "asdf", 94 * 4, true},
+		{"keyboard", keyboardGuesses, "FDSA", 94 * 4, true},
+		{"keyboard", keyboardGuesses, "asdg", 0, false},
+		{"year", yearGuesses, "1987", 140, true},
+		{"year", yearGuesses, "2077", 0, false},
+	}
+	for _, test := range tests {
+		got, ok := test.guesses([]rune(test.token))
+		if ok != test.ok || got != test.want {
+			t.Errorf("%s %q = %v, %v, want %v, %v", test.name, test.token, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestDictionaryGuesses(t *testing.T) {
+	rank := float64(commonPasswordRanks["monkey"])
+	tests := []struct {
+		token string
+		want  float64
+	}{
+		{"monkey", rank},
+		{"yeknom", rank * 2},
+		{"Monkey", rank * 2},
+		{"m0nkey", rank * 2},
+		{"M0nkey", rank * 4},
+	}
+	for _, test := range tests {
+		got, ok := dictionaryGuesses([]rune(test.token), nil)
+		if !ok || got != test.want {
+			t.Errorf("dictionaryGuesses(%q) = %v, %v, want %v", test.token, got, ok, test.want)
+		}
+	}
+
+	// user inputs rank ahead of the common passwords
+	ranked := userDictionary([]string{"Jane Doe"})
+	if got, ok := dictionaryGuesses([]rune("doe"), ranked); !ok || got != 3 {
+		t.Errorf("dictionaryGuesses(doe) = %v, %v, want 3", got, ok)
+	}
+	if got, _ := dictionaryGuesses([]rune("monkey"), ranked); got != rank+float64(len(ranked)) {
+		t.Errorf("dictionaryGuesses(monkey) = %v, want %v", got, rank+float64(len(ranked)))
+	}
+}
+
+func TestGuessesBruteforce(t *testing.T) {
+	// without patterns every character costs a factor of ten
+	if got := Guesses("x7#K"); math.Abs(got-4) > 1e-9 {
+		t.Errorf("Guesses = %v, want 4", got)
+	}
+}
@@ -0,0 +1,86 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// the SHA-1 test vectors of RFC 6238 appendix B, truncated to six digits
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, test := range tests {
+		code, err := Code(rfc6238Secret, Step(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != test.code {
+			t.Errorf("Code at %d = %s, want %s", test.unix, code, test.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	for offset := int64(-Skew); offset <= Skew; offset++ {
+		code, err := Code(rfc6238Secret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := Validate(rfc6238Secret, code, now)
+		if !ok || step != current+offset {
+			t.Errorf("code of step %+d: got step %d, %v", offset, step, ok)
+		}
+	}
+
+	for _, offset := range []int64{-Skew - 1, Skew + 1} {
+		code, err := Code(rfc6238Secret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := Validate(rfc6238Secret, code, now); ok {
+			t.Errorf("code of step %+d accepted outside the window", offset)
+		}
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	if _, ok := Validate(rfc6238Secret, "050 471", now); !ok {
+		t.Error("code with a space was refused")
+	}
+	for _, code := range []string{"", "05047", "0504710", "abcdef"} {
+		if _, ok := Validate(rfc6238Secret, code, now); ok {
+			t.Errorf("Validate(%q) accepted", code)
+		}
+	}
+	if _, ok := Validate("not base32!", "050471", now); ok {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+}
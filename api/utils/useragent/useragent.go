@@ -0,0 +1,81 @@
+package useragent
+
+import (
+	"strings"
+)
+
+const unknownDevice = "Unknown device"
+
+// browsers are tried in order, as most user agents also name the engines
+// they are compatible with.
+var browsers = []struct {
+	token string
+	name  string
+}{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Version/", "Safari"},
+}
+
+var systems = []struct {
+	token string
+	name  string
+}{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// DeviceName describes the device behind a User-Agent header for people,
+// e.g. "Firefox on Windows". Other clients are named by their first product
+// token, e.g. "curl".
+func DeviceName(userAgent string) string {
+	userAgent = strings.TrimSpace(userAgent)
+	if userAgent == "" {
+		return unknownDevice
+	}
+
+	browser := ""
+	for _, candidate := range browsers {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+
+	system := ""
+	for _, candidate := range systems {
+		if strings.Contains(userAgent, candidate.token) {
+			system = candidate.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+
+	product := strings.Fields(userAgent)[0]
+	if slash := strings.IndexByte(product, '/'); slash > 0 {
+		product = product[:slash]
+	}
+
+	return product
+}
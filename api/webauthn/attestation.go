@@ -0,0 +1,114 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+// id-fido-gen-ce-aaguid, the certificate extension carrying the AAGUID.
+var oidFIDOAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+type attestationObject struct {
+	Format    string
+	Statement map[interface{}]interface{}
+	AuthData  []byte
+}
+
+func parseAttestationObject(raw []byte) (*attestationObject, error) {
+	value, n, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(raw) {
+		return nil, errors.New("trailing data after attestation object")
+	}
+
+	m, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("attestation object is not a map")
+	}
+
+	object := &attestationObject{}
+	object.Format, _ = m["fmt"].(string)
+	object.Statement, _ = m["attStmt"].(map[interface{}]interface{})
+	object.AuthData, _ = m["authData"].([]byte)
+	if object.Format == "" || object.Statement == nil || object.AuthData == nil {
+		return nil, errors.New("malformed attestation object")
+	}
+
+	return object, nil
+}
+
+// verify checks the attestation statement. Only "none" and "packed" are
+// supported; certificates are not chained to a trust anchor, so attestation
+// proves possession of the key rather than the authenticator model.
+func (object *attestationObject) verify(authData *AuthenticatorData, clientDataHash []byte, credentialKey *PublicKey) error {
+	switch object.Format {
+	case "none":
+		if len(object.Statement) != 0 {
+			return errors.New("none attestation must have an empty statement")
+		}
+		return nil
+	case "packed":
+		return object.verifyPacked(authData, clientDataHash, credentialKey)
+	}
+
+	return fmt.Errorf("unsupported attestation format %q", object.Format)
+}
+
+func (object *attestationObject) verifyPacked(authData *AuthenticatorData, clientDataHash []byte, credentialKey *PublicKey) error {
+	alg, _ := object.Statement["alg"].(int64)
+	sig, _ := object.Statement["sig"].([]byte)
+	if sig == nil {
+		return errors.New("packed attestation without signature")
+	}
+	signed := append(append([]byte{}, object.AuthData...), clientDataHash...)
+
+	x5c, hasCertificates := object.Statement["x5c"].([]interface{})
+	if !hasCertificates {
+		// self attestation, signed by the credential key itself
+		if alg != credentialKey.Algorithm {
+			return errors.New("self attestation algorithm does not match the credential")
+		}
+		return credentialKey.Verify(signed, sig)
+	}
+
+	if len(x5c) == 0 {
+		return errors.New("packed attestation with empty x5c")
+	}
+	der, _ := x5c[0].([]byte)
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+
+	if certificate.Version != 3 || certificate.IsCA {
+		return errors.New("invalid attestation certificate")
+	}
+	for _, extension := range certificate.Extensions {
+		if !extension.Id.Equal(oidFIDOAAGUID) {
+			continue
+		}
+		var aaguid []byte
+		if _, err := asn1.Unmarshal(extension.Value, &aaguid); err != nil || !bytes.Equal(aaguid, authData.AAGUID) {
+			return errors.New("attestation certificate AAGUID does not match")
+		}
+	}
+
+	var algorithm x509.SignatureAlgorithm
+	switch alg {
+	case AlgES256:
+		algorithm = x509.ECDSAWithSHA256
+	case AlgRS256:
+		algorithm = x509.SHA256WithRSA
+	case AlgEdDSA:
+		algorithm = x509.PureEd25519
+	default:
+		return fmt.Errorf("unsupported attestation algorithm %d", alg)
+	}
+
+	return certificate.CheckSignature(algorithm, signed, sig)
+}
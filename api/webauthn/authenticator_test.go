@@ -0,0 +1,315 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// cborMap keeps the order of its entries, unlike a Go map, so the encoded
+// bytes are stable.
+type cborMap []cborEntry
+
+type cborEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+func cborHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		b := []byte{major<<5 | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(arg))
+		return b
+	case arg <= 0xffffffff:
+		b := []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(arg))
+		return b
+	}
+	b := []byte{major<<5 | 27, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(b[1:], arg)
+	return b
+}
+
+// encodeCBOR is the encoder side of decodeCBOR, for the values a software
+// authenticator produces.
+func encodeCBOR(value interface{}) []byte {
+	switch v := value.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case []interface{}:
+		b := cborHead(4, uint64(len(v)))
+		for _, item := range v {
+			b = append(b, encodeCBOR(item)...)
+		}
+		return b
+	case cborMap:
+		b := cborHead(5, uint64(len(v)))
+		for _, entry := range v {
+			b = append(b, encodeCBOR(entry.Key)...)
+			b = append(b, encodeCBOR(entry.Value)...)
+		}
+		return b
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+// softAuthenticator is an authenticator in software, holding a single
+// credential for rpID.
+type softAuthenticator struct {
+	rpID         string
+	algorithm    int64
+	ecdsaKey     *ecdsa.PrivateKey
+	ed25519Key   ed25519.PrivateKey
+	credentialID []byte
+	aaguid       []byte
+	signCount    uint32
+	// counter is false for authenticators that always report zero
+	counter bool
+	flags   byte
+}
+
+func newSoftAuthenticator(t *testing.T, rpID string, algorithm int64) *softAuthenticator {
+	t.Helper()
+
+	authenticator := &softAuthenticator{
+		rpID:         rpID,
+		algorithm:    algorithm,
+		credentialID: randomBytes(t, 16),
+		aaguid:       randomBytes(t, 16),
+		counter:      true,
+		flags:        flagUserPresent | flagUserVerified,
+	}
+
+	var err error
+	switch algorithm {
+	case AlgES256:
+		authenticator.ecdsaKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, authenticator.ed25519Key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("unsupported algorithm %d", algorithm)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return authenticator
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func padded(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	if a.algorithm == AlgES256 {
+		return encodeCBOR(cborMap{
+			{coseKeyType, coseKeyTypeEC2},
+			{coseKeyAlg, AlgES256},
+			{coseKeyCurve, coseCurveP256},
+			{coseKeyX, padded(a.ecdsaKey.X, 32)},
+			{coseKeyY, padded(a.ecdsaKey.Y, 32)},
+		})
+	}
+
+	return encodeCBOR(cborMap{
+		{coseKeyType, coseKeyTypeOKP},
+		{coseKeyAlg, AlgEdDSA},
+		{coseKeyCurve, coseCurveEd25519},
+		{coseKeyX, []byte(a.ed25519Key.Public().(ed25519.PublicKey))},
+	})
+}
+
+func (a *softAuthenticator) sign(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	if a.algorithm == AlgEdDSA {
+		return ed25519.Sign(a.ed25519Key, data)
+	}
+
+	hash := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, a.ecdsaKey, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func (a *softAuthenticator) authenticatorData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedCredentialData
+	}
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.signCount)
+
+	if attested {
+		data = append(data, a.aaguid...)
+		data = append(data, byte(len(a.credentialID)>>8), byte(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+
+	return data
+}
+
+func clientDataJSON(t *testing.T, ceremony string, challenge []byte, origin string) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(clientData{Type: ceremony, Challenge: challenge, Origin: origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// attestationCertificate issues a packed attestation certificate for the
+// authenticator's AAGUID, signed by a key of its own.
+func (a *softAuthenticator) attestationCertificate(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aaguid, err := asn1.Marshal(a.aaguid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "Software Authenticator", OrganizationalUnit: []string{"Authenticator Attestation"}},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: oidFIDOAAGUID, Value: aaguid}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, der
+}
+
+// create answers navigator.credentials.create() with the given attestation
+// format: "none", "packed" (self attestation) or "packed-x5c".
+func (a *softAuthenticator) create(t *testing.T, challenge []byte, origin, format string) *AttestationResponse {
+	t.Helper()
+
+	clientData := clientDataJSON(t, "webauthn.create", challenge, origin)
+	authData := a.authenticatorData(true)
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	statement := cborMap{}
+	switch format {
+	case "packed":
+		statement = cborMap{
+			{"alg", a.algorithm},
+			{"sig", a.sign(t, signed)},
+		}
+	case "packed-x5c":
+		format = "packed"
+		key, certificate := a.attestationCertificate(t)
+		hash := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+		if err != nil {
+			t.Fatal(err)
+		}
+		statement = cborMap{
+			{"alg", AlgES256},
+			{"sig", signature},
+			{"x5c", []interface{}{certificate}},
+		}
+	}
+
+	response := &AttestationResponse{
+		ID:    string(a.credentialID),
+		RawID: a.credentialID,
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = clientData
+	response.Response.AttestationObject = encodeCBOR(cborMap{
+		{"fmt", format},
+		{"attStmt", statement},
+		{"authData", authData},
+	})
+	response.Response.Transports = []string{"internal"}
+
+	return response
+}
+
+// get answers navigator.credentials.get(), counting the signature.
+func (a *softAuthenticator) get(t *testing.T, challenge []byte, origin string) *AssertionResponse {
+	t.Helper()
+
+	if a.counter {
+		a.signCount++
+	}
+	clientData := clientDataJSON(t, "webauthn.get", challenge, origin)
+	authData := a.authenticatorData(false)
+	clientDataHash := sha256.Sum256(clientData)
+
+	response := &AssertionResponse{
+		ID:    string(a.credentialID),
+		RawID: a.credentialID,
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = clientData
+	response.Response.AuthenticatorData = authData
+	response.Response.Signature = a.sign(t, append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	return response
+}
@@ -0,0 +1,125 @@
+package webauthn
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  interface{}
+	}{
+		{"small integer", []byte{0x17}, int64(23)},
+		{"one byte integer", []byte{0x18, 0x18}, int64(24)},
+		{"negative integer", []byte{0x38, 0x63}, int64(-100)},
+		{"byte string", []byte{0x43, 1, 2, 3}, []byte{1, 2, 3}},
+		{"text string", []byte{0x63, 'f', 'm', 't'}, "fmt"},
+		{"array", []byte{0x82, 0x01, 0x20}, []interface{}{int64(1), int64(-1)}},
+		{"map", []byte{0xa2, 0x01, 0x02, 0x61, 'a', 0xf5}, map[interface{}]interface{}{int64(1): int64(2), "a": true}},
+		{"tagged item", []byte{0xc2, 0x41, 0x01}, []byte{1}},
+		{"null", []byte{0xf6}, nil},
+	}
+	for _, test := range tests {
+		value, n, err := decodeCBOR(test.input)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if n != len(test.input) || !reflect.DeepEqual(value, test.want) {
+			t.Errorf("%s: got %#v (%d bytes), want %#v", test.name, value, n, test.want)
+		}
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"empty", []byte{}, "unexpected end"},
+		{"truncated argument", []byte{0x19, 0x01}, "unexpected end"},
+		{"truncated byte string", []byte{0x45, 1, 2}, "unexpected end"},
+		{"byte string longer than the input", []byte{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "unexpected end"},
+		{"array longer than the input", []byte{0x9a, 0xff, 0xff, 0xff, 0xff}, "unexpected end"},
+		{"map longer than the input", []byte{0xba, 0xff, 0xff, 0xff, 0xff, 0x01}, "unexpected end"},
+		{"indefinite length", []byte{0x5f, 0x41, 0x01, 0xff}, "unsupported additional information"},
+		{"reserved additional information", []byte{0x1c}, "unsupported additional information"},
+		{"integer overflow", []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "integer overflow"},
+		{"byte string map key", []byte{0xa1, 0x41, 0x01, 0x01}, "unsupported map key"},
+		{"duplicate map key", []byte{0xa2, 0x01, 0x01, 0x01, 0x02}, "duplicate map key"},
+		{"nesting too deep", bytes.Repeat([]byte{0x81}, maxCBORDepth+1), "nesting too deep"},
+		{"unsupported simple value", []byte{0xf0}, "unsupported simple value"},
+	}
+	for _, test := range tests {
+		_, _, err := decodeCBOR(test.input)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want an error containing %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestParseAuthenticatorDataMalformed(t *testing.T) {
+	authenticator := newSoftAuthenticator(t, "auth.example.com", AlgES256)
+	attested := authenticator.authenticatorData(true)
+	withExtensionFlag := append([]byte{}, attested...)
+	withExtensionFlag[32] |= flagExtensionData
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"too short", attested[:36], "too short"},
+		{"attested credential data too short", attested[:37+17], "attested credential data is too short"},
+		{"credential ID longer than the data", attested[:37+18+4], "invalid credential ID length"},
+		{"truncated public key", attested[:len(attested)-1], "unexpected end"},
+		{"trailing data", append(append([]byte{}, attested...), 0x00), "trailing data"},
+		{"extension flag without extensions", withExtensionFlag, "unexpected end"},
+	}
+	for _, test := range tests {
+		_, err := ParseAuthenticatorData(test.input)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want an error containing %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestParsePublicKeyMalformed(t *testing.T) {
+	authenticator := newSoftAuthenticator(t, "auth.example.com", AlgES256)
+	key := authenticator.coseKey()
+
+	offCurve := encodeCBOR(cborMap{
+		{coseKeyType, coseKeyTypeEC2},
+		{coseKeyAlg, AlgES256},
+		{coseKeyCurve, coseCurveP256},
+		{coseKeyX, make([]byte, 32)},
+		{coseKeyY, append(make([]byte, 31), 1)},
+	})
+	mismatchedAlgorithm := encodeCBOR(cborMap{
+		{coseKeyType, coseKeyTypeEC2},
+		{coseKeyAlg, AlgEdDSA},
+	})
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"trailing data", append(append([]byte{}, key...), 0x00), "trailing data"},
+		{"not a map", encodeCBOR([]interface{}{1}), "not a map"},
+		{"point not on the curve", offCurve, "not on the curve"},
+		{"key type and algorithm mismatch", mismatchedAlgorithm, "unsupported key type"},
+		{"truncated", key[:len(key)-1], "unexpected end"},
+	}
+	for _, test := range tests {
+		_, err := ParsePublicKey(test.input)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want an error containing %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 8152) of the supported credential keys.
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// COSE key types and parameters.
+const (
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+
+	coseKeyType   = 1
+	coseKeyAlg    = 3
+	coseKeyCurve  = -1
+	coseKeyX      = -2
+	coseKeyY      = -3
+	coseKeyRSAN   = -1
+	coseKeyRSAE   = -2
+	minRSAKeySize = 2048
+)
+
+// PublicKey is a credential public key decoded from its COSE encoding.
+type PublicKey struct {
+	Algorithm int64
+	Key       crypto.PublicKey
+}
+
+// ParsePublicKey decodes a COSE_Key as found in authenticator data.
+func ParsePublicKey(coseKey []byte) (*PublicKey, error) {
+	value, n, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(coseKey) {
+		return nil, errors.New("cose: trailing data after key")
+	}
+
+	return publicKeyFromMap(value)
+}
+
+func publicKeyFromMap(value interface{}) (*PublicKey, error) {
+	m, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("cose: key is not a map")
+	}
+
+	keyType, _ := m[int64(coseKeyType)].(int64)
+	alg, _ := m[int64(coseKeyAlg)].(int64)
+
+	switch {
+	case keyType == coseKeyTypeEC2 && alg == AlgES256:
+		curve, _ := m[int64(coseKeyCurve)].(int64)
+		x, _ := m[int64(coseKeyX)].([]byte)
+		y, _ := m[int64(coseKeyY)].([]byte)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("cose: invalid P-256 key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("cose: point is not on the curve")
+		}
+		return &PublicKey{Algorithm: alg, Key: key}, nil
+
+	case keyType == coseKeyTypeOKP && alg == AlgEdDSA:
+		curve, _ := m[int64(coseKeyCurve)].(int64)
+		x, _ := m[int64(coseKeyX)].([]byte)
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("cose: invalid Ed25519 key")
+		}
+		return &PublicKey{Algorithm: alg, Key: ed25519.PublicKey(x)}, nil
+
+	case keyType == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := m[int64(coseKeyRSAN)].([]byte)
+		e, _ := m[int64(coseKeyRSAE)].([]byte)
+		if len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("cose: invalid RSA exponent")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSAKeySize {
+			return nil, fmt.Errorf("cose: RSA keys must be at least %d bits", minRSAKeySize)
+		}
+		return &PublicKey{Algorithm: alg, Key: key}, nil
+	}
+
+	return nil, fmt.Errorf("cose: unsupported key type %d with algorithm %d", keyType, alg)
+}
+
+// Verify checks signature over data. ES256 signatures are ASN.1 encoded, as
+// authenticators produce them.
+func (key *PublicKey) Verify(data, signature []byte) error {
+	switch public := key.Key.(type) {
+	case *ecdsa.PublicKey:
+		var sig struct {
+			R, S *big.Int
+		}
+		rest, err := asn1.Unmarshal(signature, &sig)
+		if err != nil || len(rest) > 0 {
+			return errors.New("invalid signature")
+		}
+		hash := sha256.Sum256(data)
+		if !ecdsa.Verify(public, hash[:], sig.R, sig.S) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(public, data, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(data)
+		if rsa.VerifyPKCS1v15(public, crypto.SHA256, hash[:], signature) != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported public key type %T", key.Key)
+}
@@ -0,0 +1,415 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// User verification requirements.
+const (
+	VerificationRequired    = "required"
+	VerificationPreferred   = "preferred"
+	VerificationDiscouraged = "discouraged"
+)
+
+var ErrSignCountRegression = errors.New("signature counter did not increase, the authenticator may have been cloned")
+
+// RelyingParty verifies registration and assertion ceremonies for one RP ID.
+// It holds no state; challenges are stored by the caller.
+type RelyingParty struct {
+	ID               string
+	Name             string
+	Origins          []string
+	Timeout          time.Duration
+	UserVerification string
+}
+
+// LoadRelyingParty reads the relying party from the environment:
+//
+//	WEBAUTHN_RP_ID    domain credentials are scoped to, defaults to the APP_URL host
+//	WEBAUTHN_RP_NAME  name shown by authenticators, defaults to auth-global
+//	WEBAUTHN_ORIGINS  comma separated origins allowed to run ceremonies, defaults to APP_URL
+//
+// It returns nil when neither WEBAUTHN_RP_ID nor APP_URL is set.
+func LoadRelyingParty() (*RelyingParty, error) {
+	rp := &RelyingParty{
+		ID:               os.Getenv("WEBAUTHN_RP_ID"),
+		Name:             os.Getenv("WEBAUTHN_RP_NAME"),
+		Timeout:          5 * time.Minute,
+		UserVerification: VerificationPreferred,
+	}
+	if rp.Name == "" {
+		rp.Name = "auth-global"
+	}
+
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			rp.Origins = append(rp.Origins, strings.TrimRight(origin, "/"))
+		}
+	}
+
+	if appURL := os.Getenv("APP_URL"); appURL != "" {
+		parsed, err := url.Parse(appURL)
+		if err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid APP_URL %q", appURL)
+		}
+		if rp.ID == "" {
+			rp.ID = parsed.Hostname()
+		}
+		if len(rp.Origins) == 0 {
+			rp.Origins = []string{parsed.Scheme + "://" + parsed.Host}
+		}
+	}
+
+	if rp.ID == "" {
+		return nil, nil
+	}
+	if len(rp.Origins) == 0 {
+		rp.Origins = []string{"https://" + rp.ID}
+	}
+
+	return rp, nil
+}
+
+// URLEncodedBytes marshals to unpadded base64url, the encoding used for
+// binary fields in the JSON exchanged with the browser. Padded input is
+// accepted too.
+type URLEncodedBytes []byte
+
+func (b URLEncodedBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *URLEncodedBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+
+	return nil
+}
+
+func NewChallenge() (URLEncodedBytes, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          URLEncodedBytes `json:"id"`
+	Name        string          `json:"name"`
+	DisplayName string          `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string          `json:"type"`
+	ID         URLEncodedBytes `json:"id"`
+	Transports []string        `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions is passed to navigator.credentials.create() as publicKey.
+type CreationOptions struct {
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              URLEncodedBytes        `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is passed to navigator.credentials.get() as publicKey. An
+// empty AllowCredentials lets the user pick a discoverable credential.
+type RequestOptions struct {
+	Challenge        URLEncodedBytes        `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+func (rp *RelyingParty) CreationOptions(challenge []byte, user UserEntity, exclude []CredentialDescriptor) CreationOptions {
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+
+	return CreationOptions{
+		RP:        RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:      user,
+		Challenge: challenge,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Algorithm: AlgES256},
+			{Type: "public-key", Algorithm: AlgEdDSA},
+			{Type: "public-key", Algorithm: AlgRS256},
+		},
+		Timeout:            rp.Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: rp.UserVerification,
+		},
+		Attestation: "none",
+	}
+}
+
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []CredentialDescriptor) RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: rp.UserVerification,
+	}
+}
+
+// AttestationResponse is the PublicKeyCredential returned by
+// navigator.credentials.create().
+type AttestationResponse struct {
+	ID       string          `json:"id"`
+	RawID    URLEncodedBytes `json:"rawId"`
+	Type     string          `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+		AttestationObject URLEncodedBytes `json:"attestationObject"`
+		Transports        []string        `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the PublicKeyCredential returned by
+// navigator.credentials.get().
+type AssertionResponse struct {
+	ID       string          `json:"id"`
+	RawID    URLEncodedBytes `json:"rawId"`
+	Type     string          `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBytes `json:"clientDataJSON"`
+		AuthenticatorData URLEncodedBytes `json:"authenticatorData"`
+		Signature         URLEncodedBytes `json:"signature"`
+		UserHandle        URLEncodedBytes `json:"userHandle"`
+	} `json:"response"`
+}
+
+type clientData struct {
+	Type        string          `json:"type"`
+	Challenge   URLEncodedBytes `json:"challenge"`
+	Origin      string          `json:"origin"`
+	CrossOrigin bool            `json:"crossOrigin"`
+}
+
+func parseClientData(raw []byte) (*clientData, error) {
+	data := &clientData{}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, fmt.Errorf("invalid client data: %v", err)
+	}
+
+	return data, nil
+}
+
+// Challenge returns the challenge the browser signed, so the caller can look
+// up the ceremony it belongs to.
+func (response *AttestationResponse) Challenge() ([]byte, error) {
+	data, err := parseClientData(response.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.Challenge, nil
+}
+
+func (response *AssertionResponse) Challenge() ([]byte, error) {
+	data, err := parseClientData(response.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.Challenge, nil
+}
+
+// Credential is what a relying party stores about a registered
+// authenticator.
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte
+	Algorithm    int64
+	SignCount    uint32
+	AAGUID       []byte
+	Transports   []string
+	UserVerified bool
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	data, err := parseClientData(raw)
+	if err != nil {
+		return err
+	}
+
+	if data.Type != ceremony {
+		return fmt.Errorf("unexpected client data type %q", data.Type)
+	}
+	if len(challenge) == 0 || subtle.ConstantTimeCompare(data.Challenge, challenge) != 1 {
+		return errors.New("challenge mismatch")
+	}
+	if data.CrossOrigin {
+		return errors.New("cross-origin ceremonies are not allowed")
+	}
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("origin %q is not allowed", data.Origin)
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(data *AuthenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(data.RPIDHash, rpIDHash[:]) != 1 {
+		return errors.New("RP ID hash mismatch")
+	}
+	if !data.UserPresent() {
+		return errors.New("user was not present")
+	}
+	if rp.UserVerification == VerificationRequired && !data.UserVerified() {
+		return errors.New("user was not verified")
+	}
+
+	return nil
+}
+
+// VerifyRegistration checks a navigator.credentials.create() response
+// against the challenge issued for it and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, response *AttestationResponse) (*Credential, error) {
+	if response.Type != "public-key" {
+		return nil, errors.New("credential type must be public-key")
+	}
+
+	err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := parseAttestationObject(response.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+
+	authData, err := ParseAuthenticatorData(object.AuthData)
+	if err != nil {
+		return nil, err
+	}
+	err = rp.verifyAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.CredentialID == nil {
+		return nil, errors.New("attested credential data missing")
+	}
+	if !bytes.Equal(authData.CredentialID, response.RawID) {
+		return nil, errors.New("credential ID mismatch")
+	}
+
+	credentialKey, err := ParsePublicKey(authData.CredentialPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	err = object.verify(authData, clientDataHash[:], credentialKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:           authData.CredentialID,
+		PublicKey:    authData.CredentialPublicKey,
+		Algorithm:    credentialKey.Algorithm,
+		SignCount:    authData.SignCount,
+		AAGUID:       authData.AAGUID,
+		Transports:   response.Response.Transports,
+		UserVerified: authData.UserVerified(),
+	}, nil
+}
+
+// VerifyAssertion checks a navigator.credentials.get() response made with
+// credential. The returned data carries the new signature counter, which the
+// caller stores.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, response *AssertionResponse, credential *Credential) (*AuthenticatorData, error) {
+	if response.Type != "public-key" {
+		return nil, errors.New("credential type must be public-key")
+	}
+	if !bytes.Equal(response.RawID, credential.ID) {
+		return nil, errors.New("credential ID mismatch")
+	}
+
+	err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	authData, err := ParseAuthenticatorData(response.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	err = rp.verifyAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialKey, err := ParsePublicKey(credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	signed := append(append([]byte{}, response.Response.AuthenticatorData...), clientDataHash[:]...)
+	err = credentialKey.Verify(signed, response.Response.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// authenticators without a counter always report zero
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		return nil, ErrSignCountRegression
+	}
+
+	return authData, nil
+}
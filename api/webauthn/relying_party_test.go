@@ -0,0 +1,339 @@
+package webauthn
+
+import (
+	"strings"
+	"testing"
+)
+
+const testOrigin = "https://auth.example.com"
+
+func newTestRelyingParty() *RelyingParty {
+	return &RelyingParty{
+		ID:               "auth.example.com",
+		Name:             "auth-global",
+		Origins:          []string{testOrigin},
+		UserVerification: VerificationPreferred,
+	}
+}
+
+func newTestChallenge(t *testing.T) []byte {
+	t.Helper()
+
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+func register(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, format string) *Credential {
+	t.Helper()
+
+	challenge := newTestChallenge(t)
+	credential, err := rp.VerifyRegistration(challenge, authenticator.create(t, challenge, testOrigin, format))
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return credential
+}
+
+func TestCeremonies(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm int64
+		format    string
+	}{
+		{"ES256 none", AlgES256, "none"},
+		{"EdDSA none", AlgEdDSA, "none"},
+		{"ES256 packed self attestation", AlgES256, "packed"},
+		{"EdDSA packed self attestation", AlgEdDSA, "packed"},
+		{"ES256 packed with certificate", AlgES256, "packed-x5c"},
+		{"EdDSA packed with certificate", AlgEdDSA, "packed-x5c"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rp := newTestRelyingParty()
+			authenticator := newSoftAuthenticator(t, rp.ID, test.algorithm)
+
+			credential := register(t, rp, authenticator, test.format)
+			if string(credential.ID) != string(authenticator.credentialID) {
+				t.Errorf("credential ID = %x, want %x", credential.ID, authenticator.credentialID)
+			}
+			if credential.Algorithm != test.algorithm {
+				t.Errorf("algorithm = %d, want %d", credential.Algorithm, test.algorithm)
+			}
+			if string(credential.AAGUID) != string(authenticator.aaguid) || !credential.UserVerified {
+				t.Errorf("credential %+v does not match the authenticator", credential)
+			}
+
+			for i := 0; i < 2; i++ {
+				challenge := newTestChallenge(t)
+				data, err := rp.VerifyAssertion(challenge, authenticator.get(t, challenge, testOrigin), credential)
+				if err != nil {
+					t.Fatalf("VerifyAssertion: %v", err)
+				}
+				if data.SignCount != authenticator.signCount {
+					t.Errorf("sign count = %d, want %d", data.SignCount, authenticator.signCount)
+				}
+				credential.SignCount = data.SignCount
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse
+		want   string
+	}{
+		{
+			name: "RP ID hash mismatch",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				authenticator.rpID = "evil.example.com"
+				return authenticator.create(t, challenge, testOrigin, "none")
+			},
+			want: "RP ID hash mismatch",
+		},
+		{
+			name: "wrong origin",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				return authenticator.create(t, challenge, "https://evil.example.com", "none")
+			},
+			want: "is not allowed",
+		},
+		{
+			name: "challenge mismatch",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				return authenticator.create(t, newTestChallenge(t), testOrigin, "none")
+			},
+			want: "challenge mismatch",
+		},
+		{
+			name: "assertion client data",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				response := authenticator.create(t, challenge, testOrigin, "none")
+				response.Response.ClientDataJSON = clientDataJSON(t, "webauthn.get", challenge, testOrigin)
+				return response
+			},
+			want: "unexpected client data type",
+		},
+		{
+			name: "user not present",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				authenticator.flags = 0
+				return authenticator.create(t, challenge, testOrigin, "none")
+			},
+			want: "user was not present",
+		},
+		{
+			name: "user verification required",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				rp.UserVerification = VerificationRequired
+				authenticator.flags = flagUserPresent
+				return authenticator.create(t, challenge, testOrigin, "none")
+			},
+			want: "user was not verified",
+		},
+		{
+			name: "credential ID mismatch",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				response := authenticator.create(t, challenge, testOrigin, "none")
+				response.RawID = []byte("another credential")
+				return response
+			},
+			want: "credential ID mismatch",
+		},
+		{
+			name: "malformed attestation object",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				response := authenticator.create(t, challenge, testOrigin, "none")
+				response.Response.AttestationObject = response.Response.AttestationObject[:len(response.Response.AttestationObject)-10]
+				return response
+			},
+			want: "cbor",
+		},
+		{
+			name: "trailing data after attestation object",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				response := authenticator.create(t, challenge, testOrigin, "none")
+				response.Response.AttestationObject = append(response.Response.AttestationObject, 0x00)
+				return response
+			},
+			want: "trailing data",
+		},
+		{
+			name: "none attestation with a statement",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				response := authenticator.create(t, challenge, testOrigin, "packed")
+				object := encodeCBOR(cborMap{
+					{"fmt", "none"},
+					{"attStmt", cborMap{{"alg", authenticator.algorithm}}},
+					{"authData", authenticator.authenticatorData(true)},
+				})
+				response.Response.AttestationObject = object
+				return response
+			},
+			want: "empty statement",
+		},
+		{
+			name: "packed signature over other client data",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				response := authenticator.create(t, challenge, testOrigin, "packed")
+				response.Response.ClientDataJSON = clientDataJSON(t, "webauthn.create", challenge, testOrigin+"/")
+				rp.Origins = append(rp.Origins, testOrigin+"/")
+				return response
+			},
+			want: "invalid signature",
+		},
+		{
+			name: "unsupported attestation format",
+			tamper: func(t *testing.T, rp *RelyingParty, authenticator *softAuthenticator, challenge []byte) *AttestationResponse {
+				response := authenticator.create(t, challenge, testOrigin, "none")
+				response.Response.AttestationObject = encodeCBOR(cborMap{
+					{"fmt", "fido-u2f"},
+					{"attStmt", cborMap{}},
+					{"authData", authenticator.authenticatorData(true)},
+				})
+				return response
+			},
+			want: "unsupported attestation format",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rp := newTestRelyingParty()
+			authenticator := newSoftAuthenticator(t, rp.ID, AlgES256)
+			challenge := newTestChallenge(t)
+
+			_, err := rp.VerifyRegistration(challenge, test.tamper(t, rp, authenticator, challenge))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, authenticator *softAuthenticator, credential *Credential, challenge []byte) *AssertionResponse
+		want   string
+	}{
+		{
+			name: "RP ID hash mismatch",
+			tamper: func(t *testing.T, authenticator *softAuthenticator, credential *Credential, challenge []byte) *AssertionResponse {
+				authenticator.rpID = "evil.example.com"
+				return authenticator.get(t, challenge, testOrigin)
+			},
+			want: "RP ID hash mismatch",
+		},
+		{
+			name: "wrong origin",
+			tamper: func(t *testing.T, authenticator *softAuthenticator, credential *Credential, challenge []byte) *AssertionResponse {
+				return authenticator.get(t, challenge, "https://auth.example.com.evil.example")
+			},
+			want: "is not allowed",
+		},
+		{
+			name: "challenge mismatch",
+			tamper: func(t *testing.T, authenticator *softAuthenticator, credential *Credential, challenge []byte) *AssertionResponse {
+				return authenticator.get(t, newTestChallenge(t), testOrigin)
+			},
+			want: "challenge mismatch",
+		},
+		{
+			name: "registration client data",
+			tamper: func(t *testing.T, authenticator *softAuthenticator, credential *Credential, challenge []byte) *AssertionResponse {
+				response := authenticator.get(t, challenge, testOrigin)
+				response.Response.ClientDataJSON = clientDataJSON(t, "webauthn.create", challenge, testOrigin)
+				return response
+			},
+			want: "unexpected client data type",
+		},
+		{
+			name: "sign count regression",
+			tamper: func(t *testing.T, authenticator *softAuthenticator, credential *Credential, challenge []byte) *AssertionResponse {
+				credential.SignCount = 10
+				authenticator.signCount = 9
+				return authenticator.get(t, challenge, testOrigin)
+			},
+			want: ErrSignCountRegression.Error(),
+		},
+		{
+			name: "replayed sign count",
+			tamper: func(t *testing.T, authenticator *softAuthenticator, credential *Credential, challenge []byte) *AssertionResponse {
+				credential.SignCount = authenticator.signCount + 1
+				return authenticator.get(t, challenge, testOrigin)
+			},
+			want: ErrSignCountRegression.Error(),
+		},
+		{
+			name: "signature of another key",
+			tamper: func(t *testing.T, authenticator *softAuthenticator, credential *Credential, challenge []byte) *AssertionResponse {
+				other := newSoftAuthenticator(t, authenticator.rpID, AlgES256)
+				other.credentialID = authenticator.credentialID
+				return other.get(t, challenge, testOrigin)
+			},
+			want: "invalid signature",
+		},
+		{
+			name: "tampered authenticator data",
+			tamper: func(t *testing.T, authenticator *softAuthenticator, credential *Credential, challenge []byte) *AssertionResponse {
+				response := authenticator.get(t, challenge, testOrigin)
+				response.Response.AuthenticatorData[33] ^= 0xff
+				return response
+			},
+			want: "invalid signature",
+		},
+		{
+			name: "malformed authenticator data",
+			tamper: func(t *testing.T, authenticator *softAuthenticator, credential *Credential, challenge []byte) *AssertionResponse {
+				response := authenticator.get(t, challenge, testOrigin)
+				response.Response.AuthenticatorData = response.Response.AuthenticatorData[:36]
+				return response
+			},
+			want: "too short",
+		},
+		{
+			name: "other credential",
+			tamper: func(t *testing.T, authenticator *softAuthenticator, credential *Credential, challenge []byte) *AssertionResponse {
+				response := authenticator.get(t, challenge, testOrigin)
+				response.RawID = []byte("another credential")
+				return response
+			},
+			want: "credential ID mismatch",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rp := newTestRelyingParty()
+			authenticator := newSoftAuthenticator(t, rp.ID, AlgES256)
+			credential := register(t, rp, authenticator, "none")
+			challenge := newTestChallenge(t)
+
+			_, err := rp.VerifyAssertion(challenge, test.tamper(t, authenticator, credential, challenge), credential)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionWithoutCounter(t *testing.T) {
+	rp := newTestRelyingParty()
+	authenticator := newSoftAuthenticator(t, rp.ID, AlgEdDSA)
+	credential := register(t, rp, authenticator, "none")
+
+	authenticator.counter = false
+	for i := 0; i < 2; i++ {
+		challenge := newTestChallenge(t)
+		data, err := rp.VerifyAssertion(challenge, authenticator.get(t, challenge, testOrigin), credential)
+		if err != nil {
+			t.Fatalf("assertion %d: %v", i, err)
+		}
+		if data.SignCount != 0 {
+			t.Errorf("sign count = %d, want 0", data.SignCount)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_created_at_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS password_reset_required_at;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	credential_id VARCHAR(1400) UNIQUE NOT NULL,
+	public_key BYTEA NOT NULL,
+	algorithm INTEGER NOT NULL,
+	sign_count BIGINT NOT NULL DEFAULT 0,
+	aaguid VARCHAR(32) NOT NULL DEFAULT '',
+	transports VARCHAR(255) NOT NULL DEFAULT '',
+	name VARCHAR(255) NOT NULL DEFAULT '',
+	last_used_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+	ceremony VARCHAR(32) NOT NULL,
+	challenge VARCHAR(255) UNIQUE NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
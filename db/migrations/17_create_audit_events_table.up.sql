@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	action VARCHAR(64) NOT NULL,
+	result VARCHAR(16) NOT NULL,
+	detail VARCHAR(255) NOT NULL DEFAULT '',
+	actor_id BIGINT,
+	actor_email VARCHAR(255) NOT NULL DEFAULT '',
+	target_id BIGINT,
+	target_email VARCHAR(255) NOT NULL DEFAULT '',
+	ip VARCHAR(64) NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_created_at_idx ON audit_events (actor_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_events_target_id_created_at_idx ON audit_events (target_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_events_action_created_at_idx ON audit_events (action, created_at);
+
+-- the log is append-only; events outlive the users they mention
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE PROCEDURE audit_events_append_only();
+
+INSERT INTO permissions (name, description) VALUES ('audit:read', 'Query the audit log') ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.name = 'audit:read'
+ON CONFLICT DO NOTHING;
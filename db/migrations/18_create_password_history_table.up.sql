@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS password_history (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	password_hash VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS password_history_user_id_created_at_idx ON password_history (user_id, created_at);
+
+-- every account starts with its current password
+INSERT INTO password_history (user_id, password_hash, created_at)
+SELECT id, password, updated_at FROM users
+WHERE NOT EXISTS (SELECT 1 FROM password_history WHERE password_history.user_id = users.id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	public_id VARCHAR(255) NOT NULL UNIQUE,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	device VARCHAR(255) NOT NULL,
+	user_agent VARCHAR(512) NOT NULL DEFAULT '',
+	ip VARCHAR(64) NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,29 @@
+-- space separated, matched exactly; clients without a secret are public
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS redirect_uris TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS client_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	code_hash VARCHAR(255) NOT NULL UNIQUE,
+	client_id BIGINT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	session_id VARCHAR(255) NOT NULL,
+	redirect_uri TEXT NOT NULL,
+	scope TEXT NOT NULL DEFAULT '',
+	code_challenge VARCHAR(255) NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	used_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS oauth_consents (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	client_id BIGINT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	scope TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, client_id)
+);
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name IN ('clients:read', 'clients:write');
+
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS scopes;
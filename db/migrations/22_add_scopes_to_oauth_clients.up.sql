@@ -0,0 +1,12 @@
+-- space separated scopes a client may be granted with client_credentials
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS scopes TEXT NOT NULL DEFAULT '';
+
+INSERT INTO permissions (name, description) VALUES
+	('clients:read', 'List registered OAuth clients'),
+	('clients:write', 'Register and delete OAuth clients')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.name IN ('clients:read', 'clients:write')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS oauth_device_codes (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	device_code_hash VARCHAR(255) NOT NULL UNIQUE,
+	user_code_hash VARCHAR(255) NOT NULL UNIQUE,
+	client_id BIGINT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	scope TEXT NOT NULL DEFAULT '',
+	-- set when the user approves the code in the browser
+	user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+	session_id VARCHAR(255) NOT NULL DEFAULT '',
+	poll_interval INTEGER NOT NULL,
+	last_polled_at TIMESTAMP WITH TIME ZONE,
+	approved_at TIMESTAMP WITH TIME ZONE,
+	denied_at TIMESTAMP WITH TIME ZONE,
+	used_at TIMESTAMP WITH TIME ZONE,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS previous_secret_expires_at;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS previous_secret_hash;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS grant_types;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS logo_uri;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS client_type;
@@ -0,0 +1,21 @@
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS client_type VARCHAR(16) NOT NULL DEFAULT 'confidential';
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS logo_uri TEXT NOT NULL DEFAULT '';
+-- space separated grant types the client may use
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS grant_types TEXT NOT NULL DEFAULT '';
+-- the secret before the last rotation keeps working until it expires
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS previous_secret_hash VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS previous_secret_expires_at TIMESTAMP WITH TIME ZONE;
+
+-- existing clients keep what they could do: public clients were the ones
+-- without a secret, and scopes, which only limited client_credentials, now
+-- limit every grant
+UPDATE oauth_clients SET client_type = 'public' WHERE client_secret_hash = '';
+
+UPDATE oauth_clients SET grant_types = CONCAT_WS(' ',
+	CASE WHEN redirect_uris <> '' THEN 'authorization_code refresh_token' END,
+	CASE WHEN client_type = 'confidential' THEN 'client_credentials' END,
+	'urn:ietf:params:oauth:grant-type:device_code'
+) WHERE grant_types = '';
+
+UPDATE oauth_clients SET scopes = TRIM(BOTH ' ' FROM scopes || ' openid email profile')
+WHERE redirect_uris <> '' OR client_type = 'public';
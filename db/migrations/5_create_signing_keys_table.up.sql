@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS signing_keys (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	kid VARCHAR(255) UNIQUE NOT NULL,
+	algorithm VARCHAR(32) NOT NULL,
+	private_key TEXT NOT NULL,
+	state VARCHAR(32) NOT NULL,
+	activates_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	retires_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS oauth_clients (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	client_id VARCHAR(255) UNIQUE NOT NULL,
+	client_secret_hash VARCHAR(255) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS audience VARCHAR(255) NOT NULL DEFAULT '';
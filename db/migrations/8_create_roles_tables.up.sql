@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS roles (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	name VARCHAR(255) UNIQUE NOT NULL,
+	description VARCHAR(255) NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+	id BIGSERIAL PRIMARY KEY NOT NULL,
+	name VARCHAR(255) UNIQUE NOT NULL,
+	description VARCHAR(255) NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+	role_id BIGINT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+	permission_id BIGINT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+	PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role_id BIGINT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, role_id)
+);
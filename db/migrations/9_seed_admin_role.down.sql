@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE name IN ('roles:read', 'roles:write');
+DELETE FROM roles WHERE name = 'admin';
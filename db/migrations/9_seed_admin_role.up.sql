@@ -0,0 +1,11 @@
+INSERT INTO roles (name, description) VALUES ('admin', 'Full access to the admin API') ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+	('roles:read', 'List roles and permissions'),
+	('roles:write', 'Manage roles, permissions and role assignments')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.name IN ('roles:read', 'roles:write')
+ON CONFLICT DO NOTHING;
@@ -1,7 +1,16 @@
 package main
 
-import "github.com/norfabagas/auth-global/api"
+import (
+	"os"
+
+	"github.com/norfabagas/auth-global/api"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		api.Keys(os.Args[2:])
+		return
+	}
+
 	api.Run()
 }